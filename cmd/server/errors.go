@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"post-comment-app/graph"
+	"post-comment-app/graph/auth"
+	"post-comment-app/graph/filter"
+	"post-comment-app/graph/ratelimit"
+	"post-comment-app/storage"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Значения extensions.code, по которым клиенты различают ошибки.
+const (
+	codeNotFound         = "NOT_FOUND"
+	codeValidationFailed = "VALIDATION_FAILED"
+	codeConflict         = "CONFLICT"
+	codeCommentsDisabled = "COMMENTS_DISABLED"
+	codeUnauthenticated  = "UNAUTHENTICATED"
+	codeForbidden        = "FORBIDDEN"
+	codeContentRejected  = "CONTENT_REJECTED"
+	codeRateLimited      = "RATE_LIMITED"
+)
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return codeNotFound
+	case errors.Is(err, storage.ErrInvalidID), errors.Is(err, storage.ErrInvalidCursor), errors.Is(err, graph.ErrValidation):
+		return codeValidationFailed
+	case errors.Is(err, storage.ErrConflict):
+		return codeConflict
+	case errors.Is(err, storage.ErrCommentsDisabled):
+		return codeCommentsDisabled
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return codeUnauthenticated
+	case errors.Is(err, auth.ErrForbidden):
+		return codeForbidden
+	case errors.Is(err, filter.ErrRejected):
+		return codeContentRejected
+	case errors.Is(err, ratelimit.ErrLimited):
+		return codeRateLimited
+	}
+	return ""
+}
+
+// errorPresenter дополняет стандартное представление ошибки кодом в extensions,
+// а при превышении лимита - ещё и числом секунд до повтора в retryAfter.
+func errorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	if code := errorCode(err); code != "" {
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = map[string]any{}
+		}
+		gqlErr.Extensions["code"] = code
+	}
+	var limited *ratelimit.Error
+	if errors.As(err, &limited) {
+		gqlErr.Extensions["retryAfter"] = limited.RetryAfterSeconds()
+	}
+	return gqlErr
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"post-comment-app/graph"
+	"post-comment-app/graph/auth"
+	"post-comment-app/graph/filter"
+	"post-comment-app/graph/model"
+	"post-comment-app/graph/ratelimit"
+	"post-comment-app/storage"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	resolver := graph.NewResolver(storage.NewInMemoryStorage())
+	resolver.SetContentFilter(filter.Pipeline{filter.RepeatedChars{Max: 3}})
+	srv := handler.New(graph.NewExecutableSchema(graph.NewConfig(resolver)))
+	srv.AddTransport(transport.POST{})
+	srv.SetErrorPresenter(errorPresenter)
+	c := client.New(srv)
+
+	author := asUser("A")
+	var closed, open struct {
+		CreatePost struct{ ID string }
+	}
+	createPost := `mutation($allow: Boolean!) { createPost(title: "T", content: "C", allowComments: $allow) { id } }`
+	c.MustPost(createPost, &closed, author, client.Var("allow", false))
+	c.MustPost(createPost, &open, author, client.Var("allow", true))
+
+	tests := []struct {
+		name    string
+		query   string
+		vars    []client.Option
+		code    string
+		message string
+	}{
+		{"NotFound", `{ post(id: "missing") { id } }`, nil, codeNotFound, "post not found"},
+		{"InvalidID", `{ comment(id: "") { id } }`, nil, codeValidationFailed, "invalid id"},
+		{"InvalidCursor", `{ postsConnection(after: "bm90LWEtdGltZXxpZA") { edges { cursor } } }`, nil, codeValidationFailed, "invalid cursor"},
+		{"Validation", `mutation { createPost(title: "", content: "C", allowComments: true) { id } }`, []client.Option{author},
+			codeValidationFailed, "title and content must not be empty"},
+		{"Unauthenticated", `mutation { createPost(title: "T", content: "C", allowComments: true) { id } }`, nil,
+			codeUnauthenticated, "authentication required"},
+		{"Forbidden", `mutation($id: ID!) { deletePost(id: $id) }`, []client.Option{client.Var("id", open.CreatePost.ID), asUser("B")},
+			codeForbidden, "only the author or a moderator can change this post"},
+		{"CommentsDisabled", `mutation($id: ID!) { addComment(postID: $id, text: "T") { id } }`,
+			[]client.Option{client.Var("id", closed.CreatePost.ID), author}, codeCommentsDisabled, "comments are not allowed"},
+		{"ParentNotFound", `mutation($id: ID!) { addComment(postID: $id, parentID: "missing", text: "T") { id } }`,
+			[]client.Option{client.Var("id", open.CreatePost.ID), author}, codeNotFound, "parent comment not found"},
+		{"ContentRejected", `mutation($id: ID!) { addComment(postID: $id, text: "Nooooo") { id } }`,
+			[]client.Option{client.Var("id", open.CreatePost.ID), author}, codeContentRejected, "content rejected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := c.RawPost(tt.query, tt.vars...)
+			require.NoError(t, err)
+
+			var errs []struct {
+				Message    string
+				Extensions map[string]any
+			}
+			require.NoError(t, json.Unmarshal(resp.Errors, &errs))
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Message, tt.message)
+			assert.Equal(t, tt.code, errs[0].Extensions["code"])
+		})
+	}
+
+	t.Run("RateLimited", func(t *testing.T) {
+		resolver.SetRateLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(time.Hour),
+			map[string]ratelimit.Limit{"addComment": {Burst: 1, Period: time.Hour}}))
+		defer resolver.SetRateLimiter(nil)
+		addComment := `mutation($id: ID!) { addComment(postID: $id, text: "T") { id } }`
+		opts := []client.Option{client.Var("id", open.CreatePost.ID), author}
+		var added struct {
+			AddComment struct{ ID string }
+		}
+		c.MustPost(addComment, &added, opts...)
+
+		resp, err := c.RawPost(addComment, opts...)
+		require.NoError(t, err)
+		var errs []struct {
+			Message    string
+			Extensions map[string]any
+		}
+		require.NoError(t, json.Unmarshal(resp.Errors, &errs))
+		require.Len(t, errs, 1)
+		assert.Equal(t, "rate limit exceeded for addComment", errs[0].Message)
+		assert.Equal(t, codeRateLimited, errs[0].Extensions["code"])
+		assert.Equal(t, float64(3600), errs[0].Extensions["retryAfter"])
+	})
+
+	t.Run("AnonymousRateLimited", func(t *testing.T) {
+		resolver.SetRateLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(time.Hour),
+			map[string]ratelimit.Limit{"createPost": {Burst: 1, Period: time.Hour}}))
+		defer resolver.SetRateLimiter(nil)
+		createPost := `mutation { createPost(title: "T", content: "C", allowComments: true) { id } }`
+
+		// Лимит срабатывает раньше проверки роли, и анонимный перебор расходует его
+		for _, code := range []string{codeUnauthenticated, codeRateLimited} {
+			resp, err := c.RawPost(createPost)
+			require.NoError(t, err)
+			var errs []struct {
+				Message    string
+				Extensions map[string]any
+			}
+			require.NoError(t, json.Unmarshal(resp.Errors, &errs))
+			require.Len(t, errs, 1)
+			assert.Equal(t, code, errs[0].Extensions["code"])
+		}
+	})
+}
+
+// asUser выполняет запрос от имени автора id, минуя проверку токена.
+func asUser(id string) client.Option {
+	return func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(auth.WithPrincipal(bd.HTTP.Context(), &auth.Principal{UserID: id, Role: model.RoleAuthor}))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"post-comment-app/storage"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = "usage: server migrate up | down [steps] | status"
+
+// runMigrate выполняет подкоманду "migrate" над базой dsn и пишет отчёт в out.
+func runMigrate(ctx context.Context, dsn string, args []string, out io.Writer) error {
+	if dsn == "" {
+		return errors.New("DATABASE_URL is required for migrations")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	pgStore, err := storage.NewPostgresStorage(dsn)
+	if err != nil {
+		return fmt.Errorf("failed to initialize postgres storage: %w", err)
+	}
+	defer pgStore.Close()
+	migrator, err := pgStore.Migrator()
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read migration status: %w", err)
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", st.Version, st.Name, applied)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+func migrateOnStart(pgStore *storage.PostgresStorage) error {
+	migrator, err := pgStore.Migrator()
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background())
+	for _, m := range applied {
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Usage", func(t *testing.T) {
+		err := runMigrate(ctx, "", []string{"up"}, &bytes.Buffer{})
+		assert.EqualError(t, err, "DATABASE_URL is required for migrations")
+		err = runMigrate(ctx, "postgres://localhost/db", nil, &bytes.Buffer{})
+		assert.EqualError(t, err, migrateUsage)
+	})
+
+	t.Run("DownStopsAtIrreversible", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL not set")
+		}
+		// Откат идёт в отдельной схеме, чтобы не мешать тестам storage на той же базе
+		schema := "migrate_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+		conn, err := pgx.Connect(ctx, dsn)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close(context.Background()) })
+		_, err = conn.Exec(ctx, "CREATE SCHEMA "+schema)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+		schemaDSN := withSearchPath(t, dsn, schema)
+
+		var out bytes.Buffer
+		require.NoError(t, runMigrate(ctx, schemaDSN, []string{"up"}, &out))
+		out.Reset()
+		err = runMigrate(ctx, schemaDSN, []string{"down", "100"}, &out)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "migration 0003_text_comment_ids is irreversible")
+		assert.Contains(t, out.String(), "reverted 0004_comment_paths\n")
+		assert.NotContains(t, out.String(), "0003_text_comment_ids")
+
+		out.Reset()
+		require.NoError(t, runMigrate(ctx, schemaDSN, []string{"status"}, &out))
+		assert.Contains(t, out.String(), "0003_text_comment_ids\tapplied")
+		assert.Contains(t, out.String(), "0004_comment_paths\tpending")
+	})
+}
+
+// withSearchPath направляет подключения dsn в схему schema.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
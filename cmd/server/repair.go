@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"post-comment-app/storage"
+)
+
+// runRepairCounters выполняет подкоманду "repair-counters" над базой dsn и пишет отчёт в out.
+func runRepairCounters(ctx context.Context, dsn string, out io.Writer) error {
+	if dsn == "" {
+		return errors.New("DATABASE_URL is required to repair counters")
+	}
+
+	pgStore, err := storage.NewPostgresStorage(dsn)
+	if err != nil {
+		return fmt.Errorf("failed to initialize postgres storage: %w", err)
+	}
+	defer pgStore.Close()
+
+	posts, comments, err := pgStore.RepairCounters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to repair counters: %w", err)
+	}
+	fmt.Fprintf(out, "fixed counters: %d posts, %d comments\n", posts, comments)
+	return nil
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"post-comment-app/graph"
+	"post-comment-app/graph/auth"
+	"post-comment-app/graph/filter"
+	"post-comment-app/graph/loaders"
+	"post-comment-app/graph/ratelimit"
 	"post-comment-app/storage"
+	"strconv"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -26,6 +33,20 @@ func main() {
 		slog.Info("No .env file found, using system environment variables", "error", err)
 	}
 
+	// Подкоманды завершают процесс здесь, когда их отложенные вызовы уже выполнены
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), os.Getenv("DATABASE_URL"), os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "repair-counters" {
+		if err := runRepairCounters(context.Background(), os.Getenv("DATABASE_URL"), os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = defaultPort
@@ -46,6 +67,12 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to initialize postgres storage: %v", err)
 		}
+		// Схему можно обновлять отдельно через "server migrate up"
+		if os.Getenv("MIGRATE_ON_START") != "false" {
+			if err := migrateOnStart(pgStore); err != nil {
+				log.Fatalf("Failed to apply migrations: %v", err)
+			}
+		}
 		store = pgStore
 	default:
 		slog.Info("Using in-memory storage")
@@ -56,15 +83,63 @@ func main() {
 		defer pgStore.Close()
 	}
 
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: graph.NewResolver(store)}))
+	resolver := graph.NewResolver(store)
+	if v := os.Getenv("MAX_COMMENT_DEPTH"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			log.Fatalf("Invalid MAX_COMMENT_DEPTH %q", v)
+		}
+		resolver.SetMaxCommentDepth(depth)
+	}
+	filterConfig, err := filterConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid content filter configuration: %v", err)
+	}
+	contentFilter, err := filter.New(filterConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize content filter: %v", err)
+	}
+	resolver.SetContentFilter(contentFilter)
+
+	limits, err := rateLimitsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid rate limit configuration: %v", err)
+	}
+	if len(limits) > 0 {
+		// Корзина, простоявшая дольше самого длинного периода, снова полна
+		idle := ratelimit.LongestPeriod(limits)
+		var limitStore ratelimit.Store
+		switch os.Getenv("RATE_LIMIT_STORE") {
+		case "", "memory":
+			limitStore = ratelimit.NewMemoryStore(idle)
+		case "postgres":
+			if pgStore == nil {
+				log.Fatal("RATE_LIMIT_STORE=postgres requires STORAGE_TYPE=postgres")
+			}
+			limitStore = pgStore
+			go pruneRateBuckets(pgStore, idle)
+		default:
+			log.Fatalf("Invalid RATE_LIMIT_STORE %q", os.Getenv("RATE_LIMIT_STORE"))
+		}
+		resolver.SetRateLimiter(ratelimit.NewLimiter(limitStore, limits))
+	}
+
+	verifier, err := auth.NewVerifier(authConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT verification: %v", err)
+	}
+
+	srv := handler.New(graph.NewExecutableSchema(graph.NewConfig(resolver)))
 
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
 	srv.AddTransport(transport.Websocket{
 		KeepAlivePingInterval: 10 * time.Second,
+		InitFunc:              auth.WebsocketInitFunc(verifier),
 	})
 
+	srv.SetErrorPresenter(errorPresenter)
 	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 
 	srv.Use(extension.Introspection{})
@@ -73,8 +148,80 @@ func main() {
 	})
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	trustForwarded := os.Getenv("RATE_LIMIT_TRUST_FORWARDED") == "true"
+	http.Handle("/query", ratelimit.Middleware(trustForwarded, auth.Middleware(verifier, loaders.Middleware(store, srv))))
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
+
+// authConfigFromEnv собирает ключи проверки JWT из переменных окружения.
+func authConfigFromEnv() auth.Config {
+	return auth.Config{
+		HS256Secret:    os.Getenv("JWT_HS256_SECRET"),
+		RS256PublicKey: os.Getenv("JWT_RS256_PUBLIC_KEY"),
+		JWKSFile:       os.Getenv("JWT_JWKS_FILE"),
+		Issuer:         os.Getenv("JWT_ISSUER"),
+		Audience:       os.Getenv("JWT_AUDIENCE"),
+	}
+}
+
+// filterConfigFromEnv собирает настройки встроенных фильтров содержимого из
+// переменных окружения; незаданная переменная выключает фильтр.
+func filterConfigFromEnv() (filter.Config, error) {
+	cfg := filter.Config{BannedWordsFile: os.Getenv("CONTENT_BANNED_WORDS_FILE")}
+	if v := os.Getenv("CONTENT_BANNED_WORDS_ACTION"); v != "" {
+		action, err := filter.ParseAction(v)
+		if err != nil {
+			return filter.Config{}, err
+		}
+		cfg.BannedWordsAction = action
+	}
+	for name, dst := range map[string]*int{"CONTENT_MAX_LINKS": &cfg.MaxLinks, "CONTENT_MAX_REPEATED_CHARS": &cfg.MaxRepeatedChars} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter.Config{}, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	if v := os.Getenv("CONTENT_DUPLICATE_WINDOW"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window < 0 {
+			return filter.Config{}, fmt.Errorf("invalid CONTENT_DUPLICATE_WINDOW %q", v)
+		}
+		cfg.DuplicateWindow = window
+	}
+	return cfg, nil
+}
+
+// rateLimitsFromEnv собирает лимиты мутаций из переменных окружения;
+// незаданная переменная снимает ограничение с мутации.
+func rateLimitsFromEnv() (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit)
+	for name, field := range map[string]string{"RATE_LIMIT_CREATE_POST": "createPost", "RATE_LIMIT_ADD_COMMENT": "addComment"} {
+		if v := os.Getenv(name); v != "" {
+			limit, err := ratelimit.ParseLimit(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			limits[field] = limit
+		}
+	}
+	return limits, nil
+}
+
+// pruneRateBuckets раз в idle удаляет из базы корзины, простоявшие дольше idle.
+func pruneRateBuckets(pgStore *storage.PostgresStorage, idle time.Duration) {
+	for range time.Tick(idle) {
+		n, err := pgStore.PruneRateBuckets(context.Background(), idle)
+		if err != nil {
+			slog.Error("Failed to prune rate limit buckets", "error", err)
+			continue
+		}
+		if n > 0 {
+			slog.Info("Pruned rate limit buckets", "count", n)
+		}
+	}
+}
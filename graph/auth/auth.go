@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"post-comment-app/graph/model"
+	"slices"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+)
+
+type ctxKey struct{}
+
+var (
+	// ErrUnauthenticated - операция требует токена, а запрос анонимный.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden - у пользователя не хватает прав на операцию.
+	ErrForbidden = errors.New("permission denied")
+)
+
+// Principal - пользователь, от имени которого выполняется запрос.
+type Principal struct {
+	// UserID - claim sub, он же ID пользователя в хранилище.
+	UserID string
+	// Name - claim name, имя для пользователя, которого ещё нет в хранилище.
+	Name string
+	// Role - claim role; без него пользователь считается читателем.
+	Role model.Role
+}
+
+// HasRole сообщает, что роль пользователя не ниже role. Роли упорядочены
+// так, как объявлены в схеме: каждая следующая включает права предыдущих.
+func (p *Principal) HasRole(role model.Role) bool {
+	return slices.Index(model.AllRole, p.Role) >= slices.Index(model.AllRole, role)
+}
+
+// Require возвращает ErrUnauthenticated для анонимного запроса и
+// ErrForbidden, если роль пользователя ниже role.
+func Require(ctx context.Context, role model.Role) (*Principal, error) {
+	p := For(ctx)
+	if p == nil {
+		return nil, ErrUnauthenticated
+	}
+	if !p.HasRole(role) {
+		return nil, fmt.Errorf("%w: %s role required", ErrForbidden, strings.ToLower(string(role)))
+	}
+	return p, nil
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// For возвращает пользователя текущего запроса или nil для анонимного запроса.
+func For(ctx context.Context) *Principal {
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
+
+// Middleware проверяет заголовок Authorization: Bearer и кладёт пользователя
+// в контекст. Запрос без заголовка проходит анонимно, с недействительным
+// токеном - отклоняется с 401.
+func Middleware(v *Verifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := verifyBearer(v, header)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// WebsocketInitFunc проверяет токен из параметра Authorization сообщения
+// connection_init: браузер не может передать заголовок при открытии websocket.
+// Без параметра соединение остаётся анонимным (или с пользователем из
+// заголовка, если клиент его передал), с недействительным токеном - закрывается.
+func WebsocketInitFunc(v *Verifier) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		header := payload.Authorization()
+		if header == "" {
+			return ctx, nil, nil
+		}
+		p, err := verifyBearer(v, header)
+		if err != nil {
+			return ctx, nil, err
+		}
+		return WithPrincipal(ctx, p), nil, nil
+	}
+}
+
+func verifyBearer(v *Verifier, header string) (*Principal, error) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, fmt.Errorf("%w: expected Bearer scheme", ErrInvalidToken)
+	}
+	return v.Verify(strings.TrimSpace(token))
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"post-comment-app/graph/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test-secret-0123456789abcdef01234"
+
+// sign собирает JWT. key - []byte для HS256 или *rsa.PrivateKey для RS256.
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	h := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(h) + "." + encode(claims)
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{"sub": "user-1", "name": "Alice", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	t.Run("NoKeys", func(t *testing.T) {
+		_, err := NewVerifier(Config{})
+		assert.Error(t, err)
+	})
+
+	t.Run("ShortHS256Secret", func(t *testing.T) {
+		_, err := NewVerifier(Config{HS256Secret: testSecret[:minHS256SecretLength-1]})
+		assert.Error(t, err)
+		_, err = NewVerifier(Config{HS256Secret: testSecret[:minHS256SecretLength]})
+		assert.NoError(t, err)
+	})
+
+	t.Run("HS256", func(t *testing.T) {
+		v, err := NewVerifier(Config{HS256Secret: testSecret})
+		require.NoError(t, err)
+
+		p, err := v.Verify(sign(t, "HS256", "", []byte(testSecret), validClaims()))
+		require.NoError(t, err)
+		assert.Equal(t, &Principal{UserID: "user-1", Name: "Alice", Role: model.RoleReader}, p)
+
+		_, err = v.Verify(sign(t, "HS256", "", []byte("other"), validClaims()))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		_, err = v.Verify("not.a-token")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		// alg none и подпись алгоритмом, для которого нет ключа
+		unsigned := strings.Split(sign(t, "none", "", []byte(testSecret), validClaims()), ".")
+		_, err = v.Verify(unsigned[0] + "." + unsigned[1] + ".")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		_, err = v.Verify(sign(t, "RS256", "", rsaKey, validClaims()))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("Claims", func(t *testing.T) {
+		v, err := NewVerifier(Config{HS256Secret: testSecret, Issuer: "issuer", Audience: "app"})
+		require.NoError(t, err)
+		check := func(change func(c map[string]any)) error {
+			c := validClaims()
+			c["iss"], c["aud"] = "issuer", []string{"other", "app"}
+			change(c)
+			_, err := v.Verify(sign(t, "HS256", "", []byte(testSecret), c))
+			return err
+		}
+
+		assert.NoError(t, check(func(c map[string]any) {}))
+		assert.NoError(t, check(func(c map[string]any) { c["aud"] = "app" }))
+		// Истёкший в пределах допустимого расхождения часов ещё принимается
+		assert.NoError(t, check(func(c map[string]any) { c["exp"] = time.Now().Add(-clockSkew / 2).Unix() }))
+		assert.ErrorIs(t, check(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), ErrInvalidToken)
+		assert.ErrorIs(t, check(func(c map[string]any) { delete(c, "exp") }), ErrInvalidToken)
+		assert.ErrorIs(t, check(func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() }), ErrInvalidToken)
+		assert.ErrorIs(t, check(func(c map[string]any) { delete(c, "sub") }), ErrInvalidToken)
+		assert.NoError(t, check(func(c map[string]any) { c["sub"] = strings.Repeat("u", maxSubjectLength) }))
+		assert.ErrorIs(t, check(func(c map[string]any) { c["sub"] = strings.Repeat("u", maxSubjectLength+1) }), ErrInvalidToken)
+		assert.ErrorIs(t, check(func(c map[string]any) { c["iss"] = "someone" }), ErrInvalidToken)
+		assert.ErrorIs(t, check(func(c map[string]any) { c["aud"] = "other" }), ErrInvalidToken)
+		assert.ErrorIs(t, check(func(c map[string]any) { c["role"] = "superuser" }), ErrInvalidToken)
+	})
+
+	t.Run("Role", func(t *testing.T) {
+		v, err := NewVerifier(Config{HS256Secret: testSecret})
+		require.NoError(t, err)
+		c := validClaims()
+		c["role"] = "moderator"
+		p, err := v.Verify(sign(t, "HS256", "", []byte(testSecret), c))
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleModerator, p.Role)
+	})
+
+	t.Run("RS256", func(t *testing.T) {
+		v, err := NewVerifier(Config{RS256PublicKey: publicPEM})
+		require.NoError(t, err)
+
+		p, err := v.Verify(sign(t, "RS256", "", rsaKey, validClaims()))
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", p.UserID)
+
+		// HS256 с открытым ключом в роли секрета не проходит
+		_, err = v.Verify(sign(t, "HS256", "", []byte(publicPEM), validClaims()))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		_, err = NewVerifier(Config{RS256PublicKey: "garbage"})
+		assert.Error(t, err)
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		jwks := map[string]any{"keys": []map[string]any{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "oct", "kid": "hmac-1", "k": b64([]byte(testSecret))},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256"},
+		}}
+		data, err := json.Marshal(jwks)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		v, err := NewVerifier(Config{JWKSFile: path})
+		require.NoError(t, err)
+		_, err = v.Verify(sign(t, "RS256", "rsa-1", rsaKey, validClaims()))
+		assert.NoError(t, err)
+		_, err = v.Verify(sign(t, "HS256", "hmac-1", []byte(testSecret), validClaims()))
+		assert.NoError(t, err)
+		_, err = v.Verify(sign(t, "RS256", "rsa-2", rsaKey, validClaims()))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		_, err = NewVerifier(Config{JWKSFile: filepath.Join(t.TempDir(), "missing.json")})
+		assert.Error(t, err)
+	})
+}
+
+func TestRequire(t *testing.T) {
+	ctx := context.Background()
+	_, err := Require(ctx, model.RoleReader)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	author := WithPrincipal(ctx, &Principal{UserID: "u", Role: model.RoleAuthor})
+	for role, allowed := range map[model.Role]bool{
+		model.RoleReader:    true,
+		model.RoleAuthor:    true,
+		model.RoleModerator: false,
+		model.RoleAdmin:     false,
+	} {
+		_, err := Require(author, role)
+		if allowed {
+			assert.NoError(t, err, role)
+		} else {
+			assert.ErrorIs(t, err, ErrForbidden, role)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	v, err := NewVerifier(Config{HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	var got *Principal
+	handler := Middleware(v, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = For(r.Context())
+	}))
+	serve := func(header string) int {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(""))
+	assert.Nil(t, got)
+
+	assert.Equal(t, http.StatusOK, serve("Bearer "+sign(t, "HS256", "", []byte(testSecret), validClaims())))
+	require.NotNil(t, got)
+	assert.Equal(t, "user-1", got.UserID)
+
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer "+sign(t, "HS256", "", []byte("other"), validClaims())))
+	assert.Nil(t, got)
+	assert.Equal(t, http.StatusUnauthorized, serve("Basic dXNlcjpwYXNz"))
+}
+
+func TestWebsocketInitFunc(t *testing.T) {
+	v, err := NewVerifier(Config{HS256Secret: testSecret})
+	require.NoError(t, err)
+	initFunc := WebsocketInitFunc(v)
+	ctx := context.Background()
+
+	got, _, err := initFunc(ctx, transport.InitPayload{})
+	require.NoError(t, err)
+	assert.Nil(t, For(got))
+
+	token := sign(t, "HS256", "", []byte(testSecret), validClaims())
+	got, _, err = initFunc(ctx, transport.InitPayload{"Authorization": "Bearer " + token})
+	require.NoError(t, err)
+	require.NotNil(t, For(got))
+	assert.Equal(t, "user-1", For(got).UserID)
+
+	_, _, err = initFunc(ctx, transport.InitPayload{"authorization": "Bearer broken"})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"post-comment-app/graph/model"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken - токен не разобран, подпись не сошлась или истёк срок.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Допустимое расхождение часов с издателем токенов при проверке exp и nbf.
+const clockSkew = 30 * time.Second
+
+// Наибольшая длина sub: он становится ID пользователя, а users.id - VARCHAR(36).
+const maxSubjectLength = 36
+
+// Наименьшая длина секрета HS256: короткий секрет перебирается по подписи токена.
+const minHS256SecretLength = 32
+
+const (
+	algHS256 = "HS256"
+	algRS256 = "RS256"
+)
+
+// Config описывает ключи проверки подписи. Можно задать любой набор из
+// секрета HS256, открытого ключа RS256 в PEM и файла JWKS.
+type Config struct {
+	HS256Secret    string
+	RS256PublicKey string
+	JWKSFile       string
+	// Если заданы, токен обязан содержать такие iss и aud.
+	Issuer   string
+	Audience string
+}
+
+type verifyKey struct {
+	// kid из JWKS. Ключ без kid и токен без kid сопоставляются с любым ключом.
+	kid    string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// Verifier проверяет JWT, подписанные HS256 или RS256.
+type Verifier struct {
+	keys     []verifyKey
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{issuer: cfg.Issuer, audience: cfg.Audience, now: time.Now}
+	if cfg.HS256Secret != "" {
+		if len(cfg.HS256Secret) < minHS256SecretLength {
+			return nil, fmt.Errorf("JWT HS256 secret must be at least %d bytes", minHS256SecretLength)
+		}
+		v.keys = append(v.keys, verifyKey{alg: algHS256, secret: []byte(cfg.HS256Secret)})
+	}
+	if cfg.RS256PublicKey != "" {
+		key, err := parseRSAPublicKey([]byte(cfg.RS256PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, verifyKey{alg: algRS256, public: key})
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = append(v.keys, keys...)
+	}
+	if len(v.keys) == 0 {
+		return nil, errors.New("no JWT verification keys configured")
+	}
+	return v, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Name      string   `json:"name"`
+	Role      string   `json:"role"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// audience - claim aud, который по RFC 7519 бывает строкой или массивом строк.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify проверяет подпись и сроки токена и возвращает его субъекта.
+// Токен без exp или sub и токен с неизвестной ролью отклоняются.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	if !v.verifySignature(h, parts[0]+"."+parts[1], signature) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: bad claims", ErrInvalidToken)
+	}
+	if err := v.checkClaims(&c); err != nil {
+		return nil, err
+	}
+	role := model.RoleReader
+	if c.Role != "" {
+		role = model.Role(strings.ToUpper(c.Role))
+		if !role.IsValid() {
+			return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidToken, c.Role)
+		}
+	}
+	return &Principal{UserID: c.Subject, Name: c.Name, Role: role}, nil
+}
+
+// verifySignature перебирает ключи с алгоритмом из заголовка. Алгоритм
+// сверяется с ключом, поэтому токен с alg "none" или HS256, подписанный
+// открытым RSA-ключом, не пройдёт.
+func (v *Verifier) verifySignature(h header, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	for _, k := range v.keys {
+		if k.alg != h.Alg || (k.kid != "" && h.Kid != "" && k.kid != h.Kid) {
+			continue
+		}
+		switch k.alg {
+		case algHS256:
+			mac := hmac.New(sha256.New, k.secret)
+			mac.Write([]byte(signed))
+			if hmac.Equal(signature, mac.Sum(nil)) {
+				return true
+			}
+		case algRS256:
+			if rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *Verifier) checkClaims(c *claims) error {
+	now := v.now()
+	switch {
+	case c.Subject == "":
+		return fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	case len(c.Subject) > maxSubjectLength:
+		return fmt.Errorf("%w: sub too long", ErrInvalidToken)
+	case c.ExpiresAt == nil:
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	case now.After(numericDate(*c.ExpiresAt).Add(clockSkew)):
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	case c.NotBefore != nil && now.Add(clockSkew).Before(numericDate(*c.NotBefore)):
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	case v.issuer != "" && c.Issuer != v.issuer:
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" {
+		for _, aud := range c.Audience {
+			if aud == v.audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func numericDate(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("RS256 public key: no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		// Ключ в формате PKCS#1 ("BEGIN RSA PUBLIC KEY")
+		if rsaKey, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("RS256 public key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("RS256 public key: not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// oct (симметричный ключ)
+	K string `json:"k"`
+}
+
+// loadJWKS читает ключи RS256 (kty RSA) и HS256 (kty oct) из файла JWKS.
+// Ключи других типов и ключи шифрования (use enc) пропускаются.
+func loadJWKS(path string) ([]verifyKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	var keys []verifyKey
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == algRS256):
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("parse JWKS: bad RSA key %q", k.Kid)
+			}
+			public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			keys = append(keys, verifyKey{kid: k.Kid, alg: algRS256, public: public})
+		case k.Kty == "oct" && (k.Alg == "" || k.Alg == algHS256):
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("parse JWKS: bad oct key %q", k.Kid)
+			}
+			keys = append(keys, verifyKey{kid: k.Kid, alg: algHS256, secret: secret})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("parse JWKS: no RS256 or HS256 keys in %s", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,148 @@
+package graph
+
+import (
+	"encoding/base64"
+	"post-comment-app/graph/model"
+	"post-comment-app/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Курсоры для клиента непрозрачны: base64 от "createdAt|id" или, если у порядка
+// есть ведущий ключ (Cursor.Value), от "createdAt|id|value".
+
+func encodeCursor(createdAt, id string) string {
+	return encodeKey(storage.Cursor{CreatedAt: createdAt, ID: id})
+}
+
+func encodeKey(c storage.Cursor) string {
+	raw := c.CreatedAt + "|" + c.ID
+	if c.Value != nil {
+		raw += "|" + strconv.FormatInt(*c.Value, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(after *string) (*storage.Cursor, error) {
+	if after == nil || *after == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(*after)
+	if err != nil {
+		return nil, invalidInput("invalid cursor")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, invalidInput("invalid cursor")
+	}
+	// Время уходит в хранилище как есть, поэтому проверяется здесь
+	if _, err := time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return nil, invalidInput("invalid cursor")
+	}
+	cursor := &storage.Cursor{CreatedAt: parts[0], ID: parts[1]}
+	if len(parts) == 3 {
+		v, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil, invalidInput("invalid cursor")
+		}
+		cursor.Value = &v
+	}
+	return cursor, nil
+}
+
+// connectionArgs приводит аргументы first/after из схемы к значениям для хранилища.
+func connectionArgs(first *int32, after *string) (int, *storage.Cursor, error) {
+	n := defaultPageLimit
+	if first != nil {
+		n = int(*first)
+	}
+	if n < 0 {
+		return 0, nil, invalidInput("first must not be negative")
+	}
+	cursor, err := decodeCursor(after)
+	if err != nil {
+		return 0, nil, err
+	}
+	return min(n, maxPageLimit), cursor, nil
+}
+
+func newPostConnection(posts []*model.Post, order model.PostOrder, hasNext bool) *model.PostConnection {
+	conn := &model.PostConnection{
+		Edges:    make([]*model.PostEdge, 0, len(posts)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNext},
+	}
+	for _, p := range posts {
+		conn.Edges = append(conn.Edges, &model.PostEdge{Cursor: encodeKey(storage.PostCursor(order, p)), Node: p})
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+	return conn
+}
+
+func newCommentConnection(comments []*model.Comment, hasNext bool) *model.CommentConnection {
+	conn := &model.CommentConnection{
+		Edges:    make([]*model.CommentEdge, 0, len(comments)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNext},
+	}
+	for _, c := range comments {
+		conn.Edges = append(conn.Edges, &model.CommentEdge{Cursor: encodeCursor(c.CreatedAt, c.ID), Node: c})
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+	return conn
+}
+
+// Выдача поиска упорядочена по релевантности, а не по (createdAt, id), поэтому
+// её курсор - позиция в выдаче: base64 от "search:N".
+const searchCursorPrefix = "search:"
+
+func encodeSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(searchCursorPrefix + strconv.Itoa(offset)))
+}
+
+// searchArgs - как connectionArgs, но after раскладывается в смещение.
+func searchArgs(first *int32, after *string) (int, int, error) {
+	n := defaultPageLimit
+	if first != nil {
+		n = int(*first)
+	}
+	if n < 0 {
+		return 0, 0, invalidInput("first must not be negative")
+	}
+	if after == nil || *after == "" {
+		return min(n, maxPageLimit), 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(*after)
+	if err != nil {
+		return 0, 0, invalidInput("invalid cursor")
+	}
+	pos, ok := strings.CutPrefix(string(raw), searchCursorPrefix)
+	offset, err := strconv.Atoi(pos)
+	if !ok || err != nil || offset < 0 {
+		return 0, 0, invalidInput("invalid cursor")
+	}
+	return min(n, maxPageLimit), offset + 1, nil
+}
+
+func newSearchConnection(hits []*storage.SearchHit, offset int, hasNext bool) *model.SearchConnection {
+	conn := &model.SearchConnection{
+		Edges:    make([]*model.SearchEdge, 0, len(hits)),
+		PageInfo: &model.PageInfo{HasNextPage: hasNext},
+	}
+	for i, h := range hits {
+		edge := &model.SearchEdge{Cursor: encodeSearchCursor(offset + i), Rank: h.Rank, Snippet: h.Snippet}
+		if h.Post != nil {
+			edge.Node = h.Post
+		} else {
+			edge.Node = h.Comment
+		}
+		conn.Edges = append(conn.Edges, edge)
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+	return conn
+}
@@ -0,0 +1,27 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrValidation помечает ошибки во входных данных запроса.
+var ErrValidation = errors.New("validation failed")
+
+// kindError сохраняет исходный текст ошибки и при этом относит её к одному
+// из видов (ErrValidation, storage.ErrConflict, ...) для errors.Is.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string { return e.msg }
+func (e *kindError) Unwrap() error { return e.kind }
+
+func newError(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+func invalidInput(format string, args ...any) error {
+	return newError(ErrValidation, format, args...)
+}
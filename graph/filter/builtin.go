@@ -0,0 +1,206 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+)
+
+// BannedWords находит запрещённые слова целиком, без учёта регистра. При
+// Rewrite слова заменяются звёздочками, иначе текст получает решение action.
+type BannedWords struct {
+	words  map[string]struct{}
+	action Action
+}
+
+func NewBannedWords(words []string, action Action) *BannedWords {
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			set[w] = struct{}{}
+		}
+	}
+	return &BannedWords{words: set, action: action}
+}
+
+// LoadBannedWords читает слова из файла: по одному на строку, пустые строки
+// и строки, начинающиеся с #, пропускаются.
+func LoadBannedWords(path string, action Action) (*BannedWords, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read banned words: %w", err)
+	}
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return NewBannedWords(words, action), nil
+}
+
+func (b *BannedWords) Check(ctx context.Context, c Content) (Verdict, error) {
+	title, inTitle := b.mask(c.Title)
+	text, inText := b.mask(c.Text)
+	if inTitle+inText == 0 {
+		return allow(c), nil
+	}
+	v := Verdict{Action: b.action, Reason: "banned words", Title: c.Title, Text: c.Text}
+	if b.action == Rewrite {
+		v.Title, v.Text = title, text
+	}
+	return v, nil
+}
+
+// mask заменяет запрещённые слова звёздочками и возвращает число замен.
+func (b *BannedWords) mask(s string) (string, int) {
+	n := 0
+	masked := wordPattern.ReplaceAllStringFunc(s, func(w string) string {
+		if _, ok := b.words[strings.ToLower(w)]; !ok {
+			return w
+		}
+		n++
+		return strings.Repeat("*", utf8.RuneCountInString(w))
+	})
+	return masked, n
+}
+
+// LinkLimit отправляет на проверку текст, в котором больше Max ссылок
+// (http://, https:// или www.).
+type LinkLimit struct {
+	Max int
+}
+
+func (l LinkLimit) Check(ctx context.Context, c Content) (Verdict, error) {
+	n := len(linkPattern.FindAllStringIndex(c.Title, -1)) + len(linkPattern.FindAllStringIndex(c.Text, -1))
+	if n <= l.Max {
+		return allow(c), nil
+	}
+	return Verdict{Action: Flag, Reason: fmt.Sprintf("too many links: %d, at most %d", n, l.Max), Title: c.Title, Text: c.Text}, nil
+}
+
+// RepeatedChars отклоняет текст с серией одинаковых символов длиннее Max,
+// например "!!!!!!!!!!" или "aaaaaaaaaa". Пробельные символы не считаются.
+type RepeatedChars struct {
+	Max int
+}
+
+func (r RepeatedChars) Check(ctx context.Context, c Content) (Verdict, error) {
+	if longestRun(c.Title) <= r.Max && longestRun(c.Text) <= r.Max {
+		return allow(c), nil
+	}
+	return Verdict{Action: Reject, Reason: fmt.Sprintf("more than %d repeated characters in a row", r.Max), Title: c.Title, Text: c.Text}, nil
+}
+
+func longestRun(s string) int {
+	longest, run := 0, 0
+	prev := rune(-1)
+	for _, ch := range s {
+		if ch == prev && !unicode.IsSpace(ch) {
+			run++
+		} else {
+			run = 1
+		}
+		prev = ch
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// Duplicates отклоняет комментарий, если автор уже писал тот же текст (без
+// учёта регистра и пробелов) в пределах окна. Тексты хранятся в памяти
+// процесса и запоминаются через Record, то есть только сохранённые
+// комментарии; посты и правки не проверяются.
+type Duplicates struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string][]seenText
+	lastSweep time.Time
+}
+
+type seenText struct {
+	text string
+	at   time.Time
+}
+
+func NewDuplicates(window time.Duration) *Duplicates {
+	return &Duplicates{window: window, now: time.Now, seen: make(map[string][]seenText)}
+}
+
+func (d *Duplicates) Check(ctx context.Context, c Content) (Verdict, error) {
+	if c.Kind != KindComment || c.Edit {
+		return allow(c), nil
+	}
+	text := normalizeDuplicate(c.Text)
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(c.AuthorID, now)
+	for _, s := range d.seen[c.AuthorID] {
+		if s.text == text {
+			return Verdict{Action: Reject, Reason: "duplicate comment", Title: c.Title, Text: c.Text}, nil
+		}
+	}
+	return allow(c), nil
+}
+
+// Record запоминает сохранённый комментарий автора.
+func (d *Duplicates) Record(ctx context.Context, c Content) {
+	if c.Kind != KindComment || c.Edit {
+		return
+	}
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweep(c.AuthorID, now)
+	d.seen[c.AuthorID] = append(d.seen[c.AuthorID], seenText{text: normalizeDuplicate(c.Text), at: now})
+}
+
+// normalizeDuplicate приводит текст к виду, в котором сравниваются повторы.
+func normalizeDuplicate(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// sweep раз в окно забывает устаревшие тексты всех авторов, иначе - только author.
+func (d *Duplicates) sweep(author string, now time.Time) {
+	if now.Sub(d.lastSweep) >= d.window {
+		for a := range d.seen {
+			d.prune(a, now)
+		}
+		d.lastSweep = now
+		return
+	}
+	d.prune(author, now)
+}
+
+// prune забывает тексты автора старше окна.
+func (d *Duplicates) prune(author string, now time.Time) {
+	var recent []seenText
+	for _, s := range d.seen[author] {
+		if now.Sub(s.at) < d.window {
+			recent = append(recent, s)
+		}
+	}
+	if len(recent) == 0 {
+		delete(d.seen, author)
+		return
+	}
+	d.seen[author] = recent
+}
@@ -0,0 +1,174 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrRejected - фильтр содержимого отклонил пост или комментарий.
+var ErrRejected = errors.New("content rejected")
+
+// Action - решение фильтра. Значения упорядочены по строгости.
+type Action int
+
+const (
+	// Allow пропускает текст без изменений.
+	Allow Action = iota
+	// Rewrite пропускает исправленный текст из Verdict.
+	Rewrite
+	// Flag пропускает текст, но отправляет его на проверку модератору.
+	Flag
+	// Reject отклоняет текст.
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Rewrite:
+		return "rewrite"
+	case Flag:
+		return "flag"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction разбирает решение из конфигурации: flag, reject или rewrite.
+func ParseAction(s string) (Action, error) {
+	for _, a := range []Action{Rewrite, Flag, Reject} {
+		if strings.EqualFold(s, a.String()) {
+			return a, nil
+		}
+	}
+	return Allow, fmt.Errorf("unknown content filter action %q", s)
+}
+
+// Kind - что проверяется: пост или комментарий.
+type Kind int
+
+const (
+	KindPost Kind = iota
+	KindComment
+)
+
+// Content - проверяемый текст. У комментария Title пустой.
+type Content struct {
+	Kind     Kind
+	AuthorID string
+	Title    string
+	Text     string
+	// Edit - правка уже сохранённого текста, а не новый пост или комментарий.
+	Edit bool
+}
+
+// Verdict - решение по тексту. Title и Text содержат текст после всех
+// исправлений, в том числе когда Action не Rewrite.
+type Verdict struct {
+	Action Action
+	// Reason объясняет решение; у Allow пусто.
+	Reason string
+	Title  string
+	Text   string
+}
+
+// ContentFilter проверяет новый или изменённый текст поста или комментария.
+type ContentFilter interface {
+	Check(ctx context.Context, c Content) (Verdict, error)
+}
+
+// Recorder - фильтр, которому нужен уже сохранённый текст, как Duplicates.
+// Record вызывается только после того, как текст записан в хранилище.
+type Recorder interface {
+	Record(ctx context.Context, c Content)
+}
+
+// allow - решение пропустить текст c без изменений.
+func allow(c Content) Verdict {
+	return Verdict{Action: Allow, Title: c.Title, Text: c.Text}
+}
+
+// Pipeline применяет фильтры по очереди: исправленный текст получают
+// следующие фильтры, а Reject прекращает проверку. Итоговое решение -
+// самое строгое из полученных, причины перечисляются через "; ".
+type Pipeline []ContentFilter
+
+func (p Pipeline) Check(ctx context.Context, c Content) (Verdict, error) {
+	result := allow(c)
+	var reasons []string
+	for _, f := range p {
+		v, err := f.Check(ctx, c)
+		if err != nil {
+			return Verdict{}, err
+		}
+		if v.Action == Reject {
+			return v, nil
+		}
+		if v.Action == Rewrite {
+			c.Title, c.Text = v.Title, v.Text
+			result.Title, result.Text = v.Title, v.Text
+		}
+		result.Action = max(result.Action, v.Action)
+		if v.Reason != "" {
+			reasons = append(reasons, v.Reason)
+		}
+	}
+	result.Reason = strings.Join(reasons, "; ")
+	return result, nil
+}
+
+// Record передаёт сохранённый текст фильтрам конвейера, которые его запоминают.
+func (p Pipeline) Record(ctx context.Context, c Content) {
+	for _, f := range p {
+		if r, ok := f.(Recorder); ok {
+			r.Record(ctx, c)
+		}
+	}
+}
+
+// Config включает встроенные фильтры; нулевое значение поля выключает фильтр.
+type Config struct {
+	// BannedWordsFile - файл запрещённых слов, по одному на строку.
+	BannedWordsFile string
+	// BannedWordsAction - что делать с запрещёнными словами; по умолчанию Rewrite.
+	BannedWordsAction Action
+	// MaxLinks - сколько ссылок допускается без проверки модератором.
+	MaxLinks int
+	// MaxRepeatedChars - наибольшая длина серии одинаковых символов.
+	MaxRepeatedChars int
+	// DuplicateWindow - в течение этого времени автор не может повторить комментарий.
+	DuplicateWindow time.Duration
+}
+
+// New собирает конвейер из включённых в cfg встроенных фильтров. Серии
+// символов проверяются до замены слов звёздочками, а повторы - последними,
+// чтобы сравнивать уже исправленный текст, который и попадёт в Record.
+func New(cfg Config) (Pipeline, error) {
+	var p Pipeline
+	if cfg.MaxRepeatedChars > 0 {
+		p = append(p, RepeatedChars{Max: cfg.MaxRepeatedChars})
+	}
+	if cfg.BannedWordsFile != "" {
+		action := cfg.BannedWordsAction
+		if action == Allow {
+			action = Rewrite
+		}
+		f, err := LoadBannedWords(cfg.BannedWordsFile, action)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, f)
+	}
+	if cfg.MaxLinks > 0 {
+		p = append(p, LinkLimit{Max: cfg.MaxLinks})
+	}
+	if cfg.DuplicateWindow > 0 {
+		p = append(p, NewDuplicates(cfg.DuplicateWindow))
+	}
+	return p, nil
+}
@@ -0,0 +1,141 @@
+package filter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilters(t *testing.T) {
+	ctx := context.Background()
+	comment := func(author, text string) Content {
+		return Content{Kind: KindComment, AuthorID: author, Text: text}
+	}
+
+	t.Run("BannedWords", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "banned.txt")
+		require.NoError(t, os.WriteFile(path, []byte("# список\nSpam\n\n  scam  \n"), 0o600))
+		f, err := LoadBannedWords(path, Rewrite)
+		require.NoError(t, err)
+
+		v, err := f.Check(ctx, Content{Kind: KindPost, Title: "No SPAM here", Text: "spammer, scam!"})
+		require.NoError(t, err)
+		assert.Equal(t, Rewrite, v.Action)
+		assert.Equal(t, "No **** here", v.Title)
+		assert.Equal(t, "spammer, ****!", v.Text)
+
+		v, err = NewBannedWords([]string{"scam"}, Reject).Check(ctx, comment("alice", "a scam"))
+		require.NoError(t, err)
+		assert.Equal(t, Reject, v.Action)
+		assert.Equal(t, "a scam", v.Text)
+
+		_, err = LoadBannedWords(filepath.Join(t.TempDir(), "missing.txt"), Rewrite)
+		assert.Error(t, err)
+	})
+
+	t.Run("LinkLimit", func(t *testing.T) {
+		f := LinkLimit{Max: 1}
+		v, err := f.Check(ctx, comment("alice", "see https://example.com"))
+		require.NoError(t, err)
+		assert.Equal(t, Allow, v.Action)
+		v, err = f.Check(ctx, comment("alice", "see https://example.com and WWW.example.org"))
+		require.NoError(t, err)
+		assert.Equal(t, Flag, v.Action)
+		assert.Equal(t, "too many links: 2, at most 1", v.Reason)
+	})
+
+	t.Run("RepeatedChars", func(t *testing.T) {
+		f := RepeatedChars{Max: 3}
+		v, err := f.Check(ctx, comment("alice", "wow!!!     ok"))
+		require.NoError(t, err)
+		assert.Equal(t, Allow, v.Action)
+		v, err = f.Check(ctx, comment("alice", "ууууу"))
+		require.NoError(t, err)
+		assert.Equal(t, Reject, v.Action)
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		f := NewDuplicates(time.Minute)
+		f.now = func() time.Time { return now }
+
+		v, _ := f.Check(ctx, comment("alice", "First!"))
+		assert.Equal(t, Allow, v.Action)
+		// Проверка сама текст не запоминает: это делает Record после сохранения
+		v, _ = f.Check(ctx, comment("alice", "First!"))
+		assert.Equal(t, Allow, v.Action)
+		f.Record(ctx, comment("alice", "First!"))
+		f.Record(ctx, comment("bob", "Hi"))
+		v, _ = f.Check(ctx, comment("alice", "  first! "))
+		assert.Equal(t, Reject, v.Action)
+		v, _ = f.Check(ctx, comment("bob", "First!"))
+		assert.Equal(t, Allow, v.Action)
+		v, _ = f.Check(ctx, Content{Kind: KindPost, AuthorID: "alice", Text: "First!"})
+		assert.Equal(t, Allow, v.Action)
+		// Правки не проверяются и не запоминаются
+		v, _ = f.Check(ctx, Content{Kind: KindComment, AuthorID: "alice", Text: "First!", Edit: true})
+		assert.Equal(t, Allow, v.Action)
+		f.Record(ctx, Content{Kind: KindComment, AuthorID: "alice", Text: "Edited", Edit: true})
+		v, _ = f.Check(ctx, comment("alice", "Edited"))
+		assert.Equal(t, Allow, v.Action)
+
+		now = now.Add(time.Minute)
+		v, _ = f.Check(ctx, comment("alice", "First!"))
+		assert.Equal(t, Allow, v.Action)
+		// Окно прошло: bob забыт при общей очистке
+		assert.NotContains(t, f.seen, "bob")
+	})
+
+	t.Run("Pipeline", func(t *testing.T) {
+		// Как в New: серии проверяются до того, как звёздочки образуют новые
+		p := Pipeline{RepeatedChars{Max: 3}, NewBannedWords([]string{"spam"}, Rewrite), LinkLimit{Max: 0}}
+		v, err := p.Check(ctx, comment("alice", "spam at www.example.com"))
+		require.NoError(t, err)
+		assert.Equal(t, Flag, v.Action)
+		assert.Equal(t, "**** at www.example.com", v.Text)
+		assert.Equal(t, "banned words; too many links: 1, at most 0", v.Reason)
+
+		v, err = p.Check(ctx, comment("alice", "spam!!!!"))
+		require.NoError(t, err)
+		assert.Equal(t, Reject, v.Action)
+
+		v, err = Pipeline{}.Check(ctx, comment("alice", "hello"))
+		require.NoError(t, err)
+		assert.Equal(t, Verdict{Action: Allow, Text: "hello"}, v)
+
+		// Record доходит до фильтров, которые запоминают тексты
+		dup := NewDuplicates(time.Minute)
+		p = Pipeline{LinkLimit{Max: 0}, dup}
+		p.Record(ctx, comment("alice", "hello"))
+		v, err = p.Check(ctx, comment("alice", "hello"))
+		require.NoError(t, err)
+		assert.Equal(t, Reject, v.Action)
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		p, err := New(Config{})
+		require.NoError(t, err)
+		assert.Empty(t, p)
+
+		path := filepath.Join(t.TempDir(), "banned.txt")
+		require.NoError(t, os.WriteFile(path, []byte("spam\n"), 0o600))
+		p, err = New(Config{BannedWordsFile: path, MaxLinks: 2, MaxRepeatedChars: 5, DuplicateWindow: time.Minute})
+		require.NoError(t, err)
+		assert.Len(t, p, 4)
+		assert.IsType(t, &Duplicates{}, p[3])
+
+		_, err = New(Config{BannedWordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+		assert.Error(t, err)
+
+		action, err := ParseAction("FLAG")
+		require.NoError(t, err)
+		assert.Equal(t, Flag, action)
+		_, err = ParseAction("allow")
+		assert.Error(t, err)
+	})
+}
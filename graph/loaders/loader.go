@@ -0,0 +1,76 @@
+package loaders
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchFunc загружает значения сразу для набора ключей. Отсутствующий в
+// результате ключ считается пустым значением, а не ошибкой.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader собирает ключи, запрошенные конкурентными резолверами в пределах
+// короткого окна, и выполняет по ним один вызов BatchFunc. Результаты не
+// кэшируются: загрузчик живёт столько же, сколько соединение, а для
+// websocket-подписок это может быть очень долго.
+type Loader[K comparable, V any] struct {
+	fetch BatchFunc[K, V]
+	wait  time.Duration
+
+	mu  sync.Mutex
+	cur *batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	keys []K
+	seen map[K]struct{}
+	done chan struct{}
+	res  map[K]V
+	err  error
+}
+
+func NewLoader[K comparable, V any](fetch BatchFunc[K, V], wait time.Duration) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, wait: wait}
+}
+
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	b := l.cur
+	if b == nil {
+		b = &batch[K, V]{
+			seen: make(map[K]struct{}),
+			done: make(chan struct{}),
+		}
+		l.cur = b
+		// Пакет переживает отмену запроса, который его открыл: в нём
+		// могут ждать ключи других резолверов.
+		go l.run(context.WithoutCancel(ctx), b)
+	}
+	if _, ok := b.seen[key]; !ok {
+		b.seen[key] = struct{}{}
+		b.keys = append(b.keys, key)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.res[key], b.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *Loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	time.Sleep(l.wait)
+
+	l.mu.Lock()
+	if l.cur == b {
+		l.cur = nil
+	}
+	l.mu.Unlock()
+
+	b.res, b.err = l.fetch(ctx, b.keys)
+	close(b.done)
+}
@@ -0,0 +1,92 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("BatchesConcurrentLoads", func(t *testing.T) {
+		var calls atomic.Int32
+		var gotKeys []int
+		l := NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+			calls.Add(1)
+			gotKeys = keys
+			res := make(map[int]string, len(keys))
+			for _, k := range keys {
+				res[k] = fmt.Sprintf("v%d", k)
+			}
+			return res, nil
+		}, 10*time.Millisecond)
+
+		var wg sync.WaitGroup
+		results := make([]string, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				// Ключи повторяются, чтобы проверить дедупликацию
+				v, err := l.Load(ctx, i%5)
+				assert.NoError(t, err)
+				results[i] = v
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Len(t, gotKeys, 5)
+		for i, v := range results {
+			assert.Equal(t, fmt.Sprintf("v%d", i%5), v)
+		}
+	})
+
+	t.Run("NewBatchAfterDispatch", func(t *testing.T) {
+		var calls atomic.Int32
+		l := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+			calls.Add(1)
+			return map[int]int{keys[0]: keys[0]}, nil
+		}, time.Millisecond)
+
+		v, err := l.Load(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v)
+		v, err = l.Load(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, v)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("MissingKeyAndError", func(t *testing.T) {
+		l := NewLoader(func(ctx context.Context, keys []int) (map[int][]string, error) {
+			return nil, nil
+		}, time.Millisecond)
+		v, err := l.Load(ctx, 42)
+		assert.NoError(t, err)
+		assert.Nil(t, v)
+
+		failing := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+			return nil, errors.New("boom")
+		}, time.Millisecond)
+		_, err = failing.Load(ctx, 1)
+		assert.EqualError(t, err, "boom")
+	})
+
+	t.Run("CanceledContext", func(t *testing.T) {
+		l := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+			return map[int]int{}, nil
+		}, 50*time.Millisecond)
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := l.Load(cctx, 1)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
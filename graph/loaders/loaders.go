@@ -0,0 +1,159 @@
+package loaders
+
+import (
+	"context"
+	"net/http"
+	"post-comment-app/graph/model"
+	"post-comment-app/storage"
+	"time"
+)
+
+type ctxKey struct{}
+
+// Окно, в течение которого резолверы одного уровня успевают добавить свои ключи.
+const defaultWait = 2 * time.Millisecond
+
+// PageKey идентифицирует страницу дочерних комментариев одного родителя.
+type PageKey struct {
+	ID     string
+	Order  model.CommentOrder
+	Limit  int
+	Offset int
+	// Visibility - какие скрытые комментарии видит пользователь запроса.
+	Visibility storage.Visibility
+}
+
+// VisibleKey - комментарий и видимость скрытых комментариев для пользователя запроса.
+type VisibleKey struct {
+	ID         string
+	Visibility storage.Visibility
+}
+
+// ReactionKey - реакции объекта для пользователя Viewer, от которого зависит viewerReacted.
+type ReactionKey struct {
+	ID     string
+	Viewer string
+}
+
+type Loaders struct {
+	CommentsByPost   *Loader[PageKey, []*model.Comment]
+	RepliesByComment *Loader[PageKey, []*model.Comment]
+	TagsByPost       *Loader[string, []string]
+	UsersByID        *Loader[string, *model.User]
+	// EditCountByComment - число правок комментария.
+	EditCountByComment *Loader[string, int]
+	ReactionsByPost    *Loader[ReactionKey, []*model.Reaction]
+	ReactionsByComment *Loader[ReactionKey, []*model.Reaction]
+	// AncestorsByComment и DescendantCountByComment - видимые предки и число
+	// видимых потомков комментария.
+	AncestorsByComment       *Loader[VisibleKey, []*model.Comment]
+	DescendantCountByComment *Loader[VisibleKey, int]
+}
+
+func New(store storage.Storage) *Loaders {
+	return &Loaders{
+		CommentsByPost:           NewLoader(pagedFetch(store.GetCommentsByPostIDs), defaultWait),
+		RepliesByComment:         NewLoader(pagedFetch(store.GetRepliesByCommentIDs), defaultWait),
+		TagsByPost:               NewLoader(store.GetTagsByPostIDs, defaultWait),
+		UsersByID:                NewLoader(store.GetUsersByIDs, defaultWait),
+		EditCountByComment:       NewLoader(store.CountCommentRevisions, defaultWait),
+		ReactionsByPost:          NewLoader(reactionsFetch(store, storage.TargetPost), defaultWait),
+		ReactionsByComment:       NewLoader(reactionsFetch(store, storage.TargetComment), defaultWait),
+		AncestorsByComment:       NewLoader(visibleFetch(store.GetCommentAncestorsByIDs), defaultWait),
+		DescendantCountByComment: NewLoader(visibleFetch(store.CountDescendantsByIDs), defaultWait),
+	}
+}
+
+// Middleware кладёт в контекст запроса свежий набор загрузчиков.
+func Middleware(store storage.Storage, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxKey{}, New(store))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// For возвращает загрузчики текущего запроса или nil, если middleware не подключён.
+func For(ctx context.Context) *Loaders {
+	l, _ := ctx.Value(ctxKey{}).(*Loaders)
+	return l
+}
+
+type pagedBatchFunc func(ctx context.Context, ids []string, order model.CommentOrder, limit, offset int, visibility storage.Visibility) (map[string][]*model.Comment, error)
+
+// pagedFetch группирует ключи по параметрам страницы, так что на уровень
+// дерева с одинаковыми порядком и limit/offset приходится ровно один запрос к хранилищу.
+func pagedFetch(fetch pagedBatchFunc) BatchFunc[PageKey, []*model.Comment] {
+	return func(ctx context.Context, keys []PageKey) (map[PageKey][]*model.Comment, error) {
+		type page struct {
+			order         model.CommentOrder
+			limit, offset int
+			visibility    storage.Visibility
+		}
+		groups := make(map[page][]string)
+		var order []page
+		for _, k := range keys {
+			p := page{k.Order, k.Limit, k.Offset, k.Visibility}
+			if _, ok := groups[p]; !ok {
+				order = append(order, p)
+			}
+			groups[p] = append(groups[p], k.ID)
+		}
+
+		res := make(map[PageKey][]*model.Comment, len(keys))
+		for _, p := range order {
+			byID, err := fetch(ctx, groups[p], p.order, p.limit, p.offset, p.visibility)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range groups[p] {
+				res[PageKey{ID: id, Order: p.order, Limit: p.limit, Offset: p.offset, Visibility: p.visibility}] = byID[id]
+			}
+		}
+		return res, nil
+	}
+}
+
+// reactionsFetch загружает реакции объектов kind, по запросу на каждого пользователя в пакете.
+func reactionsFetch(store storage.Storage, kind storage.TargetKind) BatchFunc[ReactionKey, []*model.Reaction] {
+	return groupedFetch(func(k ReactionKey) (string, string) { return k.ID, k.Viewer },
+		func(ctx context.Context, ids []string, viewer string) (map[string][]*model.Reaction, error) {
+			return store.GetReactionsByTargetIDs(ctx, kind, ids, viewer)
+		})
+}
+
+// visibleFetch загружает значения по комментариям, по запросу на каждую видимость в пакете.
+func visibleFetch[V any](fetch func(ctx context.Context, ids []string, visibility storage.Visibility) (map[string]V, error)) BatchFunc[VisibleKey, V] {
+	return groupedFetch(func(k VisibleKey) (string, storage.Visibility) { return k.ID, k.Visibility }, fetch)
+}
+
+// groupedFetch делит ключи на ID и общий параметр вроде пользователя запроса
+// и выполняет по одному вызову fetch на каждое значение параметра.
+func groupedFetch[K, P comparable, V any](split func(K) (string, P), fetch func(ctx context.Context, ids []string, param P) (map[string]V, error)) BatchFunc[K, V] {
+	return func(ctx context.Context, keys []K) (map[K]V, error) {
+		groups := make(map[P][]K)
+		var params []P
+		for _, k := range keys {
+			_, p := split(k)
+			if _, ok := groups[p]; !ok {
+				params = append(params, p)
+			}
+			groups[p] = append(groups[p], k)
+		}
+
+		res := make(map[K]V, len(keys))
+		for _, p := range params {
+			ids := make([]string, len(groups[p]))
+			for i, k := range groups[p] {
+				ids[i], _ = split(k)
+			}
+			byID, err := fetch(ctx, ids, p)
+			if err != nil {
+				return nil, err
+			}
+			for i, k := range groups[p] {
+				res[k] = byID[ids[i]]
+			}
+		}
+		return res, nil
+	}
+}
@@ -2,31 +2,578 @@
 
 package model
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type SearchResult interface {
+	IsSearchResult()
+}
+
 type Comment struct {
-	ID        string     `json:"id"`
-	PostID    string     `json:"postID"`
-	ParentID  *string    `json:"parentID,omitempty"`
-	Author    string     `json:"author"`
-	Text      string     `json:"text"`
-	CreatedAt string     `json:"createdAt"`
+	ID       string  `json:"id"`
+	PostID   string  `json:"postID"`
+	ParentID *string `json:"parentID,omitempty"`
+	// Автор; у удалённого комментария null.
+	Author    *User   `json:"author,omitempty"`
+	Text      string  `json:"text"`
+	CreatedAt string  `json:"createdAt"`
+	EditedAt  *string `json:"editedAt,omitempty"`
+	// Время удаления. У удалённого комментария author и text скрыты, а ответы остаются доступны.
+	DeletedAt *string `json:"deletedAt,omitempty"`
+	IsDeleted bool    `json:"isDeleted"`
+	// Ветка заблокирована: новые ответы на этот комментарий и его потомков запрещены.
+	Locked bool `json:"locked"`
+	// Состояние модерации. Скрытые и отклонённые комментарии видят только модераторы,
+	// ожидающие проверки - ещё и их автор.
+	Status CommentStatus `json:"status"`
+	// Жалобы на комментарий от старых к новым.
+	Reports []*CommentReport `json:"reports"`
+	// Уровень вложенности: 0 у комментария к посту, у ответа - на 1 больше, чем у родителя.
+	Depth int32 `json:"depth"`
+	// Цепочка родителей от комментария верхнего уровня до непосредственного родителя.
+	// Скрытые от пользователя родители пропускаются по тем же правилам, что в comments и replies.
+	Ancestors []*Comment `json:"ancestors"`
+	// Число видимых пользователю запроса потомков на любой глубине, включая удалённые.
+	DescendantCount int32 `json:"descendantCount"`
+	// Число неудалённых прямых ответов, видимых читателям.
+	ReplyCount int32 `json:"replyCount"`
+	// Сумма голосов: за минус против.
+	Score int32 `json:"score"`
+	// Реакции по убыванию числа поставивших; viewerReacted считается для пользователя из токена.
+	Reactions []*Reaction `json:"reactions"`
+	// Прежние версии текста от старых к новым, только для модераторов. Для удалённого комментария пусто.
+	Revisions []*CommentRevision `json:"revisions"`
+	// Число правок. Для удалённого комментария 0.
+	EditCount int32      `json:"editCount"`
 	Replies   []*Comment `json:"replies"`
+	// Ответы от старых к новым, курсорная пагинация по (createdAt, id).
+	RepliesConnection *CommentConnection `json:"repliesConnection"`
+	// Поддерево с этим комментарием в корне (depth 0); ограничения как у Post.commentTree.
+	Subtree  *CommentTreeNode `json:"subtree"`
+	AuthorID string           `json:"-"`
+	// Комментарий хотя бы раз был виден читателям.
+	Published bool `json:"-"`
+}
+
+func (Comment) IsSearchResult() {}
+
+type CommentConnection struct {
+	Edges    []*CommentEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type CommentEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Comment `json:"node"`
+}
+
+type CommentReport struct {
+	Reporter   *User  `json:"reporter"`
+	Reason     string `json:"reason"`
+	CreatedAt  string `json:"createdAt"`
+	ReporterID string `json:"-"`
+}
+
+// Текст комментария до правки, сделанной editor в момент editedAt.
+type CommentRevision struct {
+	Text     string `json:"text"`
+	Editor   *User  `json:"editor"`
+	EditedAt string `json:"editedAt"`
+	EditorID string `json:"-"`
+}
+
+type CommentTreeNode struct {
+	Comment *Comment `json:"comment"`
+	// Глубина относительно корня запроса.
+	Depth int32 `json:"depth"`
+	// Число прямых ответов, видимых пользователю запроса, включая удалённые. Скрытые от него ответы не считаются, поэтому replyCount больше длины children, только если ветку обрезали maxDepth или limitPerLevel. Может отличаться от Comment.replyCount, который считает неудалённые ответы, видимые читателям.
+	ReplyCount int32              `json:"replyCount"`
+	Children   []*CommentTreeNode `json:"children"`
 }
 
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
 type Post struct {
-	ID            string     `json:"id"`
-	Title         string     `json:"title"`
-	Content       string     `json:"content"`
-	Author        string     `json:"author"`
-	AllowComments bool       `json:"allowComments"`
-	CreatedAt     string     `json:"createdAt"`
-	Comments      []*Comment `json:"comments"`
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Author  *User  `json:"author"`
+	// Как принимаются новые комментарии.
+	ModerationMode ModerationMode `json:"moderationMode"`
+	AllowComments  bool           `json:"allowComments"`
+	CreatedAt      string         `json:"createdAt"`
+	UpdatedAt      *string        `json:"updatedAt,omitempty"`
+	// Число неудалённых комментариев к посту на любой глубине, видимых читателям (без PENDING, HIDDEN и REJECTED).
+	CommentCount int32 `json:"commentCount"`
+	// Число неудалённых комментариев верхнего уровня, видимых читателям.
+	TopLevelCommentCount int32 `json:"topLevelCommentCount"`
+	// Сумма голосов: за минус против.
+	Score int32 `json:"score"`
+	// Теги поста в нижнем регистре, по алфавиту.
+	Tags []string `json:"tags"`
+	// Реакции по убыванию числа поставивших; viewerReacted считается для пользователя из токена.
+	Reactions []*Reaction `json:"reactions"`
+	Comments  []*Comment  `json:"comments"`
+	// Комментарии верхнего уровня от старых к новым, курсорная пагинация по (createdAt, id).
+	CommentsConnection *CommentConnection `json:"commentsConnection"`
+	// Дерево комментариев одним запросом: комментарии верхнего уровня имеют depth 0,
+	// загружаются узлы с depth <= maxDepth, у каждого родителя не больше limitPerLevel
+	// детей (от старых к новым).
+	CommentTree []*CommentTreeNode `json:"commentTree"`
+	AuthorID    string             `json:"-"`
+}
+
+func (Post) IsSearchResult() {}
+
+type PostConnection struct {
+	Edges    []*PostEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type PostEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Post  `json:"node"`
+}
+
+// Условия фильтра объединяются через И. Границы createdAfter и createdBefore (RFC 3339) не включаются.
+type PostFilter struct {
+	AuthorID      *string `json:"authorID,omitempty"`
+	CreatedAfter  *string `json:"createdAfter,omitempty"`
+	CreatedBefore *string `json:"createdBefore,omitempty"`
+	// Посты, к которым можно комментировать, то есть не в режиме CLOSED.
+	AllowComments  *bool           `json:"allowComments,omitempty"`
+	ModerationMode *ModerationMode `json:"moderationMode,omitempty"`
+	// Посты с этим тегом; регистр не важен.
+	Tag *string `json:"tag,omitempty"`
 }
 
 type Query struct {
 }
 
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	// Сколько пользователей поставили эту реакцию.
+	Count int32 `json:"count"`
+	// Поставил ли реакцию пользователь из токена; для анонимного запроса false.
+	ViewerReacted bool `json:"viewerReacted"`
+}
+
+type SearchConnection struct {
+	Edges    []*SearchEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type SearchEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   SearchResult `json:"node"`
+	// Релевантность: чем больше, тем выше в выдаче.
+	Rank float64 `json:"rank"`
+	// Фрагмент текста, совпадения выделены <b>...</b>. Остальной текст экранирован как HTML.
+	Snippet string `json:"snippet"`
+}
+
 type Subscription struct {
 }
+
+type Tag struct {
+	Name string `json:"name"`
+	// Число постов с этим тегом.
+	PostCount int32 `json:"postCount"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	CreatedAt   string `json:"createdAt"`
+	// Посты пользователя от новых к старым.
+	Posts *PostConnection `json:"posts"`
+	// Неудалённые комментарии пользователя от новых к старым.
+	Comments *CommentConnection `json:"comments"`
+}
+
+// Порядок комментариев и ответов. При равенстве ключа - от старых к новым.
+type CommentOrder string
+
+const (
+	CommentOrderNewest CommentOrder = "NEWEST"
+	CommentOrderOldest CommentOrder = "OLDEST"
+	// По разнице голосов за и против.
+	CommentOrderTop CommentOrder = "TOP"
+	// По числу неудалённых прямых ответов.
+	CommentOrderMostReplies CommentOrder = "MOST_REPLIES"
+	// Сначала комментарии, где голосов за и против много и поровну: по меньшему из двух чисел, затем по их сумме.
+	CommentOrderControversial CommentOrder = "CONTROVERSIAL"
+)
+
+var AllCommentOrder = []CommentOrder{
+	CommentOrderNewest,
+	CommentOrderOldest,
+	CommentOrderTop,
+	CommentOrderMostReplies,
+	CommentOrderControversial,
+}
+
+func (e CommentOrder) IsValid() bool {
+	switch e {
+	case CommentOrderNewest, CommentOrderOldest, CommentOrderTop, CommentOrderMostReplies, CommentOrderControversial:
+		return true
+	}
+	return false
+}
+
+func (e CommentOrder) String() string {
+	return string(e)
+}
+
+func (e *CommentOrder) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CommentOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CommentOrder", str)
+	}
+	return nil
+}
+
+func (e CommentOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *CommentOrder) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e CommentOrder) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Состояние модерации комментария. Жалоба переводит опубликованный комментарий
+// в REPORTED; модератор одобряет (APPROVED), скрывает (HIDDEN) или отклоняет
+// (REJECTED) его. Отклонение окончательно, скрытый комментарий можно одобрить.
+// Комментарий к посту в режиме PREMODERATED создаётся в PENDING.
+type CommentStatus string
+
+const (
+	CommentStatusPublished CommentStatus = "PUBLISHED"
+	// Ждёт одобрения модератора; до этого виден только модераторам и автору.
+	CommentStatusPending CommentStatus = "PENDING"
+	// На комментарий пожаловались, он ждёт решения модератора и пока виден всем.
+	CommentStatusReported CommentStatus = "REPORTED"
+	// Модератор оставил комментарий; новые жалобы его статус не меняют.
+	CommentStatusApproved CommentStatus = "APPROVED"
+	CommentStatusHidden   CommentStatus = "HIDDEN"
+	CommentStatusRejected CommentStatus = "REJECTED"
+)
+
+var AllCommentStatus = []CommentStatus{
+	CommentStatusPublished,
+	CommentStatusPending,
+	CommentStatusReported,
+	CommentStatusApproved,
+	CommentStatusHidden,
+	CommentStatusRejected,
+}
+
+func (e CommentStatus) IsValid() bool {
+	switch e {
+	case CommentStatusPublished, CommentStatusPending, CommentStatusReported, CommentStatusApproved, CommentStatusHidden, CommentStatusRejected:
+		return true
+	}
+	return false
+}
+
+func (e CommentStatus) String() string {
+	return string(e)
+}
+
+func (e *CommentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CommentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CommentStatus", str)
+	}
+	return nil
+}
+
+func (e CommentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *CommentStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e CommentStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Режим приёма комментариев к посту.
+type ModerationMode string
+
+const (
+	// Комментарии публикуются сразу.
+	ModerationModeOpen ModerationMode = "OPEN"
+	// Комментарии публикуются после одобрения модератором.
+	ModerationModePremoderated ModerationMode = "PREMODERATED"
+	// Новые комментарии запрещены.
+	ModerationModeClosed ModerationMode = "CLOSED"
+)
+
+var AllModerationMode = []ModerationMode{
+	ModerationModeOpen,
+	ModerationModePremoderated,
+	ModerationModeClosed,
+}
+
+func (e ModerationMode) IsValid() bool {
+	switch e {
+	case ModerationModeOpen, ModerationModePremoderated, ModerationModeClosed:
+		return true
+	}
+	return false
+}
+
+func (e ModerationMode) String() string {
+	return string(e)
+}
+
+func (e *ModerationMode) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ModerationMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ModerationMode", str)
+	}
+	return nil
+}
+
+func (e ModerationMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ModerationMode) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ModerationMode) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Порядок ленты постов. При равенстве ключа - от новых к старым.
+type PostOrder string
+
+const (
+	PostOrderNewest PostOrder = "NEWEST"
+	PostOrderOldest PostOrder = "OLDEST"
+	// По разнице голосов за и против.
+	PostOrderTop PostOrder = "TOP"
+	// По числу неудалённых комментариев.
+	PostOrderMostCommented PostOrder = "MOST_COMMENTED"
+)
+
+var AllPostOrder = []PostOrder{
+	PostOrderNewest,
+	PostOrderOldest,
+	PostOrderTop,
+	PostOrderMostCommented,
+}
+
+func (e PostOrder) IsValid() bool {
+	switch e {
+	case PostOrderNewest, PostOrderOldest, PostOrderTop, PostOrderMostCommented:
+		return true
+	}
+	return false
+}
+
+func (e PostOrder) String() string {
+	return string(e)
+}
+
+func (e *PostOrder) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PostOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PostOrder", str)
+	}
+	return nil
+}
+
+func (e PostOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *PostOrder) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e PostOrder) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+// Роли из claim role токена, по возрастанию прав: каждая следующая включает права предыдущих.
+type Role string
+
+const (
+	// Комментирует и управляет своими комментариями. Роль по умолчанию.
+	RoleReader Role = "READER"
+	// Кроме того, пишет посты и управляет своими постами.
+	RoleAuthor Role = "AUTHOR"
+	// Кроме того, правит и удаляет чужие посты и комментарии, блокирует ветки.
+	RoleModerator Role = "MODERATOR"
+	// Кроме того, заводит пользователей.
+	RoleAdmin Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleReader,
+	RoleAuthor,
+	RoleModerator,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleReader, RoleAuthor, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Role) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Role) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type SearchType string
+
+const (
+	SearchTypePost    SearchType = "POST"
+	SearchTypeComment SearchType = "COMMENT"
+)
+
+var AllSearchType = []SearchType{
+	SearchTypePost,
+	SearchTypeComment,
+}
+
+func (e SearchType) IsValid() bool {
+	switch e {
+	case SearchTypePost, SearchTypeComment:
+		return true
+	}
+	return false
+}
+
+func (e SearchType) String() string {
+	return string(e)
+}
+
+func (e *SearchType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchType", str)
+	}
+	return nil
+}
+
+func (e SearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *SearchType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e SearchType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит корзины в памяти процесса: лимит действует отдельно
+// на каждом экземпляре сервера.
+type MemoryStore struct {
+	idle time.Duration
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewMemoryStore забывает корзины, не менявшиеся дольше idle: к этому времени
+// они снова полны. Нулевой idle хранит корзины без ограничения.
+func NewMemoryStore(idle time.Duration) *MemoryStore {
+	return &MemoryStore{idle: idle, now: time.Now, buckets: make(map[string]bucket)}
+}
+
+func (m *MemoryStore) UpdateRateBucket(ctx context.Context, key string, fn func(tokens float64, updatedAt, now time.Time) float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if m.idle > 0 && now.Sub(m.lastSweep) >= m.idle {
+		for k, b := range m.buckets {
+			if now.Sub(b.updatedAt) >= m.idle {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	b := m.buckets[key]
+	m.buckets[key] = bucket{tokens: fn(b.tokens, b.updatedAt, now), updatedAt: now}
+	return nil
+}
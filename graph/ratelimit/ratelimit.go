@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"post-comment-app/graph/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLimited - лимит запросов исчерпан.
+var ErrLimited = errors.New("rate limit exceeded")
+
+// Error сообщает, через сколько можно повторить отклонённую мутацию.
+type Error struct {
+	Field      string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s", e.Field)
+}
+
+func (e *Error) Unwrap() error { return ErrLimited }
+
+// RetryAfterSeconds округляет RetryAfter вверх до целых секунд, не меньше 1.
+func (e *Error) RetryAfterSeconds() int {
+	return max(1, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Limit - корзина на Burst токенов, которая равномерно наполняется за Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit разбирает лимит вида "20/1m": 20 запросов подряд, затем 20 в минуту.
+func ParseLimit(s string) (Limit, error) {
+	n, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 20/1m", s)
+	}
+	burst, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil || burst < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid number of requests", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid period", s)
+	}
+	return Limit{Burst: burst, Period: d}, nil
+}
+
+// LongestPeriod - время, за которое наполняется любая из корзин limits.
+func LongestPeriod(limits map[string]Limit) time.Duration {
+	var longest time.Duration
+	for _, l := range limits {
+		longest = max(longest, l.Period)
+	}
+	return longest
+}
+
+// Store хранит корзины токенов.
+type Store interface {
+	// UpdateRateBucket атомарно пересчитывает корзину key: fn получает число
+	// токенов, время прошлого обновления (нулевое у новой корзины) и текущее
+	// время и возвращает новое число токенов.
+	UpdateRateBucket(ctx context.Context, key string, fn func(tokens float64, updatedAt, now time.Time) float64) error
+}
+
+// Limiter ограничивает частоту мутаций отдельно для каждого пользователя,
+// а для анонимных запросов - для каждого IP.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+// NewLimiter ограничивает мутации из limits (по имени поля схемы); остальные
+// мутации не ограничиваются.
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// Allow забирает токен мутации field. Если токенов нет, возвращает *Error.
+func (l *Limiter) Allow(ctx context.Context, field string) error {
+	limit, ok := l.limits[field]
+	if !ok {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	rate := burst / limit.Period.Seconds()
+
+	var wait time.Duration
+	err := l.store.UpdateRateBucket(ctx, field+":"+subject(ctx), func(tokens float64, updatedAt, now time.Time) float64 {
+		if updatedAt.IsZero() {
+			tokens = burst
+		} else {
+			// Отрицательный промежуток (часы хранилища сдвинулись назад) не отнимает токены
+			tokens = min(burst, tokens+max(0, now.Sub(updatedAt).Seconds())*rate)
+		}
+		if tokens >= 1 {
+			wait = 0
+			return tokens - 1
+		}
+		wait = time.Duration((1 - tokens) / rate * float64(time.Second))
+		return tokens
+	})
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &Error{Field: field, RetryAfter: wait}
+	}
+	return nil
+}
+
+// subject - чей лимит расходует запрос: пользователя из токена или IP клиента.
+func subject(ctx context.Context) string {
+	if p := auth.For(ctx); p != nil {
+		return "user:" + p.UserID
+	}
+	return "ip:" + ClientIP(ctx)
+}
+
+type ctxKey struct{}
+
+// Middleware кладёт в контекст IP клиента. С trustForwarded IP берётся из
+// первого адреса X-Forwarded-For: включайте его, только если сервер стоит за
+// прокси, который этот заголовок перезаписывает.
+func Middleware(trustForwarded bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := remoteIP(r.RemoteAddr)
+		if trustForwarded {
+			if first, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ","); strings.TrimSpace(first) != "" {
+				ip = strings.TrimSpace(first)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, ip)))
+	})
+}
+
+// ClientIP возвращает IP клиента или пустую строку, если middleware не подключён.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+	return ip
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
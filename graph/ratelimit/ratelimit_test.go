@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"post-comment-app/graph/auth"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	newStore := func() *MemoryStore {
+		store := NewMemoryStore(time.Hour)
+		store.now = func() time.Time { return now }
+		return store
+	}
+	alice := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "alice"})
+
+	t.Run("TokenBucket", func(t *testing.T) {
+		l := NewLimiter(newStore(), map[string]Limit{"addComment": {Burst: 2, Period: time.Minute}})
+		require.NoError(t, l.Allow(alice, "addComment"))
+		require.NoError(t, l.Allow(alice, "addComment"))
+
+		err := l.Allow(alice, "addComment")
+		var limited *Error
+		require.ErrorAs(t, err, &limited)
+		assert.ErrorIs(t, err, ErrLimited)
+		assert.Equal(t, "addComment", limited.Field)
+		// Токен возвращается каждые 30 секунд
+		assert.Equal(t, 30*time.Second, limited.RetryAfter)
+		assert.Equal(t, 30, limited.RetryAfterSeconds())
+
+		now = now.Add(20 * time.Second)
+		err = l.Allow(alice, "addComment")
+		require.ErrorAs(t, err, &limited)
+		assert.Equal(t, 10*time.Second, limited.RetryAfter)
+
+		now = now.Add(10 * time.Second)
+		assert.NoError(t, l.Allow(alice, "addComment"))
+
+		// Время из хранилища сдвинулось назад: токены не отнимаются
+		store := &fixedStore{tokens: 1, updatedAt: now, now: now.Add(-time.Minute)}
+		require.NoError(t, NewLimiter(store, map[string]Limit{"addComment": {Burst: 2, Period: time.Minute}}).Allow(alice, "addComment"))
+		assert.Zero(t, store.tokens)
+		// Мутации без лимита не ограничиваются
+		assert.NoError(t, l.Allow(alice, "createPost"))
+	})
+
+	t.Run("Subjects", func(t *testing.T) {
+		l := NewLimiter(newStore(), map[string]Limit{"addComment": {Burst: 1, Period: time.Minute}, "createPost": {Burst: 1, Period: time.Minute}})
+		require.NoError(t, l.Allow(alice, "addComment"))
+		assert.Error(t, l.Allow(alice, "addComment"))
+		assert.NoError(t, l.Allow(alice, "createPost"), "each mutation has its own bucket")
+
+		bob := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "bob"})
+		assert.NoError(t, l.Allow(bob, "addComment"))
+
+		var anon1, anon2 context.Context
+		handler := func(dst *context.Context) http.Handler {
+			return Middleware(false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { *dst = r.Context() }))
+		}
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		handler(&anon1).ServeHTTP(httptest.NewRecorder(), req)
+		req.RemoteAddr = "10.0.0.2:1234"
+		handler(&anon2).ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, "10.0.0.1", ClientIP(anon1))
+		assert.NoError(t, l.Allow(anon1, "addComment"))
+		assert.Error(t, l.Allow(anon1, "addComment"))
+		assert.NoError(t, l.Allow(anon2, "addComment"))
+	})
+
+	t.Run("ForwardedFor", func(t *testing.T) {
+		var ip string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ip = ClientIP(r.Context()) })
+		req := httptest.NewRequest(http.MethodPost, "/query", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+		Middleware(false, next).ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, "10.0.0.1", ip)
+		Middleware(true, next).ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, "203.0.113.7", ip)
+	})
+
+	t.Run("MemoryStoreSweep", func(t *testing.T) {
+		store := newStore()
+		l := NewLimiter(store, map[string]Limit{"addComment": {Burst: 1, Period: time.Minute}})
+		require.NoError(t, l.Allow(alice, "addComment"))
+		assert.Len(t, store.buckets, 1)
+
+		now = now.Add(time.Hour)
+		bob := auth.WithPrincipal(context.Background(), &auth.Principal{UserID: "bob"})
+		require.NoError(t, l.Allow(bob, "addComment"))
+		assert.NotContains(t, store.buckets, "addComment:user:alice")
+		assert.Len(t, store.buckets, 1)
+	})
+
+	t.Run("ParseLimit", func(t *testing.T) {
+		l, err := ParseLimit("20/1m")
+		require.NoError(t, err)
+		assert.Equal(t, Limit{Burst: 20, Period: time.Minute}, l)
+		for _, s := range []string{"20", "0/1m", "x/1m", "20/0s", "20/soon"} {
+			_, err := ParseLimit(s)
+			assert.Error(t, err, s)
+		}
+		assert.Equal(t, time.Hour, LongestPeriod(map[string]Limit{"a": {1, time.Minute}, "b": {1, time.Hour}}))
+		assert.Equal(t, 1, (&Error{RetryAfter: 10 * time.Millisecond}).RetryAfterSeconds())
+	})
+}
+
+// fixedStore - корзина с заданным состоянием и временем хранилища.
+type fixedStore struct {
+	tokens         float64
+	updatedAt, now time.Time
+}
+
+func (f *fixedStore) UpdateRateBucket(ctx context.Context, key string, fn func(tokens float64, updatedAt, now time.Time) float64) error {
+	f.tokens = fn(f.tokens, f.updatedAt, f.now)
+	return nil
+}
@@ -1,20 +1,403 @@
 package graph
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"post-comment-app/graph/auth"
+	"post-comment-app/graph/filter"
+	"post-comment-app/graph/loaders"
 	"post-comment-app/graph/model"
+	"post-comment-app/graph/ratelimit"
 	"post-comment-app/storage"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/99designs/gqlgen/graphql"
 )
 
 type Resolver struct {
 	storage     storage.Storage
 	subscribers map[string][]chan *model.Comment
 	mu          sync.RWMutex
+	// Наибольшая допустимая глубина ответа (у комментария к посту 0).
+	maxCommentDepth int
+	contentFilter   filter.ContentFilter
+	// nil - мутации не ограничиваются.
+	limiter *ratelimit.Limiter
 }
 
 func NewResolver(store storage.Storage) *Resolver {
 	return &Resolver{
-		storage:     store,
-		subscribers: make(map[string][]chan *model.Comment),
+		storage:         store,
+		subscribers:     make(map[string][]chan *model.Comment),
+		maxCommentDepth: DefaultMaxCommentDepth,
+		contentFilter:   filter.Pipeline{},
+	}
+}
+
+// NewConfig собирает конфигурацию исполняемой схемы: резолверы и директивы.
+func NewConfig(r *Resolver) Config {
+	return Config{Resolvers: r, Directives: DirectiveRoot{HasRole: hasRole, RateLimit: r.rateLimit}}
+}
+
+// hasRole реализует директиву @hasRole.
+func hasRole(ctx context.Context, obj any, next graphql.Resolver, role model.Role) (any, error) {
+	if _, err := auth.Require(ctx, role); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// rateLimit реализует директиву @rateLimit.
+func (r *Resolver) rateLimit(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	if r.limiter != nil {
+		if err := r.limiter.Allow(ctx, graphql.GetFieldContext(ctx).Field.Name); err != nil {
+			return nil, err
+		}
+	}
+	return next(ctx)
+}
+
+// checkOwner разрешает менять пост или комментарий только его автору и модераторам.
+func checkOwner(ctx context.Context, ownerID, what string) error {
+	principal := auth.For(ctx)
+	if principal == nil {
+		return auth.ErrUnauthenticated
+	}
+	if principal.UserID != ownerID && !principal.HasRole(model.RoleModerator) {
+		return newError(auth.ErrForbidden, "only the author or a moderator can change this %s", what)
+	}
+	return nil
+}
+
+// visibility возвращает, какие скрытые комментарии видит пользователь запроса:
+// модератор - все, остальные - свои комментарии, ожидающие проверки.
+func visibility(ctx context.Context) storage.Visibility {
+	principal := auth.For(ctx)
+	if principal == nil {
+		return storage.Visibility{}
+	}
+	return storage.Visibility{All: principal.HasRole(model.RoleModerator), AuthorID: principal.UserID}
+}
+
+// SetMaxCommentDepth меняет ограничение вложенности для новых ответов.
+func (r *Resolver) SetMaxCommentDepth(depth int) {
+	r.maxCommentDepth = depth
+}
+
+// SetContentFilter задаёт проверку текста новых и изменённых постов и комментариев.
+func (r *Resolver) SetContentFilter(f filter.ContentFilter) {
+	r.contentFilter = f
+}
+
+// SetRateLimiter ограничивает частоту мутаций с директивой @rateLimit.
+func (r *Resolver) SetRateLimiter(l *ratelimit.Limiter) {
+	r.limiter = l
+}
+
+// DefaultMaxCommentDepth - ограничение вложенности ответов по умолчанию.
+const DefaultMaxCommentDepth = 20
+
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 100
+	maxCommentLength = 2000
+	defaultTreeDepth = 3
+	maxTreeDepth     = 10
+	maxEmojiLength   = 32
+	maxSearchLength  = 200
+	maxTagLength     = 50
+	maxPostTags      = 10
+	defaultTagsLimit = 50
+	// Как VARCHAR(100) столбца users.display_name
+	maxDisplayNameLength  = 100
+	maxReportReasonLength = 500
+)
+
+// deletedPlaceholder заменяет текст удалённого комментария в ответах API.
+const deletedPlaceholder = "[deleted]"
+
+// pageArgs приводит аргументы limit/offset из схемы к значениям для хранилища.
+func pageArgs(limit, offset *int32) (int, int, error) {
+	l, o := defaultPageLimit, 0
+	if limit != nil {
+		l = int(*limit)
+	}
+	if offset != nil {
+		o = int(*offset)
+	}
+	if l < 0 || o < 0 {
+		return 0, 0, invalidInput("limit and offset must not be negative")
+	}
+	if l > maxPageLimit {
+		l = maxPageLimit
+	}
+	return l, o, nil
+}
+
+// commentOrder возвращает порядок из аргумента orderBy, по умолчанию OLDEST.
+func commentOrder(orderBy *model.CommentOrder) model.CommentOrder {
+	if orderBy == nil {
+		return model.CommentOrderOldest
+	}
+	return *orderBy
+}
+
+// moderationModeArg сводит аргументы moderationMode и устаревший allowComments
+// к режиму поста. Без обоих аргументов режим остаётся current; allowComments: true
+// открывает закрытый пост, не снимая премодерацию.
+func moderationModeArg(allowComments *bool, mode *model.ModerationMode, current model.ModerationMode) (model.ModerationMode, error) {
+	if mode != nil {
+		if allowComments != nil && *allowComments != (*mode != model.ModerationModeClosed) {
+			return "", invalidInput("allowComments contradicts moderationMode %s", *mode)
+		}
+		return *mode, nil
+	}
+	switch {
+	case allowComments == nil:
+		return current, nil
+	case !*allowComments:
+		return model.ModerationModeClosed, nil
+	case current == model.ModerationModeClosed:
+		return model.ModerationModeOpen, nil
+	}
+	return current, nil
+}
+
+func checkVote(value int32) error {
+	if value < -1 || value > 1 {
+		return invalidInput("vote value must be -1, 0 or 1")
+	}
+	return nil
+}
+
+func checkReaction(emoji string) error {
+	if strings.TrimSpace(emoji) == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return invalidInput("emoji must be between 1 and %d characters", maxEmojiLength)
+	}
+	return nil
+}
+
+// postOrder возвращает порядок ленты из аргумента orderBy, по умолчанию NEWEST.
+func postOrder(orderBy *model.PostOrder) model.PostOrder {
+	if orderBy == nil {
+		return model.PostOrderNewest
+	}
+	return *orderBy
+}
+
+// checkPostFilter проверяет границы по времени: они сравниваются с createdAt
+// как моменты, поэтому должны быть в RFC 3339.
+func checkPostFilter(filter *model.PostFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if err := checkTimestamp("createdAfter", filter.CreatedAfter); err != nil {
+		return err
+	}
+	return checkTimestamp("createdBefore", filter.CreatedBefore)
+}
+
+func checkTimestamp(name string, value *string) error {
+	if value == nil {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339Nano, *value); err != nil {
+		return invalidInput("%s must be an RFC 3339 timestamp", name)
+	}
+	return nil
+}
+
+// normalizeTag приводит тег к виду, в котором он хранится: без пробелов по
+// краям и в нижнем регистре.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags нормализует и проверяет теги поста, отбрасывая повторы.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, invalidInput("tag must be between 1 and %d characters", maxTagLength)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxPostTags {
+		return nil, invalidInput("a post can have at most %d tags", maxPostTags)
+	}
+	return normalized, nil
+}
+
+func checkSearchQuery(query string) error {
+	if strings.TrimSpace(query) == "" || utf8.RuneCountInString(query) > maxSearchLength {
+		return invalidInput("search query must be between 1 and %d characters", maxSearchLength)
+	}
+	return nil
+}
+
+// user загружает автора поста или комментария, через загрузчик, если он есть.
+func (r *Resolver) user(ctx context.Context, id string) (*model.User, error) {
+	if ld := loaders.For(ctx); ld != nil {
+		user, err := ld.UsersByID.Load(ctx, id)
+		if err == nil && user == nil {
+			return nil, fmt.Errorf("user with ID %s %w", id, storage.ErrNotFound)
+		}
+		return user, err
+	}
+	return r.storage.GetUser(ctx, id)
+}
+
+// currentUserID возвращает ID пользователя из токена. Пользователь, которого
+// ещё нет в хранилище, заводится с именем из claim name, а без него - с sub.
+func (r *Resolver) currentUserID(ctx context.Context) (string, error) {
+	principal := auth.For(ctx)
+	if principal == nil {
+		return "", auth.ErrUnauthenticated
+	}
+	_, err := r.storage.GetUser(ctx, principal.UserID)
+	if err == nil {
+		return principal.UserID, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return "", err
+	}
+
+	name := strings.TrimSpace(principal.Name)
+	if name == "" {
+		name = principal.UserID
+	}
+	if runes := []rune(name); len(runes) > maxDisplayNameLength {
+		name = string(runes[:maxDisplayNameLength])
+	}
+	user := &model.User{ID: principal.UserID, DisplayName: name, CreatedAt: time.Now().Format(time.RFC3339Nano)}
+	// Конфликт значит, что параллельный запрос с тем же токеном успел завести пользователя
+	if err := r.storage.CreateUser(ctx, user); err != nil && !errors.Is(err, storage.ErrConflict) {
+		return "", err
+	}
+	return principal.UserID, nil
+}
+
+// viewerID возвращает пользователя, для которого считается viewerReacted;
+// для анонимного запроса - пустую строку.
+func viewerID(ctx context.Context) string {
+	if principal := auth.For(ctx); principal != nil {
+		return principal.UserID
+	}
+	return ""
+}
+
+// reactions загружает реакции поста или комментария через загрузчик запроса,
+// а без него - отдельным запросом к хранилищу.
+func (r *Resolver) reactions(ctx context.Context, kind storage.TargetKind, id string) ([]*model.Reaction, error) {
+	ld := loaders.For(ctx)
+	if ld == nil {
+		return r.storage.GetReactions(ctx, kind, id, viewerID(ctx))
+	}
+	loader := ld.ReactionsByPost
+	if kind == storage.TargetComment {
+		loader = ld.ReactionsByComment
+	}
+	reactions, err := loader.Load(ctx, loaders.ReactionKey{ID: id, Viewer: viewerID(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	if reactions == nil {
+		return []*model.Reaction{}, nil
+	}
+	return reactions, nil
+}
+
+// treeArgs проверяет аргументы дерева комментариев. Глубина ограничена
+// сильнее, чем ширина: каждый уровень умножает размер ответа.
+func treeArgs(maxDepth, limitPerLevel *int32) (int, int, error) {
+	d, l := defaultTreeDepth, defaultPageLimit
+	if maxDepth != nil {
+		d = int(*maxDepth)
+	}
+	if limitPerLevel != nil {
+		l = int(*limitPerLevel)
+	}
+	if d < 0 || l < 0 {
+		return 0, 0, invalidInput("maxDepth and limitPerLevel must not be negative")
+	}
+	if d > maxTreeDepth {
+		return 0, 0, invalidInput("maxDepth must not exceed %d", maxTreeDepth)
+	}
+	return d, min(l, maxPageLimit), nil
+}
+
+// moderate применяет решение модератора и возвращает комментарий с новым
+// статусом. Одобренный комментарий рассылается подписчикам, если читатели
+// его ещё не видели: правка возвращает на проверку уже опубликованный
+// комментарий, и подписчики его уже получили.
+func (r *Resolver) moderate(ctx context.Context, commentID string, status model.CommentStatus) (*model.Comment, error) {
+	before, err := r.storage.GetComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := r.storage.SetCommentStatus(ctx, commentID, status)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Comment %s status changed to %s", commentID, status)
+	if before.Status == model.CommentStatusPending && status == model.CommentStatusApproved && !before.Published {
+		r.notifyCommentAdded(comment)
+	}
+	return comment, nil
+}
+
+// notifyCommentAdded отправляет комментарий подписчикам commentAdded его поста.
+// Подписчик с переполненным каналом уведомление пропускает.
+func (r *Resolver) notifyCommentAdded(comment *model.Comment) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, ch := range r.subscribers[comment.PostID] {
+		select {
+		case ch <- comment:
+			log.Printf("Sent notification for comment %s to subscriber", comment.ID)
+		default:
+			log.Printf("Skipped notification for comment %s: channel full", comment.ID)
+		}
+	}
+}
+
+// checkContent проверяет текст фильтром содержимого. Отклонённый текст -
+// ошибка filter.ErrRejected, остальные решения возвращаются вызывающему.
+// Отправить модератору можно только комментарий (canQueue): для постов
+// очереди модерации нет, поэтому для них Flag отклоняет текст так же, как Reject.
+func (r *Resolver) checkContent(ctx context.Context, c filter.Content, canQueue bool) (filter.Verdict, error) {
+	verdict, err := r.contentFilter.Check(ctx, c)
+	if err != nil {
+		return filter.Verdict{}, err
+	}
+	if verdict.Action != filter.Allow {
+		log.Printf("Content filter verdict for %s: %s (%s)", c.AuthorID, verdict.Action, verdict.Reason)
+	}
+	if verdict.Action == filter.Reject || verdict.Action == filter.Flag && !canQueue {
+		return filter.Verdict{}, newError(filter.ErrRejected, "content rejected: %s", verdict.Reason)
+	}
+	return verdict, nil
+}
+
+// recordContent сообщает фильтрам, запоминающим тексты, о сохранённом c.
+func (r *Resolver) recordContent(ctx context.Context, c filter.Content) {
+	if rec, ok := r.contentFilter.(filter.Recorder); ok {
+		rec.Record(ctx, c)
+	}
+}
+
+func (r *Resolver) setThreadLocked(ctx context.Context, commentID string, locked bool) (*model.Comment, error) {
+	if err := r.storage.SetThreadLocked(ctx, commentID, locked); err != nil {
+		return nil, err
 	}
+	return r.storage.GetComment(ctx, commentID)
 }
@@ -2,26 +2,191 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"post-comment-app/graph/auth"
+	"post-comment-app/graph/filter"
+	"post-comment-app/graph/loaders"
 	"post-comment-app/graph/model"
+	"post-comment-app/storage"
+	"strings"
 	"time"
-
-	"github.com/google/uuid"
+	"unicode/utf8"
 )
 
-func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, author string, allowComments bool) (*model.Post, error) {
-	if title == "" || content == "" || author == "" {
-		return nil, fmt.Errorf("title, content, and author must not be empty")
+func (r *commentResolver) Author(ctx context.Context, obj *model.Comment) (*model.User, error) {
+	if obj.DeletedAt != nil {
+		return nil, nil
+	}
+	return r.user(ctx, obj.AuthorID)
+}
+
+func (r *commentResolver) Text(ctx context.Context, obj *model.Comment) (string, error) {
+	if obj.DeletedAt != nil {
+		return deletedPlaceholder, nil
+	}
+	return obj.Text, nil
+}
+
+func (r *commentResolver) IsDeleted(ctx context.Context, obj *model.Comment) (bool, error) {
+	return obj.DeletedAt != nil, nil
+}
+
+func (r *commentResolver) Reports(ctx context.Context, obj *model.Comment) ([]*model.CommentReport, error) {
+	return r.storage.GetCommentReports(ctx, obj.ID)
+}
+
+func (r *commentResolver) Ancestors(ctx context.Context, obj *model.Comment) ([]*model.Comment, error) {
+	if obj.ParentID == nil {
+		return []*model.Comment{}, nil
+	}
+	ld := loaders.For(ctx)
+	if ld == nil {
+		return r.storage.GetCommentAncestors(ctx, obj.ID, visibility(ctx))
+	}
+	ancestors, err := ld.AncestorsByComment.Load(ctx, loaders.VisibleKey{ID: obj.ID, Visibility: visibility(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	if ancestors == nil {
+		return []*model.Comment{}, nil
+	}
+	return ancestors, nil
+}
+
+func (r *commentResolver) DescendantCount(ctx context.Context, obj *model.Comment) (int32, error) {
+	var n int
+	var err error
+	if ld := loaders.For(ctx); ld != nil {
+		n, err = ld.DescendantCountByComment.Load(ctx, loaders.VisibleKey{ID: obj.ID, Visibility: visibility(ctx)})
+	} else {
+		n, err = r.storage.CountDescendants(ctx, obj.ID, visibility(ctx))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int32(n), nil
+}
+
+func (r *commentResolver) Reactions(ctx context.Context, obj *model.Comment) ([]*model.Reaction, error) {
+	return r.reactions(ctx, storage.TargetComment, obj.ID)
+}
+
+func (r *commentResolver) Revisions(ctx context.Context, obj *model.Comment) ([]*model.CommentRevision, error) {
+	if obj.DeletedAt != nil {
+		return []*model.CommentRevision{}, nil
+	}
+	return r.storage.GetCommentRevisions(ctx, obj.ID)
+}
+
+func (r *commentResolver) EditCount(ctx context.Context, obj *model.Comment) (int32, error) {
+	// Как и revisions, история удалённого комментария не раскрывается
+	if obj.DeletedAt != nil {
+		return 0, nil
+	}
+	var n int
+	var err error
+	if ld := loaders.For(ctx); ld != nil {
+		n, err = ld.EditCountByComment.Load(ctx, obj.ID)
+	} else {
+		var counts map[string]int
+		counts, err = r.storage.CountCommentRevisions(ctx, []string{obj.ID})
+		n = counts[obj.ID]
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int32(n), nil
+}
+
+func (r *commentResolver) Replies(ctx context.Context, obj *model.Comment, limit *int32, offset *int32, orderBy *model.CommentOrder) ([]*model.Comment, error) {
+	l, o, err := pageArgs(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	order := commentOrder(orderBy)
+	v := visibility(ctx)
+	if ld := loaders.For(ctx); ld != nil {
+		return ld.RepliesByComment.Load(ctx, loaders.PageKey{ID: obj.ID, Order: order, Limit: l, Offset: o, Visibility: v})
+	}
+	return r.storage.GetRepliesByCommentID(ctx, obj.ID, order, l, o, v)
+}
+
+func (r *commentResolver) RepliesConnection(ctx context.Context, obj *model.Comment, first *int32, after *string) (*model.CommentConnection, error) {
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	replies, hasNext, err := r.storage.GetRepliesPageByCommentID(ctx, obj.ID, n, cursor, visibility(ctx))
+	if err != nil {
+		return nil, err
 	}
+	return newCommentConnection(replies, hasNext), nil
+}
+
+func (r *commentResolver) Subtree(ctx context.Context, obj *model.Comment, maxDepth *int32, limitPerLevel *int32) (*model.CommentTreeNode, error) {
+	depth, limit, err := treeArgs(maxDepth, limitPerLevel)
+	if err != nil {
+		return nil, err
+	}
+	return r.storage.GetCommentSubtree(ctx, obj.ID, depth, limit, visibility(ctx))
+}
+
+func (r *commentReportResolver) Reporter(ctx context.Context, obj *model.CommentReport) (*model.User, error) {
+	return r.user(ctx, obj.ReporterID)
+}
+
+func (r *commentRevisionResolver) Editor(ctx context.Context, obj *model.CommentRevision) (*model.User, error) {
+	return r.user(ctx, obj.EditorID)
+}
+
+func (r *mutationResolver) CreateUser(ctx context.Context, displayName string) (*model.User, error) {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" || utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return nil, invalidInput("display name must be between 1 and %d characters", maxDisplayNameLength)
+	}
+	user := &model.User{
+		ID:          storage.NewID(),
+		DisplayName: displayName,
+		CreatedAt:   time.Now().Format(time.RFC3339Nano),
+	}
+	if err := r.storage.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, allowComments *bool, moderationMode *model.ModerationMode, tags []string) (*model.Post, error) {
+	authorID, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" || content == "" {
+		return nil, invalidInput("title and content must not be empty")
+	}
+	mode, err := moderationModeArg(allowComments, moderationMode, model.ModerationModeOpen)
+	if err != nil {
+		return nil, err
+	}
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	verdict, err := r.checkContent(ctx, filter.Content{Kind: filter.KindPost, AuthorID: authorID, Title: title, Text: content}, false)
+	if err != nil {
+		return nil, err
+	}
+	title, content = verdict.Title, verdict.Text
 
 	post := &model.Post{
-		ID:            uuid.NewString(),
-		Title:         title,
-		Content:       content,
-		Author:        author,
-		AllowComments: allowComments,
-		CreatedAt:     time.Now().Format(time.RFC3339),
+		ID:             storage.NewID(),
+		Title:          title,
+		Content:        content,
+		AuthorID:       authorID,
+		ModerationMode: mode,
+		Tags:           tags,
+		CreatedAt:      time.Now().Format(time.RFC3339Nano),
 	}
 	if err := r.storage.CreatePost(ctx, post); err != nil {
 		return nil, err
@@ -29,43 +194,89 @@ func (r *mutationResolver) CreatePost(ctx context.Context, title string, content
 	return post, nil
 }
 
-func (r *mutationResolver) AddComment(ctx context.Context, postID string, parentID *string, author string, text string) (*model.Comment, error) {
+func (r *mutationResolver) AddComment(ctx context.Context, postID string, parentID *string, text string) (*model.Comment, error) {
 	log.Printf("Adding comment to postID: %s, parentID: %v", postID, parentID)
 
-	if author == "" || text == "" {
-		log.Println("Author and text must not be empty")
-		return nil, fmt.Errorf("author and text must not be empty")
+	authorID, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" {
+		log.Println("Text must not be empty")
+		return nil, invalidInput("text must not be empty")
 	}
 
-	if len(text) > 2000 {
+	if len(text) > maxCommentLength {
 		log.Println("Comment too long")
-		return nil, fmt.Errorf("comment too long")
+		return nil, invalidInput("comment too long")
 	}
 
 	post, err := r.storage.GetPost(ctx, postID)
 	if err != nil {
 		log.Printf("Error getting post: %v", err)
-		return nil, fmt.Errorf("post not found")
+		return nil, err
 	}
-	if !post.AllowComments {
+	if post.ModerationMode == model.ModerationModeClosed {
 		log.Println("Comments are not allowed for this post")
-		return nil, fmt.Errorf("comments are not allowed for this post")
+		return nil, storage.ErrCommentsDisabled
 	}
 
 	if parentID != nil {
-		_, err := r.storage.GetComment(ctx, *parentID)
+		parent, err := r.storage.GetComment(ctx, *parentID)
 		if err != nil {
 			log.Printf("Error getting parent comment: %v", err)
-			return nil, fmt.Errorf("parent comment not found")
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil, fmt.Errorf("parent %w", err)
+			}
+			return nil, err
+		}
+		if !visibility(ctx).Visible(parent) {
+			log.Println("Parent comment is hidden")
+			return nil, newError(storage.ErrNotFound, "parent comment not found")
 		}
+		if parent.PostID != postID {
+			log.Println("Parent comment belongs to another post")
+			return nil, invalidInput("parent comment belongs to another post")
+		}
+		if storage.IsHidden(parent) {
+			log.Println("Parent comment is not published")
+			return nil, newError(storage.ErrConflict, "cannot reply to a comment that is not published")
+		}
+		if parent.DeletedAt != nil {
+			log.Println("Parent comment is deleted")
+			return nil, newError(storage.ErrConflict, "cannot reply to a deleted comment")
+		}
+		if int(parent.Depth)+1 > r.maxCommentDepth {
+			log.Println("Maximum nesting depth reached")
+			return nil, invalidInput("maximum nesting depth of %d reached", r.maxCommentDepth)
+		}
+		locked, err := r.storage.IsThreadLocked(ctx, *parentID)
+		if err != nil {
+			log.Printf("Error checking thread lock: %v", err)
+			return nil, err
+		}
+		if locked {
+			log.Println("Thread is locked")
+			return nil, newError(storage.ErrConflict, "thread is locked")
+		}
+	}
+
+	verdict, err := r.checkContent(ctx, filter.Content{Kind: filter.KindComment, AuthorID: authorID, Text: text}, true)
+	if err != nil {
+		return nil, err
 	}
 
 	comment := &model.Comment{
+		ID:        storage.NewID(),
 		PostID:    postID,
 		ParentID:  parentID,
-		Author:    author,
-		Text:      text,
-		CreatedAt: time.Now().Format(time.RFC3339),
+		AuthorID:  authorID,
+		Text:      verdict.Text,
+		CreatedAt: time.Now().Format(time.RFC3339Nano),
+	}
+	// Помеченный фильтром комментарий ждёт модератора, как на премодерации
+	if post.ModerationMode == model.ModerationModePremoderated || verdict.Action == filter.Flag {
+		comment.Status = model.CommentStatusPending
 	}
 
 	createdComment, err := r.storage.CreateComment(ctx, comment)
@@ -73,26 +284,381 @@ func (r *mutationResolver) AddComment(ctx context.Context, postID string, parent
 		log.Printf("Error creating comment: %v", err)
 		return nil, err
 	}
+	r.recordContent(ctx, filter.Content{Kind: filter.KindComment, AuthorID: authorID, Text: createdComment.Text})
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	if subs, ok := r.subscribers[postID]; ok {
-		for _, ch := range subs {
-			select {
-			case ch <- createdComment:
-				log.Printf("Sent notification for comment %s to subscriber", createdComment.ID)
-			default:
-				log.Printf("Skipped notification for comment %s: channel full", createdComment.ID)
-			}
-		}
+	// Подписчики узнают о комментарии на премодерации, когда его одобрят
+	if createdComment.Status != model.CommentStatusPending {
+		r.notifyCommentAdded(createdComment)
 	}
 
 	log.Printf("Comment %s created successfully", createdComment.ID)
 	return createdComment, nil
 }
 
-func (r *queryResolver) Posts(ctx context.Context) ([]*model.Post, error) {
-	return r.storage.GetPosts(ctx)
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, title *string, content *string, allowComments *bool, moderationMode *model.ModerationMode) (*model.Post, error) {
+	post, err := r.storage.GetPost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(ctx, post.AuthorID, "post"); err != nil {
+		return nil, err
+	}
+
+	// Работаем с копией, чтобы не менять сохранённый объект до записи
+	updated := *post
+	if title != nil {
+		updated.Title = *title
+	}
+	if content != nil {
+		updated.Content = *content
+	}
+	updated.ModerationMode, err = moderationModeArg(allowComments, moderationMode, post.ModerationMode)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Title == "" || updated.Content == "" {
+		return nil, invalidInput("title and content must not be empty")
+	}
+	if title != nil || content != nil {
+		verdict, err := r.checkContent(ctx, filter.Content{Kind: filter.KindPost, AuthorID: post.AuthorID, Title: updated.Title, Text: updated.Content, Edit: true}, false)
+		if err != nil {
+			return nil, err
+		}
+		updated.Title, updated.Content = verdict.Title, verdict.Text
+	}
+	now := time.Now().Format(time.RFC3339Nano)
+	updated.UpdatedAt = &now
+
+	if err := r.storage.UpdatePost(ctx, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (r *mutationResolver) DeletePost(ctx context.Context, id string) (bool, error) {
+	post, err := r.storage.GetPost(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if err := checkOwner(ctx, post.AuthorID, "post"); err != nil {
+		return false, err
+	}
+	if err := r.storage.DeletePost(ctx, id); err != nil {
+		return false, err
+	}
+	log.Printf("Post %s deleted", id)
+	return true, nil
+}
+
+func (r *mutationResolver) SetPostTags(ctx context.Context, postID string, tags []string) (*model.Post, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	post, err := r.storage.GetPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(ctx, post.AuthorID, "post"); err != nil {
+		return nil, err
+	}
+	if err := r.storage.SetPostTags(ctx, postID, tags); err != nil {
+		return nil, err
+	}
+	return r.storage.GetPost(ctx, postID)
+}
+
+func (r *mutationResolver) EditComment(ctx context.Context, id string, text string) (*model.Comment, error) {
+	if text == "" {
+		return nil, invalidInput("text must not be empty")
+	}
+	if len(text) > maxCommentLength {
+		return nil, invalidInput("comment too long")
+	}
+
+	editorID, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := r.storage.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(ctx, comment.AuthorID, "comment"); err != nil {
+		return nil, err
+	}
+	if comment.DeletedAt != nil {
+		return nil, newError(storage.ErrConflict, "comment is deleted")
+	}
+	post, err := r.storage.GetPost(ctx, comment.PostID)
+	if err != nil {
+		return nil, err
+	}
+	// Автор правит комментарий на тех же условиях, что и пишет новый;
+	// модератор правит и в закрытых постах, и в заблокированных ветках
+	moderator := auth.For(ctx).HasRole(model.RoleModerator)
+	if !moderator {
+		if post.ModerationMode == model.ModerationModeClosed {
+			return nil, storage.ErrCommentsDisabled
+		}
+		locked, err := r.storage.IsThreadLocked(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, newError(storage.ErrConflict, "thread is locked")
+		}
+	}
+	verdict, err := r.checkContent(ctx, filter.Content{Kind: filter.KindComment, AuthorID: comment.AuthorID, Text: text, Edit: true}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := *comment
+	edited.Text = verdict.Text
+	now := time.Now().Format(time.RFC3339Nano)
+	edited.EditedAt = &now
+	// На посту с премодерацией и после пометки фильтром новый текст автора снова ждёт проверки
+	if (post.ModerationMode == model.ModerationModePremoderated || verdict.Action == filter.Flag) && !moderator {
+		edited.Status = model.CommentStatusPending
+	}
+
+	if err := r.storage.UpdateComment(ctx, &edited, editorID); err != nil {
+		return nil, err
+	}
+	return r.storage.GetComment(ctx, id)
+}
+
+func (r *mutationResolver) SetCommentsEnabled(ctx context.Context, postID string, enabled bool) (*model.Post, error) {
+	return r.Mutation().UpdatePost(ctx, postID, nil, nil, &enabled, nil)
+}
+
+func (r *mutationResolver) SetModerationMode(ctx context.Context, postID string, mode model.ModerationMode) (*model.Post, error) {
+	return r.Mutation().UpdatePost(ctx, postID, nil, nil, nil, &mode)
+}
+
+func (r *mutationResolver) LockThread(ctx context.Context, commentID string) (*model.Comment, error) {
+	return r.setThreadLocked(ctx, commentID, true)
+}
+
+func (r *mutationResolver) UnlockThread(ctx context.Context, commentID string) (*model.Comment, error) {
+	return r.setThreadLocked(ctx, commentID, false)
+}
+
+func (r *mutationResolver) DeleteComment(ctx context.Context, id string) (bool, error) {
+	comment, err := r.storage.GetComment(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if err := checkOwner(ctx, comment.AuthorID, "comment"); err != nil {
+		return false, err
+	}
+	if err := r.storage.DeleteComment(ctx, id, time.Now().Format(time.RFC3339Nano)); err != nil {
+		return false, err
+	}
+	log.Printf("Comment %s deleted", id)
+	return true, nil
+}
+
+func (r *mutationResolver) VoteComment(ctx context.Context, commentID string, value int32) (*model.Comment, error) {
+	if err := checkVote(value); err != nil {
+		return nil, err
+	}
+	voter, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := r.storage.GetComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if !visibility(ctx).Visible(comment) {
+		return nil, newError(storage.ErrNotFound, "comment not found")
+	}
+	if comment.DeletedAt != nil {
+		return nil, newError(storage.ErrConflict, "cannot vote for a deleted comment")
+	}
+	if err := r.storage.Vote(ctx, storage.TargetComment, commentID, voter, int(value)); err != nil {
+		return nil, err
+	}
+	return r.storage.GetComment(ctx, commentID)
+}
+
+func (r *mutationResolver) VotePost(ctx context.Context, postID string, value int32) (*model.Post, error) {
+	if err := checkVote(value); err != nil {
+		return nil, err
+	}
+	voter, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.storage.Vote(ctx, storage.TargetPost, postID, voter, int(value)); err != nil {
+		return nil, err
+	}
+	return r.storage.GetPost(ctx, postID)
+}
+
+func (r *mutationResolver) React(ctx context.Context, targetID string, emoji string) ([]*model.Reaction, error) {
+	if err := checkReaction(emoji); err != nil {
+		return nil, err
+	}
+	user, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// ID постов и комментариев не пересекаются, так что объект определяется поиском
+	kind := storage.TargetComment
+	comment, err := r.storage.GetComment(ctx, targetID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		kind = storage.TargetPost
+	case err != nil:
+		return nil, err
+	case !visibility(ctx).Visible(comment):
+		return nil, newError(storage.ErrNotFound, "post or comment with ID %s not found", targetID)
+	case comment.DeletedAt != nil:
+		return nil, newError(storage.ErrConflict, "cannot react to a deleted comment")
+	}
+	if _, err := r.storage.ToggleReaction(ctx, kind, targetID, user, emoji); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, newError(storage.ErrNotFound, "post or comment with ID %s not found", targetID)
+		}
+		return nil, err
+	}
+	return r.storage.GetReactions(ctx, kind, targetID, user)
+}
+
+func (r *mutationResolver) ReportComment(ctx context.Context, commentID string, reason string) (*model.Comment, error) {
+	reporterID, err := r.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxReportReasonLength {
+		return nil, invalidInput("reason must be between 1 and %d characters", maxReportReasonLength)
+	}
+	report := &model.CommentReport{
+		ReporterID: reporterID,
+		Reason:     reason,
+		CreatedAt:  time.Now().Format(time.RFC3339Nano),
+	}
+	// Жалобу на скрытый комментарий хранилище отклоняет как на несуществующий
+	comment, err := r.storage.ReportComment(ctx, commentID, report)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Comment %s reported by %s", commentID, reporterID)
+	return comment, nil
+}
+
+func (r *mutationResolver) ApproveComment(ctx context.Context, id string) (*model.Comment, error) {
+	return r.moderate(ctx, id, model.CommentStatusApproved)
+}
+
+func (r *mutationResolver) HideComment(ctx context.Context, id string) (*model.Comment, error) {
+	return r.moderate(ctx, id, model.CommentStatusHidden)
+}
+
+func (r *mutationResolver) RejectComment(ctx context.Context, id string) (*model.Comment, error) {
+	return r.moderate(ctx, id, model.CommentStatusRejected)
+}
+
+func (r *postResolver) Author(ctx context.Context, obj *model.Post) (*model.User, error) {
+	return r.user(ctx, obj.AuthorID)
+}
+
+func (r *postResolver) AllowComments(ctx context.Context, obj *model.Post) (bool, error) {
+	return obj.ModerationMode != model.ModerationModeClosed, nil
+}
+
+func (r *postResolver) Tags(ctx context.Context, obj *model.Post) ([]string, error) {
+	var tags []string
+	var err error
+	if ld := loaders.For(ctx); ld != nil {
+		tags, err = ld.TagsByPost.Load(ctx, obj.ID)
+	} else {
+		var byPost map[string][]string
+		byPost, err = r.storage.GetTagsByPostIDs(ctx, []string{obj.ID})
+		tags = byPost[obj.ID]
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		return []string{}, nil
+	}
+	return tags, nil
+}
+
+func (r *postResolver) Reactions(ctx context.Context, obj *model.Post) ([]*model.Reaction, error) {
+	return r.reactions(ctx, storage.TargetPost, obj.ID)
+}
+
+func (r *postResolver) Comments(ctx context.Context, obj *model.Post, limit *int32, offset *int32, orderBy *model.CommentOrder) ([]*model.Comment, error) {
+	l, o, err := pageArgs(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	order := commentOrder(orderBy)
+	v := visibility(ctx)
+	if ld := loaders.For(ctx); ld != nil {
+		return ld.CommentsByPost.Load(ctx, loaders.PageKey{ID: obj.ID, Order: order, Limit: l, Offset: o, Visibility: v})
+	}
+	return r.storage.GetCommentsByPostID(ctx, obj.ID, order, l, o, v)
+}
+
+func (r *postResolver) CommentsConnection(ctx context.Context, obj *model.Post, first *int32, after *string) (*model.CommentConnection, error) {
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	comments, hasNext, err := r.storage.GetCommentsPageByPostID(ctx, obj.ID, n, cursor, visibility(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return newCommentConnection(comments, hasNext), nil
+}
+
+func (r *postResolver) CommentTree(ctx context.Context, obj *model.Post, maxDepth *int32, limitPerLevel *int32) ([]*model.CommentTreeNode, error) {
+	depth, limit, err := treeArgs(maxDepth, limitPerLevel)
+	if err != nil {
+		return nil, err
+	}
+	return r.storage.GetCommentTree(ctx, obj.ID, depth, limit, visibility(ctx))
+}
+
+func (r *queryResolver) Posts(ctx context.Context, filter *model.PostFilter, orderBy *model.PostOrder, first *int32, after *string) (*model.PostConnection, error) {
+	if err := checkPostFilter(filter); err != nil {
+		return nil, err
+	}
+	if filter != nil && filter.Tag != nil {
+		tag := normalizeTag(*filter.Tag)
+		normalized := *filter
+		normalized.Tag = &tag
+		filter = &normalized
+	}
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	order := postOrder(orderBy)
+	posts, hasNext, err := r.storage.GetPosts(ctx, filter, order, n, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return newPostConnection(posts, order, hasNext), nil
+}
+
+func (r *queryResolver) PostsConnection(ctx context.Context, first *int32, after *string) (*model.PostConnection, error) {
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	posts, hasNext, err := r.storage.GetPosts(ctx, nil, model.PostOrderNewest, n, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return newPostConnection(posts, model.PostOrderNewest, hasNext), nil
 }
 
 func (r *queryResolver) Post(ctx context.Context, id string) (*model.Post, error) {
@@ -106,6 +672,21 @@ func (r *queryResolver) Post(ctx context.Context, id string) (*model.Post, error
 	return post, nil
 }
 
+func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
+	return r.storage.GetUser(ctx, id)
+}
+
+func (r *queryResolver) Tags(ctx context.Context, first *int32) ([]*model.Tag, error) {
+	n := defaultTagsLimit
+	if first != nil {
+		n = int(*first)
+	}
+	if n < 0 {
+		return nil, invalidInput("first must not be negative")
+	}
+	return r.storage.GetTags(ctx, min(n, maxPageLimit))
+}
+
 func (r *queryResolver) Comment(ctx context.Context, id string) (*model.Comment, error) {
 	log.Printf("Fetching comment with ID: %s", id)
 	comment, err := r.storage.GetComment(ctx, id)
@@ -113,10 +694,45 @@ func (r *queryResolver) Comment(ctx context.Context, id string) (*model.Comment,
 		log.Printf("Error fetching comment: %v", err)
 		return nil, err
 	}
+	if !visibility(ctx).Visible(comment) {
+		return nil, newError(storage.ErrNotFound, "comment not found")
+	}
 	log.Printf("Comment %s fetched successfully", id)
 	return comment, nil
 }
 
+func (r *queryResolver) Search(ctx context.Context, query string, typeArg []model.SearchType, first *int32, after *string) (*model.SearchConnection, error) {
+	if err := checkSearchQuery(query); err != nil {
+		return nil, err
+	}
+	n, offset, err := searchArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	hits, hasNext, err := r.storage.Search(ctx, query, typeArg, n, offset)
+	if err != nil {
+		log.Printf("Error searching for %q: %v", query, err)
+		return nil, err
+	}
+	return newSearchConnection(hits, offset, hasNext), nil
+}
+
+func (r *queryResolver) ModerationQueue(ctx context.Context, status *model.CommentStatus, first *int32, after *string) (*model.CommentConnection, error) {
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		reported := model.CommentStatusReported
+		status = &reported
+	}
+	comments, hasNext, err := r.storage.GetModerationQueue(ctx, *status, n, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return newCommentConnection(comments, hasNext), nil
+}
+
 func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
 	log.Printf("New subscription for postID: %s", postID)
 	ch := make(chan *model.Comment, 1)
@@ -142,10 +758,45 @@ func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string)
 	return ch, nil
 }
 
-func (r *Resolver) Mutation() MutationResolver         { return &mutationResolver{r} }
-func (r *Resolver) Query() QueryResolver               { return &queryResolver{r} }
-func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+func (r *userResolver) Posts(ctx context.Context, obj *model.User, first *int32, after *string) (*model.PostConnection, error) {
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	filter := &model.PostFilter{AuthorID: &obj.ID}
+	posts, hasNext, err := r.storage.GetPosts(ctx, filter, model.PostOrderNewest, n, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return newPostConnection(posts, model.PostOrderNewest, hasNext), nil
+}
+
+func (r *userResolver) Comments(ctx context.Context, obj *model.User, first *int32, after *string) (*model.CommentConnection, error) {
+	n, cursor, err := connectionArgs(first, after)
+	if err != nil {
+		return nil, err
+	}
+	comments, hasNext, err := r.storage.GetCommentsPageByAuthorID(ctx, obj.ID, n, cursor, visibility(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return newCommentConnection(comments, hasNext), nil
+}
+
+func (r *Resolver) Comment() CommentResolver                 { return &commentResolver{r} }
+func (r *Resolver) CommentReport() CommentReportResolver     { return &commentReportResolver{r} }
+func (r *Resolver) CommentRevision() CommentRevisionResolver { return &commentRevisionResolver{r} }
+func (r *Resolver) Mutation() MutationResolver               { return &mutationResolver{r} }
+func (r *Resolver) Post() PostResolver                       { return &postResolver{r} }
+func (r *Resolver) Query() QueryResolver                     { return &queryResolver{r} }
+func (r *Resolver) Subscription() SubscriptionResolver       { return &subscriptionResolver{r} }
+func (r *Resolver) User() UserResolver                       { return &userResolver{r} }
 
+type commentResolver struct{ *Resolver }
+type commentReportResolver struct{ *Resolver }
+type commentRevisionResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -2,22 +2,159 @@ package graph
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"post-comment-app/graph/auth"
+	"post-comment-app/graph/filter"
+	"post-comment-app/graph/loaders"
 	"post-comment-app/graph/model"
+	"post-comment-app/graph/ratelimit"
 	"post-comment-app/storage"
 )
 
+// testAuthors - пользователи, от имени которых тесты пишут посты и комментарии;
+// ID совпадает с именем, чтобы не протаскивать его через каждый тест.
+var testAuthors = []string{"Author", "Author 1", "Author 2", "John Doe", "Jane", "User", "Bob", "alice", "bob"}
+
+func newTestStorage() *storage.InMemoryStorage {
+	store := storage.NewInMemoryStorage()
+	for _, name := range testAuthors {
+		user := &model.User{ID: name, DisplayName: name, CreatedAt: time.Now().Format(time.RFC3339)}
+		if err := store.CreateUser(context.Background(), user); err != nil {
+			panic(err)
+		}
+	}
+	return store
+}
+
+// asUser - контекст запроса с токеном пользователя id с ролью автора.
+func asUser(ctx context.Context, id string) context.Context {
+	return auth.WithPrincipal(ctx, &auth.Principal{UserID: id, Role: model.RoleAuthor})
+}
+
+// as выполняет запрос клиента от имени пользователя id с ролью role.
+func as(id string, role model.Role) client.Option {
+	return func(bd *client.Request) {
+		bd.HTTP = bd.HTTP.WithContext(auth.WithPrincipal(bd.HTTP.Context(), &auth.Principal{UserID: id, Role: role}))
+	}
+}
+
+// moderationMode возвращает указатель на режим для аргументов мутаций.
+func moderationMode(mode model.ModerationMode) *model.ModerationMode {
+	return &mode
+}
+
+// asModerator - контекст запроса модератора с ID "Moderator".
+func asModerator(ctx context.Context) context.Context {
+	return auth.WithPrincipal(ctx, &auth.Principal{UserID: "Moderator", Role: model.RoleModerator})
+}
+
 func setupResolver() *Resolver {
-	return &Resolver{
-		storage:     storage.NewInMemoryStorage(),
-		subscribers: make(map[string][]chan *model.Comment),
+	return NewResolver(newTestStorage())
+}
+
+// newTestClient поднимает исполняемую схему поверх резолвера, чтобы запросы
+// проходили через сгенерированный код так же, как в сервере.
+func newTestClient(r *Resolver) *client.Client {
+	srv := handler.New(NewExecutableSchema(NewConfig(r)))
+	srv.AddTransport(transport.POST{})
+	return client.New(loaders.Middleware(r.storage, srv))
+}
+
+// failingStorage не сохраняет комментарии, пока выставлен fail.
+type failingStorage struct {
+	storage.Storage
+	fail atomic.Bool
+}
+
+func (s *failingStorage) CreateComment(ctx context.Context, comment *model.Comment) (*model.Comment, error) {
+	if s.fail.Load() {
+		return nil, errors.New("storage unavailable")
 	}
+	return s.Storage.CreateComment(ctx, comment)
+}
+
+// countingStorage считает обращения к хранилищу за дочерними комментариями.
+type countingStorage struct {
+	storage.Storage
+	single    atomic.Int32
+	batch     atomic.Int32
+	revisions atomic.Int32
+	reactions atomic.Int32
+	paths     atomic.Int32
+}
+
+func (s *countingStorage) GetCommentsByPostID(ctx context.Context, postID string, order model.CommentOrder, limit, offset int, visibility storage.Visibility) ([]*model.Comment, error) {
+	s.single.Add(1)
+	return s.Storage.GetCommentsByPostID(ctx, postID, order, limit, offset, visibility)
+}
+
+func (s *countingStorage) GetRepliesByCommentID(ctx context.Context, commentID string, order model.CommentOrder, limit, offset int, visibility storage.Visibility) ([]*model.Comment, error) {
+	s.single.Add(1)
+	return s.Storage.GetRepliesByCommentID(ctx, commentID, order, limit, offset, visibility)
+}
+
+func (s *countingStorage) GetCommentsByPostIDs(ctx context.Context, postIDs []string, order model.CommentOrder, limit, offset int, visibility storage.Visibility) (map[string][]*model.Comment, error) {
+	s.batch.Add(1)
+	return s.Storage.GetCommentsByPostIDs(ctx, postIDs, order, limit, offset, visibility)
+}
+
+func (s *countingStorage) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, order model.CommentOrder, limit, offset int, visibility storage.Visibility) (map[string][]*model.Comment, error) {
+	s.batch.Add(1)
+	return s.Storage.GetRepliesByCommentIDs(ctx, commentIDs, order, limit, offset, visibility)
+}
+
+func (s *countingStorage) GetCommentRevisions(ctx context.Context, commentID string) ([]*model.CommentRevision, error) {
+	s.revisions.Add(1)
+	return s.Storage.GetCommentRevisions(ctx, commentID)
+}
+
+func (s *countingStorage) CountCommentRevisions(ctx context.Context, commentIDs []string) (map[string]int, error) {
+	s.revisions.Add(1)
+	return s.Storage.CountCommentRevisions(ctx, commentIDs)
+}
+
+func (s *countingStorage) GetReactions(ctx context.Context, kind storage.TargetKind, targetID, viewer string) ([]*model.Reaction, error) {
+	s.reactions.Add(1)
+	return s.Storage.GetReactions(ctx, kind, targetID, viewer)
+}
+
+func (s *countingStorage) GetReactionsByTargetIDs(ctx context.Context, kind storage.TargetKind, targetIDs []string, viewer string) (map[string][]*model.Reaction, error) {
+	s.reactions.Add(1)
+	return s.Storage.GetReactionsByTargetIDs(ctx, kind, targetIDs, viewer)
+}
+
+func (s *countingStorage) GetCommentAncestors(ctx context.Context, commentID string, visibility storage.Visibility) ([]*model.Comment, error) {
+	s.paths.Add(1)
+	return s.Storage.GetCommentAncestors(ctx, commentID, visibility)
+}
+
+func (s *countingStorage) GetCommentAncestorsByIDs(ctx context.Context, commentIDs []string, visibility storage.Visibility) (map[string][]*model.Comment, error) {
+	s.paths.Add(1)
+	return s.Storage.GetCommentAncestorsByIDs(ctx, commentIDs, visibility)
+}
+
+func (s *countingStorage) CountDescendants(ctx context.Context, commentID string, visibility storage.Visibility) (int, error) {
+	s.paths.Add(1)
+	return s.Storage.CountDescendants(ctx, commentID, visibility)
+}
+
+func (s *countingStorage) CountDescendantsByIDs(ctx context.Context, commentIDs []string, visibility storage.Visibility) (map[string]int, error) {
+	s.paths.Add(1)
+	return s.Storage.CountDescendantsByIDs(ctx, commentIDs, visibility)
 }
 
 func TestResolver(t *testing.T) {
@@ -27,13 +164,13 @@ func TestResolver(t *testing.T) {
 		r := setupResolver()
 
 		t.Run("ValidInput", func(t *testing.T) {
-			post, err := r.Mutation().CreatePost(ctx, "Test Title", "Test Content", "John Doe", true)
+			post, err := r.Mutation().CreatePost(asUser(ctx, "John Doe"), "Test Title", "Test Content", nil, nil, nil)
 			assert.NoError(t, err)
 			assert.NotNil(t, post)
 			assert.Equal(t, "Test Title", post.Title)
 			assert.Equal(t, "Test Content", post.Content)
-			assert.Equal(t, "John Doe", post.Author)
-			assert.True(t, post.AllowComments)
+			assert.Equal(t, "John Doe", post.AuthorID)
+			assert.Equal(t, model.ModerationModeOpen, post.ModerationMode)
 			assert.NotEmpty(t, post.ID)
 			assert.NotEmpty(t, post.CreatedAt)
 
@@ -44,17 +181,32 @@ func TestResolver(t *testing.T) {
 		})
 
 		t.Run("EmptyInput", func(t *testing.T) {
-			_, err := r.Mutation().CreatePost(ctx, "", "Content", "Author", true)
+			_, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "", "Content", nil, nil, nil)
 			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "title, content, and author must not be empty")
+			assert.Contains(t, err.Error(), "title and content must not be empty")
 
-			_, err = r.Mutation().CreatePost(ctx, "Title", "", "Author", true)
+			_, err = r.Mutation().CreatePost(asUser(ctx, "Author"), "Title", "", nil, nil, nil)
 			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "title, content, and author must not be empty")
+			assert.Contains(t, err.Error(), "title and content must not be empty")
+		})
 
-			_, err = r.Mutation().CreatePost(ctx, "Title", "Content", "", true)
-			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "title, content, and author must not be empty")
+		t.Run("AuthorFromToken", func(t *testing.T) {
+			_, err := r.Mutation().CreatePost(ctx, "Title", "Content", nil, nil, nil)
+			assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+			// Неизвестный пользователь заводится по claims токена
+			post, err := r.Mutation().CreatePost(auth.WithPrincipal(ctx, &auth.Principal{UserID: "new-user", Name: " Newcomer "}), "Title", "Content", nil, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "new-user", post.AuthorID)
+			user, err := r.Query().User(ctx, "new-user")
+			require.NoError(t, err)
+			assert.Equal(t, "Newcomer", user.DisplayName)
+
+			_, err = r.Mutation().CreatePost(asUser(ctx, "anonymous-name"), "Title", "Content", nil, nil, nil)
+			require.NoError(t, err)
+			user, err = r.Query().User(ctx, "anonymous-name")
+			require.NoError(t, err)
+			assert.Equal(t, "anonymous-name", user.DisplayName)
 		})
 	})
 
@@ -62,22 +214,22 @@ func TestResolver(t *testing.T) {
 		r := setupResolver()
 		postID := uuid.NewString()
 		err := r.storage.CreatePost(ctx, &model.Post{
-			ID:            postID,
-			Title:         "Test Post",
-			Content:       "Content",
-			Author:        "Author",
-			AllowComments: true,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             postID,
+			Title:          "Test Post",
+			Content:        "Content",
+			AuthorID:       "Author",
+			ModerationMode: model.ModerationModeOpen,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		})
 		assert.NoError(t, err)
 
 		t.Run("ValidComment", func(t *testing.T) {
-			comment, err := r.Mutation().AddComment(ctx, postID, nil, "Jane", "Great post!")
+			comment, err := r.Mutation().AddComment(asUser(ctx, "Jane"), postID, nil, "Great post!")
 			assert.NoError(t, err)
 			assert.NotNil(t, comment)
 			assert.Equal(t, postID, comment.PostID)
 			assert.Nil(t, comment.ParentID)
-			assert.Equal(t, "Jane", comment.Author)
+			assert.Equal(t, "Jane", comment.AuthorID)
 			assert.Equal(t, "Great post!", comment.Text)
 			assert.NotEmpty(t, comment.ID)
 			assert.NotEmpty(t, comment.CreatedAt)
@@ -90,13 +242,13 @@ func TestResolver(t *testing.T) {
 
 		t.Run("TooLongComment", func(t *testing.T) {
 			tooLongText := string(make([]byte, 2001))
-			_, err := r.Mutation().AddComment(ctx, postID, nil, "Jane", tooLongText)
+			_, err := r.Mutation().AddComment(asUser(ctx, "Jane"), postID, nil, tooLongText)
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "comment too long")
 		})
 
 		t.Run("InvalidPostID", func(t *testing.T) {
-			_, err := r.Mutation().AddComment(ctx, "non-existent-post", nil, "Jane", "Comment")
+			_, err := r.Mutation().AddComment(asUser(ctx, "Jane"), "non-existent-post", nil, "Comment")
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "post not found")
 		})
@@ -104,74 +256,534 @@ func TestResolver(t *testing.T) {
 		t.Run("CommentsDisabled", func(t *testing.T) {
 			disabledPostID := uuid.NewString()
 			err := r.storage.CreatePost(ctx, &model.Post{
-				ID:            disabledPostID,
-				Title:         "No Comments",
-				Content:       "Content",
-				Author:        "Author",
-				AllowComments: false,
-				CreatedAt:     time.Now().Format(time.RFC3339),
+				ID:             disabledPostID,
+				Title:          "No Comments",
+				Content:        "Content",
+				AuthorID:       "Author",
+				ModerationMode: model.ModerationModeClosed,
+				CreatedAt:      time.Now().Format(time.RFC3339),
 			})
 			assert.NoError(t, err)
 
-			_, err = r.Mutation().AddComment(ctx, disabledPostID, nil, "Jane", "Comment")
+			_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), disabledPostID, nil, "Comment")
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "comments are not allowed")
 		})
 
 		t.Run("InvalidParentID", func(t *testing.T) {
 			invalidParentID := "non-existent-parent"
-			_, err := r.Mutation().AddComment(ctx, postID, &invalidParentID, "Jane", "Reply")
+			_, err := r.Mutation().AddComment(asUser(ctx, "Jane"), postID, &invalidParentID, "Reply")
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), "parent comment not found")
 		})
 
+		t.Run("ParentFromAnotherPost", func(t *testing.T) {
+			closed, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Closed", "Content", nil, nil, nil)
+			require.NoError(t, err)
+			parent, err := r.Mutation().AddComment(asUser(ctx, "Jane"), closed.ID, nil, "Parent")
+			require.NoError(t, err)
+			_, err = r.Mutation().SetModerationMode(asUser(ctx, "Author"), closed.ID, model.ModerationModeClosed)
+			require.NoError(t, err)
+
+			// Ответ через открытый пост не должен обходить закрытие комментариев
+			_, err = r.Mutation().AddComment(asUser(ctx, "Bob"), postID, &parent.ID, "Reply")
+			assert.ErrorIs(t, err, ErrValidation)
+			assert.Contains(t, err.Error(), "parent comment belongs to another post")
+			replies, err := r.storage.GetRepliesByCommentID(ctx, parent.ID, model.CommentOrderOldest, 10, 0, storage.Visibility{All: true})
+			require.NoError(t, err)
+			assert.Empty(t, replies)
+		})
+
 		t.Run("EmptyInput", func(t *testing.T) {
-			_, err := r.Mutation().AddComment(ctx, postID, nil, "", "Comment")
-			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "author and text must not be empty")
+			_, err := r.Mutation().AddComment(ctx, postID, nil, "Comment")
+			assert.ErrorIs(t, err, auth.ErrUnauthenticated)
 
-			_, err = r.Mutation().AddComment(ctx, postID, nil, "Jane", "")
+			_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), postID, nil, "")
 			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "author and text must not be empty")
+			assert.Contains(t, err.Error(), "text must not be empty")
 		})
 
 		t.Run("ValidReply", func(t *testing.T) {
-			parentComment, err := r.Mutation().AddComment(ctx, postID, nil, "Jane", "Parent comment")
+			parentComment, err := r.Mutation().AddComment(asUser(ctx, "Jane"), postID, nil, "Parent comment")
 			assert.NoError(t, err)
 
-			reply, err := r.Mutation().AddComment(ctx, postID, &parentComment.ID, "Bob", "Reply")
+			reply, err := r.Mutation().AddComment(asUser(ctx, "Bob"), postID, &parentComment.ID, "Reply")
 			assert.NoError(t, err)
 			assert.NotNil(t, reply)
 			assert.Equal(t, parentComment.ID, *reply.ParentID)
 		})
 	})
 
+	t.Run("UpdateAndDeletePost", func(t *testing.T) {
+		r := setupResolver()
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Title", "Content", nil, nil, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, post.UpdatedAt)
+
+		newTitle := "Fixed title"
+		disabled := false
+		author := asUser(ctx, "Author")
+		updated, err := r.Mutation().UpdatePost(author, post.ID, &newTitle, nil, &disabled, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "Fixed title", updated.Title)
+		assert.Equal(t, "Content", updated.Content)
+		assert.Equal(t, model.ModerationModeClosed, updated.ModerationMode)
+		assert.NotNil(t, updated.UpdatedAt)
+
+		fetched, err := r.Query().Post(ctx, post.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Fixed title", fetched.Title)
+
+		empty := ""
+		_, err = r.Mutation().UpdatePost(author, post.ID, &empty, nil, nil, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must not be empty")
+
+		_, err = r.Mutation().UpdatePost(author, "non-existent-id", &newTitle, nil, nil, nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "post not found")
+
+		// Чужой пост может менять только модератор
+		_, err = r.Mutation().UpdatePost(asUser(ctx, "Jane"), post.ID, &newTitle, nil, nil, nil)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = r.Mutation().DeletePost(asUser(ctx, "Jane"), post.ID)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = r.Mutation().UpdatePost(asModerator(ctx), post.ID, &newTitle, nil, nil, nil)
+		assert.NoError(t, err)
+
+		ok, err := r.Mutation().DeletePost(author, post.ID)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		_, err = r.Query().Post(ctx, post.ID)
+		assert.Error(t, err)
+
+		_, err = r.Mutation().DeletePost(author, post.ID)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "post not found")
+	})
+
+	t.Run("EditAndDeleteComment", func(t *testing.T) {
+		r := setupResolver()
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Title", "Content", nil, nil, nil)
+		assert.NoError(t, err)
+		parent, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Typo")
+		assert.NoError(t, err)
+		reply, err := r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &parent.ID, "Reply")
+		assert.NoError(t, err)
+		sibling, err := r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, nil, "Sibling")
+		assert.NoError(t, err)
+
+		jane := asUser(ctx, "Jane")
+		_, err = r.Mutation().EditComment(asUser(ctx, "Bob"), parent.ID, "Hijacked")
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = r.Mutation().DeleteComment(asUser(ctx, "Bob"), parent.ID)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+
+		edited, err := r.Mutation().EditComment(jane, parent.ID, "Fixed")
+		assert.NoError(t, err)
+		assert.Equal(t, "Fixed", edited.Text)
+		assert.NotNil(t, edited.EditedAt)
+		fetched, err := r.Query().Comment(ctx, parent.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Fixed", fetched.Text)
+
+		_, err = r.Mutation().EditComment(jane, parent.ID, "")
+		assert.Error(t, err)
+		_, err = r.Mutation().EditComment(jane, parent.ID, string(make([]byte, 2001)))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "comment too long")
+
+		// Удалённый комментарий становится надгробием, ответы остаются доступны
+		ok, err := r.Mutation().DeleteComment(jane, parent.ID)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		var resp struct {
+			Comment struct {
+				Author *struct {
+					DisplayName string
+				}
+				Text      string
+				IsDeleted bool
+				DeletedAt *string
+				Replies   []struct {
+					ID   string
+					Text string
+				}
+			}
+		}
+		newTestClient(r).MustPost(`query($id: ID!) { comment(id: $id) { author { displayName } text isDeleted deletedAt replies { id text } } }`,
+			&resp, client.Var("id", parent.ID))
+		assert.True(t, resp.Comment.IsDeleted)
+		assert.NotNil(t, resp.Comment.DeletedAt)
+		assert.Nil(t, resp.Comment.Author)
+		assert.Equal(t, "[deleted]", resp.Comment.Text)
+		require.Len(t, resp.Comment.Replies, 1)
+		assert.Equal(t, reply.ID, resp.Comment.Replies[0].ID)
+		assert.Equal(t, "Reply", resp.Comment.Replies[0].Text)
+
+		_, err = r.Query().Comment(ctx, sibling.ID)
+		assert.NoError(t, err)
+
+		_, err = r.Mutation().EditComment(jane, parent.ID, "Resurrected")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "comment is deleted")
+		_, err = r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &parent.ID, "Late reply")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "deleted comment")
+
+		_, err = r.Mutation().DeleteComment(jane, parent.ID)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "comment not found")
+	})
+
+	t.Run("CommentRevisions", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Title", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		comment, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "First")
+		require.NoError(t, err)
+
+		_, err = r.Mutation().EditComment(asUser(ctx, "Jane"), comment.ID, "Second")
+		require.NoError(t, err)
+		_, err = r.Mutation().EditComment(asModerator(ctx), comment.ID, "Third")
+		require.NoError(t, err)
+
+		var resp struct {
+			Comment struct {
+				Text      string
+				EditCount int
+				Revisions []struct {
+					Text   string
+					Editor struct {
+						ID          string
+						DisplayName string
+					}
+					EditedAt string
+				}
+			}
+		}
+		query := `query($id: ID!) { comment(id: $id) { text editCount revisions { text editor { id displayName } editedAt } } }`
+		c.MustPost(query, &resp, client.Var("id", comment.ID), as("Moderator", model.RoleModerator))
+		assert.Equal(t, "Third", resp.Comment.Text)
+		assert.Equal(t, 2, resp.Comment.EditCount)
+		require.Len(t, resp.Comment.Revisions, 2)
+		assert.Equal(t, "First", resp.Comment.Revisions[0].Text)
+		assert.Equal(t, "Jane", resp.Comment.Revisions[0].Editor.ID)
+		assert.NotEmpty(t, resp.Comment.Revisions[0].EditedAt)
+		assert.Equal(t, "Second", resp.Comment.Revisions[1].Text)
+		// Модератор, ни разу не писавший, заводится пользователем при первой правке
+		assert.Equal(t, "Moderator", resp.Comment.Revisions[1].Editor.ID)
+		assert.NotEmpty(t, resp.Comment.Revisions[1].Editor.DisplayName)
+
+		// История - инструмент модерации, число правок видно всем
+		err = c.Post(query, &resp, client.Var("id", comment.ID), as("Jane", model.RoleReader))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "moderator role required")
+		c.MustPost(`query($id: ID!) { comment(id: $id) { editCount } }`, &resp, client.Var("id", comment.ID))
+		assert.Equal(t, 2, resp.Comment.EditCount)
+
+		// У удалённого комментария история скрыта вместе с текстом
+		_, err = r.Mutation().DeleteComment(asModerator(ctx), comment.ID)
+		require.NoError(t, err)
+		c.MustPost(query, &resp, client.Var("id", comment.ID), as("Moderator", model.RoleModerator))
+		assert.Empty(t, resp.Comment.Revisions)
+		assert.Equal(t, 0, resp.Comment.EditCount)
+	})
+
+	t.Run("BatchedEditCount", func(t *testing.T) {
+		store := &countingStorage{Storage: newTestStorage()}
+		r := NewResolver(store)
+		c := newTestClient(r)
+
+		for i := 0; i < 3; i++ {
+			post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), fmt.Sprintf("Post %d", i), "Content", nil, nil, nil)
+			require.NoError(t, err)
+			for j := 0; j < 3; j++ {
+				comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Comment")
+				require.NoError(t, err)
+				_, err = r.Mutation().EditComment(asUser(ctx, "User"), comment.ID, "Edited")
+				require.NoError(t, err)
+			}
+		}
+
+		var resp struct {
+			Posts struct {
+				Edges []struct {
+					Node struct {
+						Comments []struct {
+							EditCount int
+						}
+					}
+				}
+			}
+		}
+		c.MustPost(`{ posts { edges { node { comments { editCount } } } } }`, &resp)
+
+		require.Len(t, resp.Posts.Edges, 3)
+		for _, e := range resp.Posts.Edges {
+			require.Len(t, e.Node.Comments, 3)
+			for _, c := range e.Node.Comments {
+				assert.Equal(t, 1, c.EditCount)
+			}
+		}
+		// Один запрос на все комментарии вместо запроса на каждый
+		assert.Equal(t, int32(1), store.revisions.Load())
+	})
+
+	t.Run("BatchedReactions", func(t *testing.T) {
+		store := &countingStorage{Storage: newTestStorage()}
+		r := NewResolver(store)
+		c := newTestClient(r)
+
+		for i := 0; i < 3; i++ {
+			post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), fmt.Sprintf("Post %d", i), "Content", nil, nil, nil)
+			require.NoError(t, err)
+			_, err = r.Mutation().React(asUser(ctx, "User"), post.ID, "🎉")
+			require.NoError(t, err)
+			for j := 0; j < 3; j++ {
+				comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Comment")
+				require.NoError(t, err)
+				if j == 0 {
+					_, err = r.Mutation().React(asUser(ctx, "Author"), comment.ID, "👍")
+					require.NoError(t, err)
+				}
+			}
+		}
+		store.reactions.Store(0)
+
+		type reaction struct {
+			Emoji         string
+			Count         int
+			ViewerReacted bool
+		}
+		var resp struct {
+			Posts struct {
+				Edges []struct {
+					Node struct {
+						Reactions []reaction
+						Comments  []struct {
+							Reactions []reaction
+						}
+					}
+				}
+			}
+		}
+		c.MustPost(`{ posts { edges { node { reactions { emoji count viewerReacted } comments { reactions { emoji count viewerReacted } } } } } }`, &resp, as("User", model.RoleReader))
+
+		require.Len(t, resp.Posts.Edges, 3)
+		for _, e := range resp.Posts.Edges {
+			assert.Equal(t, []reaction{{Emoji: "🎉", Count: 1, ViewerReacted: true}}, e.Node.Reactions)
+			require.Len(t, e.Node.Comments, 3)
+			assert.Equal(t, []reaction{{Emoji: "👍", Count: 1}}, e.Node.Comments[0].Reactions)
+			assert.Empty(t, e.Node.Comments[1].Reactions)
+			assert.NotNil(t, e.Node.Comments[1].Reactions)
+		}
+		// Один запрос на посты и один на все комментарии
+		assert.Equal(t, int32(2), store.reactions.Load())
+	})
+
+	t.Run("BatchedCommentPaths", func(t *testing.T) {
+		store := &countingStorage{Storage: newTestStorage()}
+		r := NewResolver(store)
+		c := newTestClient(r)
+
+		for i := 0; i < 3; i++ {
+			post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), fmt.Sprintf("Post %d", i), "Content", nil, nil, nil)
+			require.NoError(t, err)
+			for j := 0; j < 3; j++ {
+				comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Comment")
+				require.NoError(t, err)
+				_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &comment.ID, "Reply")
+				require.NoError(t, err)
+			}
+		}
+
+		var resp struct {
+			Posts struct {
+				Edges []struct {
+					Node struct {
+						Comments []struct {
+							ID              string
+							DescendantCount int
+							Replies         []struct {
+								DescendantCount int
+								Ancestors       []struct{ ID string }
+							}
+						}
+					}
+				}
+			}
+		}
+		c.MustPost(`{ posts { edges { node { comments { id descendantCount replies { descendantCount ancestors { id } } } } } } }`, &resp)
+
+		require.Len(t, resp.Posts.Edges, 3)
+		for _, e := range resp.Posts.Edges {
+			require.Len(t, e.Node.Comments, 3)
+			for _, c := range e.Node.Comments {
+				assert.Equal(t, 1, c.DescendantCount)
+				require.Len(t, c.Replies, 1)
+				assert.Zero(t, c.Replies[0].DescendantCount)
+				require.Len(t, c.Replies[0].Ancestors, 1)
+				assert.Equal(t, c.ID, c.Replies[0].Ancestors[0].ID)
+			}
+		}
+		// По запросу на уровень для descendantCount и один для ancestors
+		assert.Equal(t, int32(3), store.paths.Load())
+	})
+
+	t.Run("SetCommentsEnabled", func(t *testing.T) {
+		r := setupResolver()
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Title", "Content", nil, nil, nil)
+		require.NoError(t, err)
+
+		updated, err := r.Mutation().SetCommentsEnabled(asUser(ctx, "Author"), post.ID, false)
+		require.NoError(t, err)
+		assert.Equal(t, model.ModerationModeClosed, updated.ModerationMode)
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Comment")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "comments are not allowed")
+
+		_, err = r.Mutation().SetCommentsEnabled(asUser(ctx, "Author"), post.ID, true)
+		require.NoError(t, err)
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Comment")
+		assert.NoError(t, err)
+	})
+
+	t.Run("LockThread", func(t *testing.T) {
+		r := setupResolver()
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Title", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		root, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Root")
+		require.NoError(t, err)
+		child, err := r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &root.ID, "Child")
+		require.NoError(t, err)
+		other, err := r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, nil, "Other")
+		require.NoError(t, err)
+
+		locked, err := r.Mutation().LockThread(ctx, root.ID)
+		require.NoError(t, err)
+		assert.True(t, locked.Locked)
+
+		// Заблокировано всё поддерево, остальной пост открыт
+		_, err = r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &root.ID, "Reply")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "thread is locked")
+		_, err = r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &child.ID, "Deep reply")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "thread is locked")
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, &other.ID, "Allowed")
+		assert.NoError(t, err)
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Top level")
+		assert.NoError(t, err)
+
+		// Править комментарии в заблокированной ветке может только модератор
+		_, err = r.Mutation().EditComment(asUser(ctx, "Bob"), child.ID, "Edited")
+		assert.ErrorIs(t, err, storage.ErrConflict)
+		assert.Contains(t, err.Error(), "thread is locked")
+		_, err = r.Mutation().EditComment(asModerator(ctx), child.ID, "Edited")
+		assert.NoError(t, err)
+
+		unlocked, err := r.Mutation().UnlockThread(ctx, root.ID)
+		require.NoError(t, err)
+		assert.False(t, unlocked.Locked)
+		_, err = r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &child.ID, "Deep reply")
+		assert.NoError(t, err)
+
+		_, err = r.Mutation().LockThread(ctx, "non-existent-id")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "comment not found")
+	})
+
 	t.Run("Posts", func(t *testing.T) {
 		r := setupResolver()
 
 		// Создаем два поста
-		post1, err := r.Mutation().CreatePost(ctx, "Post 1", "Content 1", "Author 1", true)
+		post1, err := r.Mutation().CreatePost(asUser(ctx, "Author 1"), "Post 1", "Content 1", nil, nil, nil)
 		assert.NoError(t, err)
-		post2, err := r.Mutation().CreatePost(ctx, "Post 2", "Content 2", "Author 2", false)
+		post2, err := r.Mutation().CreatePost(asUser(ctx, "Author 2"), "Post 2", "Content 2", nil, moderationMode(model.ModerationModeClosed), nil)
 		assert.NoError(t, err)
 
-		posts, err := r.Query().Posts(ctx)
+		posts, err := r.Query().Posts(ctx, nil, nil, nil, nil)
 		assert.NoError(t, err)
-		assert.Len(t, posts, 2)
-		assert.Contains(t, []string{post1.ID, post2.ID}, posts[0].ID)
-		assert.Contains(t, []string{post1.ID, post2.ID}, posts[1].ID)
+		require.Len(t, posts.Edges, 2)
+		assert.Equal(t, post2.ID, posts.Edges[0].Node.ID)
+		assert.Equal(t, post1.ID, posts.Edges[1].Node.ID)
 
 		// Пустое хранилище
 		emptyR := setupResolver()
-		posts, err = emptyR.Query().Posts(ctx)
+		posts, err = emptyR.Query().Posts(ctx, nil, nil, nil, nil)
 		assert.NoError(t, err)
-		assert.Empty(t, posts)
+		assert.Empty(t, posts.Edges)
+	})
+
+	t.Run("PostsFilterAndOrder", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		alice1, err := r.Mutation().CreatePost(asUser(ctx, "alice"), "Alice 1", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		alice2, err := r.Mutation().CreatePost(asUser(ctx, "alice"), "Alice 2", "Content", nil, moderationMode(model.ModerationModeClosed), nil)
+		require.NoError(t, err)
+		bob, err := r.Mutation().CreatePost(asUser(ctx, "bob"), "Bob", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		_, err = r.Mutation().VotePost(asUser(ctx, "Jane"), alice1.ID, 1)
+		require.NoError(t, err)
+		_, err = r.Mutation().VotePost(asUser(ctx, "Jane"), bob.ID, -1)
+		require.NoError(t, err)
+
+		author := "alice"
+		posts, err := r.Query().Posts(ctx, &model.PostFilter{AuthorID: &author}, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, posts.Edges, 2)
+		assert.Equal(t, alice2.ID, posts.Edges[0].Node.ID)
+
+		allow := true
+		posts, err = r.Query().Posts(ctx, &model.PostFilter{AuthorID: &author, AllowComments: &allow}, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, posts.Edges, 1)
+		assert.Equal(t, alice1.ID, posts.Edges[0].Node.ID)
+
+		posts, err = r.Query().Posts(ctx, &model.PostFilter{CreatedAfter: &alice1.CreatedAt, CreatedBefore: &bob.CreatedAt}, nil, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, posts.Edges, 1)
+		assert.Equal(t, alice2.ID, posts.Edges[0].Node.ID)
+
+		// TOP по страницам: курсор несёт счёт поста
+		var resp struct {
+			Posts struct {
+				Edges    []struct{ Node struct{ Title string } }
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			}
+		}
+		query := `query($after: String) { posts(orderBy: TOP, first: 2, after: $after) { edges { node { title } } pageInfo { hasNextPage endCursor } } }`
+		c.MustPost(query, &resp, client.Var("after", nil))
+		require.Len(t, resp.Posts.Edges, 2)
+		assert.Equal(t, "Alice 1", resp.Posts.Edges[0].Node.Title)
+		assert.Equal(t, "Alice 2", resp.Posts.Edges[1].Node.Title)
+		assert.True(t, resp.Posts.PageInfo.HasNextPage)
+		topCursor := resp.Posts.PageInfo.EndCursor
+		c.MustPost(query, &resp, client.Var("after", topCursor))
+		require.Len(t, resp.Posts.Edges, 1)
+		assert.Equal(t, "Bob", resp.Posts.Edges[0].Node.Title)
+		assert.False(t, resp.Posts.PageInfo.HasNextPage)
+
+		// Курсор другого порядка и неверная граница по времени отклоняются
+		_, err = r.Query().Posts(ctx, nil, nil, nil, &topCursor)
+		assert.ErrorIs(t, err, storage.ErrInvalidCursor)
+		bad := "yesterday"
+		_, err = r.Query().Posts(ctx, &model.PostFilter{CreatedAfter: &bad}, nil, nil, nil)
+		assert.ErrorIs(t, err, ErrValidation)
 	})
 
 	t.Run("Post", func(t *testing.T) {
 		r := setupResolver()
 
-		post, err := r.Mutation().CreatePost(ctx, "Test Post", "Content", "Author", true)
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Test Post", "Content", nil, nil, nil)
 		assert.NoError(t, err)
 
 		fetchedPost, err := r.Query().Post(ctx, post.ID)
@@ -179,8 +791,8 @@ func TestResolver(t *testing.T) {
 		assert.Equal(t, post.ID, fetchedPost.ID)
 		assert.Equal(t, "Test Post", fetchedPost.Title)
 		assert.Equal(t, "Content", fetchedPost.Content)
-		assert.Equal(t, "Author", fetchedPost.Author)
-		assert.True(t, fetchedPost.AllowComments)
+		assert.Equal(t, "Author", fetchedPost.AuthorID)
+		assert.Equal(t, model.ModerationModeOpen, fetchedPost.ModerationMode)
 
 		_, err = r.Query().Post(ctx, "non-existent-id")
 		assert.Error(t, err)
@@ -191,22 +803,22 @@ func TestResolver(t *testing.T) {
 		r := setupResolver()
 		postID := uuid.NewString()
 		err := r.storage.CreatePost(ctx, &model.Post{
-			ID:            postID,
-			Title:         "Test Post",
-			Content:       "Content",
-			Author:        "Author",
-			AllowComments: true,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             postID,
+			Title:          "Test Post",
+			Content:        "Content",
+			AuthorID:       "Author",
+			ModerationMode: model.ModerationModeOpen,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		})
 		assert.NoError(t, err)
 
-		comment, err := r.Mutation().AddComment(ctx, postID, nil, "Jane", "Comment")
+		comment, err := r.Mutation().AddComment(asUser(ctx, "Jane"), postID, nil, "Comment")
 		assert.NoError(t, err)
 
 		fetchedComment, err := r.Query().Comment(ctx, comment.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, comment.ID, fetchedComment.ID)
-		assert.Equal(t, "Jane", fetchedComment.Author)
+		assert.Equal(t, "Jane", fetchedComment.AuthorID)
 		assert.Equal(t, "Comment", fetchedComment.Text)
 		assert.Equal(t, postID, fetchedComment.PostID)
 
@@ -222,12 +834,12 @@ func TestResolver(t *testing.T) {
 
 		postID := uuid.NewString()
 		err := r.storage.CreatePost(ctx, &model.Post{
-			ID:            postID,
-			Title:         "Test Post",
-			Content:       "Content",
-			Author:        "Author",
-			AllowComments: true,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             postID,
+			Title:          "Test Post",
+			Content:        "Content",
+			AuthorID:       "Author",
+			ModerationMode: model.ModerationModeOpen,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		})
 		assert.NoError(t, err)
 
@@ -239,7 +851,7 @@ func TestResolver(t *testing.T) {
 
 		// Добавляем комментарий
 		go func() {
-			_, err := r.Mutation().AddComment(ctx, postID, nil, "Jane", "Subscribed comment")
+			_, err := r.Mutation().AddComment(asUser(ctx, "Jane"), postID, nil, "Subscribed comment")
 			assert.NoError(t, err)
 		}()
 
@@ -247,7 +859,7 @@ func TestResolver(t *testing.T) {
 		select {
 		case comment := <-commentChan1:
 			assert.Equal(t, postID, comment.PostID)
-			assert.Equal(t, "Jane", comment.Author)
+			assert.Equal(t, "Jane", comment.AuthorID)
 			assert.Equal(t, "Subscribed comment", comment.Text)
 		case <-time.After(time.Second):
 			t.Fatal("Did not receive comment in channel 1")
@@ -256,7 +868,7 @@ func TestResolver(t *testing.T) {
 		select {
 		case comment := <-commentChan2:
 			assert.Equal(t, postID, comment.PostID)
-			assert.Equal(t, "Jane", comment.Author)
+			assert.Equal(t, "Jane", comment.AuthorID)
 			assert.Equal(t, "Subscribed comment", comment.Text)
 		case <-time.After(time.Second):
 			t.Fatal("Did not receive comment in channel 2")
@@ -274,23 +886,23 @@ func TestResolver(t *testing.T) {
 		r := setupResolver()
 		postID := uuid.NewString()
 		err := r.storage.CreatePost(ctx, &model.Post{
-			ID:            postID,
-			Title:         "Test Post",
-			Content:       "Content",
-			Author:        "Author",
-			AllowComments: true,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             postID,
+			Title:          "Test Post",
+			Content:        "Content",
+			AuthorID:       "Author",
+			ModerationMode: model.ModerationModeOpen,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		})
 		assert.NoError(t, err)
 
 		// Добавляем 10 комментариев
 		for i := 0; i < 10; i++ {
-			_, err := r.Mutation().AddComment(ctx, postID, nil, "User", fmt.Sprintf("Comment %d", i))
+			_, err := r.Mutation().AddComment(asUser(ctx, "User"), postID, nil, fmt.Sprintf("Comment %d", i))
 			assert.NoError(t, err)
 		}
 
 		// Первые 5 комментариев
-		comments, err := r.storage.GetCommentsByPostID(ctx, postID, 5, 0)
+		comments, err := r.storage.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 5, 0, storage.Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, comments, 5)
 		for i, c := range comments {
@@ -298,7 +910,7 @@ func TestResolver(t *testing.T) {
 		}
 
 		// Следующие 5 комментариев
-		comments, err = r.storage.GetCommentsByPostID(ctx, postID, 5, 5)
+		comments, err = r.storage.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 5, 5, storage.Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, comments, 5)
 		for i, c := range comments {
@@ -306,12 +918,12 @@ func TestResolver(t *testing.T) {
 		}
 
 		// За пределами
-		comments, err = r.storage.GetCommentsByPostID(ctx, postID, 5, 10)
+		comments, err = r.storage.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 5, 10, storage.Visibility{})
 		assert.NoError(t, err)
 		assert.Empty(t, comments)
 
 		// Несуществующий пост
-		comments, err = r.storage.GetCommentsByPostID(ctx, "non-existent-post", 5, 0)
+		comments, err = r.storage.GetCommentsByPostID(ctx, "non-existent-post", model.CommentOrderOldest, 5, 0, storage.Visibility{})
 		assert.NoError(t, err)
 		assert.Empty(t, comments)
 	})
@@ -320,12 +932,12 @@ func TestResolver(t *testing.T) {
 		r := setupResolver()
 		postID := uuid.NewString()
 		err := r.storage.CreatePost(ctx, &model.Post{
-			ID:            postID,
-			Title:         "Test Post",
-			Content:       "Content",
-			Author:        "Author",
-			AllowComments: true,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             postID,
+			Title:          "Test Post",
+			Content:        "Content",
+			AuthorID:       "Author",
+			ModerationMode: model.ModerationModeOpen,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		})
 		assert.NoError(t, err)
 
@@ -338,7 +950,7 @@ func TestResolver(t *testing.T) {
 			wg.Add(1)
 			go func(i int) {
 				defer wg.Done()
-				comment, err := r.Mutation().AddComment(ctx, postID, nil, "User", fmt.Sprintf("Comment %d", i))
+				comment, err := r.Mutation().AddComment(asUser(ctx, "User"), postID, nil, fmt.Sprintf("Comment %d", i))
 				assert.NoError(t, err)
 				mu.Lock()
 				commentIDs[comment.ID] = true
@@ -347,9 +959,1136 @@ func TestResolver(t *testing.T) {
 		}
 		wg.Wait()
 
-		comments, err := r.storage.GetCommentsByPostID(ctx, postID, commentCount, 0)
+		comments, err := r.storage.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, commentCount, 0, storage.Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, comments, commentCount)
 		assert.Len(t, commentIDs, commentCount) // Проверяем уникальность ID
 	})
+
+	t.Run("NestedCommentsQuery", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+
+		var parents []*model.Comment
+		for i := 0; i < 3; i++ {
+			comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, fmt.Sprintf("Comment %d", i))
+			require.NoError(t, err)
+			parents = append(parents, comment)
+		}
+		for i := 0; i < 3; i++ {
+			_, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &parents[0].ID, fmt.Sprintf("Reply %d", i))
+			require.NoError(t, err)
+		}
+
+		type commentResp struct {
+			ID      string
+			Text    string
+			Replies []struct {
+				Text string
+			}
+		}
+		var resp struct {
+			Post struct {
+				ID       string
+				Comments []commentResp
+			}
+		}
+
+		query := `query($id: ID!) {
+			post(id: $id) {
+				id
+				comments(limit: 2, offset: 0) {
+					id
+					text
+					replies(limit: 2, offset: 1) { text }
+				}
+			}
+		}`
+		c.MustPost(query, &resp, client.Var("id", post.ID))
+
+		assert.Equal(t, post.ID, resp.Post.ID)
+		require.Len(t, resp.Post.Comments, 2)
+		assert.Equal(t, "Comment 0", resp.Post.Comments[0].Text)
+		assert.Equal(t, "Comment 1", resp.Post.Comments[1].Text)
+		require.Len(t, resp.Post.Comments[0].Replies, 2)
+		assert.Equal(t, "Reply 1", resp.Post.Comments[0].Replies[0].Text)
+		assert.Equal(t, "Reply 2", resp.Post.Comments[0].Replies[1].Text)
+		assert.Empty(t, resp.Post.Comments[1].Replies)
+
+		// Значения по умолчанию из схемы
+		var defResp struct {
+			Comment struct {
+				Replies []struct {
+					Text string
+				}
+			}
+		}
+		c.MustPost(`query($id: ID!) { comment(id: $id) { replies { text } } }`, &defResp, client.Var("id", parents[0].ID))
+		assert.Len(t, defResp.Comment.Replies, 3)
+
+		// Отрицательные значения отклоняются
+		err = c.Post(`query($id: ID!) { post(id: $id) { comments(limit: -1) { id } } }`, &resp, client.Var("id", post.ID))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must not be negative")
+	})
+
+	t.Run("BatchedNestedQuery", func(t *testing.T) {
+		store := &countingStorage{Storage: newTestStorage()}
+		r := NewResolver(store)
+		c := newTestClient(r)
+
+		for i := 0; i < 3; i++ {
+			post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), fmt.Sprintf("Post %d", i), "Content", nil, nil, nil)
+			require.NoError(t, err)
+			for j := 0; j < 3; j++ {
+				comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Comment")
+				require.NoError(t, err)
+				reply, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &comment.ID, "Reply")
+				require.NoError(t, err)
+				_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &reply.ID, "Nested reply")
+				require.NoError(t, err)
+			}
+		}
+
+		var resp struct {
+			Posts struct {
+				Edges []struct {
+					Node struct {
+						Comments []struct {
+							Replies []struct {
+								Replies []struct {
+									Text string
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+		c.MustPost(`{ posts { edges { node { comments { replies { replies { text } } } } } } }`, &resp)
+
+		require.Len(t, resp.Posts.Edges, 3)
+		for _, e := range resp.Posts.Edges {
+			require.Len(t, e.Node.Comments, 3)
+			for _, c := range e.Node.Comments {
+				require.Len(t, c.Replies, 1)
+				require.Len(t, c.Replies[0].Replies, 1)
+				assert.Equal(t, "Nested reply", c.Replies[0].Replies[0].Text)
+			}
+		}
+		// По одному пакетному запросу на каждый уровень дерева
+		assert.Equal(t, int32(0), store.single.Load())
+		assert.Equal(t, int32(3), store.batch.Load())
+	})
+
+	t.Run("CommentTree", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		parent, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Level 0")
+		require.NoError(t, err)
+		for i := 1; i <= 4; i++ {
+			parent, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &parent.ID, fmt.Sprintf("Level %d", i))
+			require.NoError(t, err)
+		}
+
+		var resp struct {
+			Post struct {
+				CommentTree []struct {
+					Comment  struct{ Text string }
+					Children []struct {
+						Depth      int
+						ReplyCount int
+						Children   []struct{ Depth int }
+					}
+				}
+			}
+		}
+		c.MustPost(`query($id: ID!) {
+			post(id: $id) {
+				commentTree(maxDepth: 1) {
+					comment { text }
+					children { depth replyCount children { depth } }
+				}
+			}
+		}`, &resp, client.Var("id", post.ID))
+		require.Len(t, resp.Post.CommentTree, 1)
+		root := resp.Post.CommentTree[0]
+		assert.Equal(t, "Level 0", root.Comment.Text)
+		require.Len(t, root.Children, 1)
+		assert.Equal(t, 1, root.Children[0].Depth)
+		assert.Equal(t, 1, root.Children[0].ReplyCount)
+		assert.Empty(t, root.Children[0].Children)
+
+		var subResp struct {
+			Comment struct {
+				Subtree struct {
+					Comment    struct{ Text string }
+					ReplyCount int
+					Children   []struct{ Depth int }
+				}
+			}
+		}
+		c.MustPost(`query($id: ID!) { comment(id: $id) { subtree(maxDepth: 1) { comment { text } replyCount children { depth } } } }`,
+			&subResp, client.Var("id", parent.ID))
+		assert.Equal(t, "Level 4", subResp.Comment.Subtree.Comment.Text)
+		assert.Equal(t, 0, subResp.Comment.Subtree.ReplyCount)
+		assert.Empty(t, subResp.Comment.Subtree.Children)
+
+		err = c.Post(`query($id: ID!) { post(id: $id) { commentTree(maxDepth: 100) { depth } } }`, &resp, client.Var("id", post.ID))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "maxDepth must not exceed")
+	})
+
+	t.Run("CommentPaths", func(t *testing.T) {
+		r := setupResolver()
+		r.SetMaxCommentDepth(2)
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		root, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Root")
+		require.NoError(t, err)
+		child, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &root.ID, "Child")
+		require.NoError(t, err)
+		leaf, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &child.ID, "Leaf")
+		require.NoError(t, err)
+
+		var resp struct {
+			Comment struct {
+				Depth     int
+				Ancestors []struct {
+					Text            string
+					DescendantCount int
+				}
+			}
+		}
+		c.MustPost(`query($id: ID!) { comment(id: $id) { depth ancestors { text descendantCount } } }`, &resp, client.Var("id", leaf.ID))
+		assert.Equal(t, 2, resp.Comment.Depth)
+		require.Len(t, resp.Comment.Ancestors, 2)
+		assert.Equal(t, "Root", resp.Comment.Ancestors[0].Text)
+		assert.Equal(t, 2, resp.Comment.Ancestors[0].DescendantCount)
+		assert.Equal(t, "Child", resp.Comment.Ancestors[1].Text)
+
+		// Скрытый ответ читатели в descendantCount не видят, модераторы видят
+		hidden, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &root.ID, "Hidden")
+		require.NoError(t, err)
+		_, err = r.Mutation().HideComment(asModerator(ctx), hidden.ID)
+		require.NoError(t, err)
+		countQuery := `query($id: ID!) { comment(id: $id) { descendantCount } }`
+		var count struct{ Comment struct{ DescendantCount int } }
+		c.MustPost(countQuery, &count, client.Var("id", root.ID), as("Bob", model.RoleReader))
+		assert.Equal(t, 2, count.Comment.DescendantCount)
+		c.MustPost(countQuery, &count, client.Var("id", root.ID), as("Moderator", model.RoleModerator))
+		assert.Equal(t, 3, count.Comment.DescendantCount)
+
+		_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &leaf.ID, "Too deep")
+		assert.ErrorIs(t, err, ErrValidation)
+		assert.EqualError(t, err, "maximum nesting depth of 2 reached")
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		root, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Root")
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &root.ID, fmt.Sprintf("Reply %d", i))
+			require.NoError(t, err)
+		}
+		_, err = r.Mutation().DeleteComment(asUser(ctx, "User"), root.ID)
+		require.NoError(t, err)
+
+		var resp struct {
+			Post struct {
+				CommentCount         int
+				TopLevelCommentCount int
+				Comments             []struct{ ReplyCount int }
+			}
+		}
+		c.MustPost(`query($id: ID!) { post(id: $id) { commentCount topLevelCommentCount comments { replyCount } } }`, &resp, client.Var("id", post.ID))
+		assert.Equal(t, 2, resp.Post.CommentCount)
+		assert.Equal(t, 0, resp.Post.TopLevelCommentCount)
+		require.Len(t, resp.Post.Comments, 1)
+		assert.Equal(t, 2, resp.Post.Comments[0].ReplyCount)
+	})
+
+	t.Run("CommentOrder", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		var comments []*model.Comment
+		for i := 0; i < 3; i++ {
+			comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, fmt.Sprintf("Comment %d", i))
+			require.NoError(t, err)
+			comments = append(comments, comment)
+		}
+		_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &comments[1].ID, "Reply")
+		require.NoError(t, err)
+
+		var resp struct {
+			Post struct {
+				Oldest      []struct{ Text string }
+				MostReplies []struct{ Text string }
+			}
+		}
+		c.MustPost(`query($id: ID!) {
+			post(id: $id) {
+				oldest: comments { text }
+				mostReplies: comments(orderBy: MOST_REPLIES, limit: 2) { text }
+			}
+		}`, &resp, client.Var("id", post.ID))
+		require.Len(t, resp.Post.Oldest, 3)
+		assert.Equal(t, "Comment 0", resp.Post.Oldest[0].Text)
+		require.Len(t, resp.Post.MostReplies, 2)
+		assert.Equal(t, "Comment 1", resp.Post.MostReplies[0].Text)
+		assert.Equal(t, "Comment 0", resp.Post.MostReplies[1].Text)
+	})
+
+	t.Run("VotesAndReactions", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		first, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "First")
+		require.NoError(t, err)
+		second, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Second")
+		require.NoError(t, err)
+
+		alice, bob := asUser(ctx, "alice"), asUser(ctx, "bob")
+		voted, err := r.Mutation().VoteComment(alice, second.ID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), voted.Score)
+		// Повторный голос того же пользователя заменяет прежний
+		voted, err = r.Mutation().VoteComment(alice, second.ID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), voted.Score)
+		_, err = r.Mutation().VoteComment(alice, second.ID, 2)
+		assert.ErrorIs(t, err, ErrValidation)
+		_, err = r.Mutation().VoteComment(ctx, second.ID, 1)
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+		votedPost, err := r.Mutation().VotePost(alice, post.ID, -1)
+		require.NoError(t, err)
+		assert.Equal(t, int32(-1), votedPost.Score)
+
+		reactions, err := r.Mutation().React(alice, first.ID, "👍")
+		require.NoError(t, err)
+		require.Len(t, reactions, 1)
+		assert.True(t, reactions[0].ViewerReacted)
+		_, err = r.Mutation().React(bob, post.ID, "🎉")
+		require.NoError(t, err)
+		_, err = r.Mutation().React(bob, "non-existent-id", "🎉")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = r.Mutation().React(ctx, post.ID, "🎉")
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+		var resp struct {
+			Post struct {
+				Score     int
+				Reactions []struct {
+					Emoji         string
+					Count         int
+					ViewerReacted bool
+				}
+				Comments []struct {
+					Text      string
+					Score     int
+					Reactions []struct{ Emoji string }
+				}
+			}
+		}
+		query := `query($id: ID!) {
+			post(id: $id) {
+				score
+				reactions { emoji count viewerReacted }
+				comments(orderBy: TOP) { text score reactions { emoji } }
+			}
+		}`
+		c.MustPost(query, &resp, client.Var("id", post.ID), as("bob", model.RoleReader))
+		assert.Equal(t, -1, resp.Post.Score)
+		require.Len(t, resp.Post.Reactions, 1)
+		assert.True(t, resp.Post.Reactions[0].ViewerReacted)
+		c.MustPost(query, &resp, client.Var("id", post.ID))
+		assert.False(t, resp.Post.Reactions[0].ViewerReacted)
+
+		// Голоса и реакции требуют токена
+		var ignored map[string]any
+		err = c.Post(`mutation($id: ID!) { votePost(postID: $id, value: 1) { score } }`, &ignored, client.Var("id", post.ID))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "authentication required")
+		require.Len(t, resp.Post.Comments, 2)
+		assert.Equal(t, "Second", resp.Post.Comments[0].Text)
+		assert.Equal(t, 1, resp.Post.Comments[0].Score)
+		require.Len(t, resp.Post.Comments[1].Reactions, 1)
+		assert.Equal(t, "👍", resp.Post.Comments[1].Reactions[0].Emoji)
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, []string{" Go ", "go", "GraphQL"})
+		require.NoError(t, err)
+		other, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Other", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		_, err = r.Mutation().SetPostTags(asUser(ctx, "Author"), other.ID, []string{"go"})
+		require.NoError(t, err)
+
+		var resp struct {
+			Posts struct {
+				Edges []struct {
+					Node struct {
+						Title string
+						Tags  []string
+					}
+				}
+			}
+			Tags []struct {
+				Name      string
+				PostCount int
+			}
+		}
+		c.MustPost(`{
+			posts(filter: {tag: "GRAPHQL"}) { edges { node { title tags } } }
+			tags { name postCount }
+		}`, &resp)
+		require.Len(t, resp.Posts.Edges, 1)
+		assert.Equal(t, "Post", resp.Posts.Edges[0].Node.Title)
+		assert.Equal(t, []string{"go", "graphql"}, resp.Posts.Edges[0].Node.Tags)
+		require.Len(t, resp.Tags, 2)
+		assert.Equal(t, "go", resp.Tags[0].Name)
+		assert.Equal(t, 2, resp.Tags[0].PostCount)
+
+		_, err = r.Mutation().SetPostTags(asUser(ctx, "Author"), post.ID, []string{"  "})
+		assert.ErrorIs(t, err, ErrValidation)
+		tooMany := make([]string, maxPostTags+1)
+		for i := range tooMany {
+			tooMany[i] = fmt.Sprintf("tag%d", i)
+		}
+		_, err = r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, tooMany)
+		assert.ErrorIs(t, err, ErrValidation)
+		_, err = r.Mutation().SetPostTags(asUser(ctx, "Author"), "non-existent-id", []string{"go"})
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Postgres tuning", "Indexes and vacuum", nil, nil, nil)
+		require.NoError(t, err)
+		_, err = r.Mutation().CreatePost(asUser(ctx, "Author"), "Other", "Nothing relevant", nil, nil, nil)
+		require.NoError(t, err)
+		comment, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Vacuum helped a lot")
+		require.NoError(t, err)
+
+		var resp struct {
+			Search struct {
+				Edges []struct {
+					Cursor  string
+					Rank    float64
+					Snippet string
+					Node    struct {
+						Typename string `json:"__typename"`
+						ID       string
+						Title    string
+						Text     string
+					}
+				}
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   *string
+				}
+			}
+		}
+		query := `query($q: String!, $after: String) {
+			search(query: $q, first: 1, after: $after) {
+				edges {
+					cursor rank snippet
+					node {
+						__typename
+						... on Post { id title }
+						... on Comment { id text }
+					}
+				}
+				pageInfo { hasNextPage endCursor }
+			}
+		}`
+		c.MustPost(query, &resp, client.Var("q", "vacuum"))
+		require.Len(t, resp.Search.Edges, 1)
+		assert.Equal(t, "Post", resp.Search.Edges[0].Node.Typename)
+		assert.Equal(t, "Postgres tuning", resp.Search.Edges[0].Node.Title)
+		assert.Equal(t, "Postgres tuning Indexes and <b>vacuum</b>", resp.Search.Edges[0].Snippet)
+		assert.True(t, resp.Search.PageInfo.HasNextPage)
+
+		c.MustPost(query, &resp, client.Var("q", "vacuum"), client.Var("after", *resp.Search.PageInfo.EndCursor))
+		require.Len(t, resp.Search.Edges, 1)
+		assert.Equal(t, "Comment", resp.Search.Edges[0].Node.Typename)
+		assert.Equal(t, comment.ID, resp.Search.Edges[0].Node.ID)
+		assert.False(t, resp.Search.PageInfo.HasNextPage)
+
+		onlyPosts := []model.SearchType{model.SearchTypePost}
+		conn, err := r.Query().Search(ctx, "helped", onlyPosts, nil, nil)
+		require.NoError(t, err)
+		assert.Empty(t, conn.Edges)
+
+		_, err = r.Query().Search(ctx, "  ", nil, nil, nil)
+		assert.ErrorIs(t, err, ErrValidation)
+		postCursor := encodeCursor(post.CreatedAt, post.ID)
+		_, err = r.Query().Search(ctx, "vacuum", nil, nil, &postCursor)
+		assert.ErrorIs(t, err, ErrValidation)
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+		reader, author, moderator, admin := as("Jane", model.RoleReader), as("Author", model.RoleAuthor),
+			as("Moderator", model.RoleModerator), as("Admin", model.RoleAdmin)
+
+		var ignored map[string]any
+		createPost := `mutation { createPost(title: "T", content: "C", allowComments: true) { id } }`
+		err := c.Post(createPost, &ignored)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "authentication required")
+		err = c.Post(createPost, &ignored, reader)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "author role required")
+
+		var created struct {
+			CreatePost struct{ ID string }
+		}
+		c.MustPost(createPost, &created, author)
+		postID := client.Var("id", created.CreatePost.ID)
+		var comment struct {
+			AddComment struct{ ID string }
+		}
+		c.MustPost(`mutation($id: ID!) { addComment(postID: $id, text: "Hi") { id } }`, &comment, postID, reader)
+
+		// Чужой пост меняет только модератор
+		updatePost := `mutation($id: ID!) { updatePost(id: $id, title: "New") { title } }`
+		err = c.Post(updatePost, &ignored, postID, as("Another Author", model.RoleAuthor))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only the author or a moderator can change this post")
+		c.MustPost(updatePost, &ignored, postID, moderator)
+
+		lockThread := `mutation($id: ID!) { lockThread(commentID: $id) { locked } }`
+		commentID := client.Var("id", comment.AddComment.ID)
+		err = c.Post(lockThread, &ignored, commentID, author)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "moderator role required")
+		c.MustPost(lockThread, &ignored, commentID, moderator)
+
+		createUser := `mutation { createUser(displayName: "Dave") { id } }`
+		err = c.Post(createUser, &ignored, moderator)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "admin role required")
+		c.MustPost(createUser, &ignored, admin)
+
+		// Запросы на чтение доступны без токена
+		var post struct {
+			Post struct{ Title string }
+		}
+		c.MustPost(`query($id: ID!) { post(id: $id) { title } }`, &post, postID)
+		assert.Equal(t, "New", post.Post.Title)
+	})
+
+	t.Run("Moderation", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+		jane, bob, moderator := as("Jane", model.RoleReader), as("Bob", model.RoleReader), as("Moderator", model.RoleModerator)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		spam, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Buy now")
+		require.NoError(t, err)
+		_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Fine")
+		require.NoError(t, err)
+		commentID := client.Var("id", spam.ID)
+
+		var reported struct {
+			ReportComment struct{ Status model.CommentStatus }
+		}
+		report := `mutation($id: ID!, $reason: String!) { reportComment(commentID: $id, reason: $reason) { status } }`
+		c.MustPost(report, &reported, commentID, client.Var("reason", " spam "), jane)
+		assert.Equal(t, model.CommentStatusReported, reported.ReportComment.Status)
+		c.MustPost(report, &reported, commentID, client.Var("reason", "ads"), bob)
+		err = c.Post(report, &reported, commentID, client.Var("reason", "again"), jane)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "already reported")
+		err = c.Post(report, &reported, commentID, client.Var("reason", " "), bob)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "reason must be between 1 and 500 characters")
+
+		// Очередь и жалобы видят только модераторы
+		queueQuery := `{ moderationQueue { edges { node { id reports { reporter { id } reason } } } } }`
+		var ignored map[string]any
+		err = c.Post(queueQuery, &ignored, jane)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "moderator role required")
+		var queue struct {
+			ModerationQueue struct {
+				Edges []struct {
+					Node struct {
+						ID      string
+						Reports []struct {
+							Reporter struct{ ID string }
+							Reason   string
+						}
+					}
+				}
+			}
+		}
+		c.MustPost(queueQuery, &queue, moderator)
+		require.Len(t, queue.ModerationQueue.Edges, 1)
+		node := queue.ModerationQueue.Edges[0].Node
+		assert.Equal(t, spam.ID, node.ID)
+		require.Len(t, node.Reports, 2)
+		assert.Equal(t, "Jane", node.Reports[0].Reporter.ID)
+		assert.Equal(t, "spam", node.Reports[0].Reason)
+
+		hide := `mutation($id: ID!) { hideComment(id: $id) { status } }`
+		err = c.Post(hide, &ignored, commentID, jane)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "moderator role required")
+		c.MustPost(hide, &ignored, commentID, moderator)
+
+		// ID скрытого комментария не даёт ни голосовать, ни реагировать, ни жаловаться
+		err = c.Post(`mutation($id: ID!) { voteComment(commentID: $id, value: 1) { text } }`, &ignored, commentID, bob)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "comment not found")
+		err = c.Post(`mutation($id: ID!) { react(targetID: $id, emoji: "👍") { emoji } }`, &ignored, commentID, bob)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+		err = c.Post(report, &reported, commentID, client.Var("reason", "more"), as("User", model.RoleReader))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "comment not found")
+		_, err = r.Mutation().VoteComment(asModerator(ctx), spam.ID, 1)
+		assert.NoError(t, err)
+
+		// Скрытый комментарий пропадает у читателей, модератор его по-прежнему видит
+		commentsQuery := `query($id: ID!) { post(id: $id) { comments { id status } } }`
+		var list struct {
+			Post struct {
+				Comments []struct {
+					ID     string
+					Status model.CommentStatus
+				}
+			}
+		}
+		c.MustPost(commentsQuery, &list, client.Var("id", post.ID), jane)
+		require.Len(t, list.Post.Comments, 1)
+		assert.NotEqual(t, spam.ID, list.Post.Comments[0].ID)
+		c.MustPost(commentsQuery, &list, client.Var("id", post.ID), moderator)
+		require.Len(t, list.Post.Comments, 2)
+		assert.Equal(t, model.CommentStatusHidden, list.Post.Comments[0].Status)
+		_, err = r.Query().Comment(ctx, spam.ID)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = r.Query().Comment(asModerator(ctx), spam.ID)
+		assert.NoError(t, err)
+
+		approved, err := r.Mutation().ApproveComment(asModerator(ctx), spam.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusApproved, approved.Status)
+		_, err = r.Query().Comment(ctx, spam.ID)
+		assert.NoError(t, err)
+		rejected, err := r.Mutation().RejectComment(asModerator(ctx), spam.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusRejected, rejected.Status)
+		_, err = r.Mutation().ApproveComment(asModerator(ctx), spam.ID)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		var rejectedQueue struct {
+			ModerationQueue struct {
+				Edges []struct{ Node struct{ ID string } }
+			}
+		}
+		c.MustPost(`{ moderationQueue(status: REJECTED) { edges { node { id } } } }`, &rejectedQueue, moderator)
+		require.Len(t, rejectedQueue.ModerationQueue.Edges, 1)
+		assert.Equal(t, spam.ID, rejectedQueue.ModerationQueue.Edges[0].Node.ID)
+	})
+
+	t.Run("HiddenAncestors", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		root, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Root")
+		require.NoError(t, err)
+		parent, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, &root.ID, "Secret")
+		require.NoError(t, err)
+		reply, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, &parent.ID, "Reply")
+		require.NoError(t, err)
+
+		query := `query($id: ID!) { comment(id: $id) { ancestors { id text } } }`
+		ancestors := func(opts ...client.Option) []string {
+			var resp struct {
+				Comment struct {
+					Ancestors []struct{ ID, Text string }
+				}
+			}
+			c.MustPost(query, &resp, append(opts, client.Var("id", reply.ID))...)
+			var texts []string
+			for _, a := range resp.Comment.Ancestors {
+				texts = append(texts, a.Text)
+			}
+			return texts
+		}
+		reader := as("Bob", model.RoleReader)
+		assert.Equal(t, []string{"Root", "Secret"}, ancestors(reader))
+
+		// Скрытый и отклонённый родитель не читается ни читателем, ни анонимно
+		_, err = r.Mutation().HideComment(asModerator(ctx), parent.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Root"}, ancestors(reader))
+		assert.Equal(t, []string{"Root"}, ancestors())
+		assert.Equal(t, []string{"Root", "Secret"}, ancestors(as("Moderator", model.RoleModerator)))
+
+		_, err = r.Mutation().RejectComment(asModerator(ctx), parent.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Root"}, ancestors(reader))
+	})
+
+	t.Run("Premoderation", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+		author := asUser(ctx, "Author")
+
+		_, err := r.Mutation().CreatePost(author, "Post", "Content", new(bool), moderationMode(model.ModerationModeOpen), nil)
+		assert.ErrorIs(t, err, ErrValidation)
+		post, err := r.Mutation().CreatePost(author, "Post", "Content", nil, moderationMode(model.ModerationModePremoderated), nil)
+		require.NoError(t, err)
+
+		subCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		added, err := r.Subscription().CommentAdded(subCtx, post.ID)
+		require.NoError(t, err)
+
+		pending, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Pending")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, pending.Status)
+		select {
+		case <-added:
+			t.Fatal("pending comment must not be sent to subscribers")
+		default:
+		}
+
+		// Ожидающий комментарий видят автор и модераторы
+		_, err = r.Query().Comment(asUser(ctx, "Bob"), pending.ID)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = r.Query().Comment(asUser(ctx, "Jane"), pending.ID)
+		assert.NoError(t, err)
+		commentsQuery := `query($id: ID!) { post(id: $id) { allowComments comments { id status } } }`
+		var list struct {
+			Post struct {
+				AllowComments bool
+				Comments      []struct {
+					ID     string
+					Status model.CommentStatus
+				}
+			}
+		}
+		c.MustPost(commentsQuery, &list, client.Var("id", post.ID), as("Bob", model.RoleReader))
+		assert.True(t, list.Post.AllowComments)
+		assert.Empty(t, list.Post.Comments)
+		c.MustPost(commentsQuery, &list, client.Var("id", post.ID), as("Jane", model.RoleReader))
+		require.Len(t, list.Post.Comments, 1)
+		assert.Equal(t, model.CommentStatusPending, list.Post.Comments[0].Status)
+
+		// Курсорные выдачи и дерево видят то же, что и comments
+		viewsQuery := `query($id: ID!, $author: ID!) {
+			post(id: $id) { commentsConnection { edges { node { id } } } commentTree { comment { id } } }
+			user(id: $author) { comments { edges { node { id } } } }
+		}`
+		type edges struct {
+			Edges []struct{ Node struct{ ID string } }
+		}
+		for _, tc := range []struct {
+			name   string
+			viewer client.Option
+			want   int
+		}{
+			{"Reader", as("Bob", model.RoleReader), 0},
+			{"Author", as("Jane", model.RoleReader), 1},
+			{"Moderator", as("Moderator", model.RoleModerator), 1},
+		} {
+			var views struct {
+				Post struct {
+					CommentsConnection edges
+					CommentTree        []struct{ Comment struct{ ID string } }
+				}
+				User struct{ Comments edges }
+			}
+			c.MustPost(viewsQuery, &views, client.Var("id", post.ID), client.Var("author", "Jane"), tc.viewer)
+			assert.Len(t, views.Post.CommentsConnection.Edges, tc.want, tc.name)
+			assert.Len(t, views.Post.CommentTree, tc.want, tc.name)
+			assert.Len(t, views.User.Comments.Edges, tc.want, tc.name)
+		}
+
+		// Ответить на непроверенный комментарий нельзя
+		_, err = r.Mutation().AddComment(asUser(ctx, "Bob"), post.ID, &pending.ID, "Reply")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, &pending.ID, "Reply")
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		// Правка до первого одобрения не мешает разослать комментарий, и ровно один раз
+		edited, err := r.Mutation().EditComment(asUser(ctx, "Jane"), pending.ID, "Edited while pending")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, edited.Status)
+		_, err = r.Mutation().ApproveComment(asModerator(ctx), pending.ID)
+		require.NoError(t, err)
+		select {
+		case comment := <-added:
+			assert.Equal(t, pending.ID, comment.ID)
+			assert.Equal(t, model.CommentStatusApproved, comment.Status)
+			assert.Equal(t, "Edited while pending", comment.Text)
+		case <-time.After(time.Second):
+			t.Fatal("approved comment was not sent to subscribers")
+		}
+		select {
+		case <-added:
+			t.Fatal("approved comment must be sent to subscribers once")
+		default:
+		}
+		_, err = r.Query().Comment(asUser(ctx, "Bob"), pending.ID)
+		assert.NoError(t, err)
+
+		// Правка автора отправляет одобренный комментарий на повторную проверку
+		edited, err = r.Mutation().EditComment(asUser(ctx, "Jane"), pending.ID, "Edited after approval")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, edited.Status)
+		_, err = r.Query().Comment(asUser(ctx, "Bob"), pending.ID)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		c.MustPost(commentsQuery, &list, client.Var("id", post.ID), as("Bob", model.RoleReader))
+		assert.Empty(t, list.Post.Comments)
+		counted, err := r.Query().Post(ctx, post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), counted.CommentCount)
+		// Одобренная правка не рассылается повторно: подписчики уже получили комментарий
+		_, err = r.Mutation().ApproveComment(asModerator(ctx), pending.ID)
+		require.NoError(t, err)
+		select {
+		case <-added:
+			t.Fatal("approved edit must not be sent to subscribers again")
+		default:
+		}
+		_, err = r.Query().Comment(asUser(ctx, "Bob"), pending.ID)
+		assert.NoError(t, err)
+		// Правка модератора проверки не требует
+		edited, err = r.Mutation().EditComment(asModerator(ctx), pending.ID, "Edited by moderator")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusApproved, edited.Status)
+
+		// Включение комментариев не снимает премодерацию, выключение закрывает пост
+		updated, err := r.Mutation().SetCommentsEnabled(author, post.ID, true)
+		require.NoError(t, err)
+		assert.Equal(t, model.ModerationModePremoderated, updated.ModerationMode)
+		updated, err = r.Mutation().SetCommentsEnabled(author, post.ID, false)
+		require.NoError(t, err)
+		assert.Equal(t, model.ModerationModeClosed, updated.ModerationMode)
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Closed")
+		assert.ErrorIs(t, err, storage.ErrCommentsDisabled)
+		_, err = r.Mutation().EditComment(asUser(ctx, "Jane"), pending.ID, "Closed")
+		assert.ErrorIs(t, err, storage.ErrCommentsDisabled)
+
+		updated, err = r.Mutation().SetModerationMode(author, post.ID, model.ModerationModeOpen)
+		require.NoError(t, err)
+		assert.Equal(t, model.ModerationModeOpen, updated.ModerationMode)
+		_, err = r.Mutation().SetModerationMode(asUser(ctx, "Jane"), post.ID, model.ModerationModeClosed)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		published, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Open")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPublished, published.Status)
+	})
+
+	t.Run("ContentFilter", func(t *testing.T) {
+		r := setupResolver()
+		r.SetContentFilter(filter.Pipeline{filter.RepeatedChars{Max: 3}, filter.NewBannedWords([]string{"spam"}, filter.Rewrite), filter.LinkLimit{Max: 0}})
+		author := asUser(ctx, "Author")
+
+		post, err := r.Mutation().CreatePost(author, "No spam", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "No ****", post.Title)
+		_, err = r.Mutation().CreatePost(author, "Wow!!!!", "Content", nil, nil, nil)
+		assert.ErrorIs(t, err, filter.ErrRejected)
+
+		rewritten, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Spam spam")
+		require.NoError(t, err)
+		assert.Equal(t, "**** ****", rewritten.Text)
+		assert.Equal(t, model.CommentStatusPublished, rewritten.Status)
+
+		// Помеченный комментарий ждёт модератора
+		flagged, err := r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "see https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, flagged.Status)
+		_, err = r.Query().Comment(asUser(ctx, "Bob"), flagged.ID)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		_, err = r.Mutation().AddComment(asUser(ctx, "Jane"), post.ID, nil, "Nooooo")
+		assert.ErrorIs(t, err, filter.ErrRejected)
+		assert.Contains(t, err.Error(), "content rejected: more than 3 repeated characters in a row")
+		_, err = r.Mutation().EditComment(asUser(ctx, "Jane"), rewritten.ID, "Nooooo")
+		assert.ErrorIs(t, err, filter.ErrRejected)
+		edited, err := r.Mutation().EditComment(asUser(ctx, "Jane"), rewritten.ID, "still spam")
+		require.NoError(t, err)
+		assert.Equal(t, "still ****", edited.Text)
+
+		// Помеченная правка автора снова ждёт модератора, правка модератора - нет
+		subCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		added, err := r.Subscription().CommentAdded(subCtx, post.ID)
+		require.NoError(t, err)
+		edited, err = r.Mutation().EditComment(asUser(ctx, "Jane"), rewritten.ID, "see https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, edited.Status)
+		_, err = r.Query().Comment(asUser(ctx, "Bob"), rewritten.ID)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		approved, err := r.Mutation().ApproveComment(asModerator(ctx), rewritten.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "see https://example.com", approved.Text)
+		select {
+		case <-added:
+			t.Fatal("approved edit must not be sent to subscribers again")
+		default:
+		}
+		edited, err = r.Mutation().EditComment(asModerator(ctx), rewritten.ID, "see https://example.org")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusApproved, edited.Status)
+
+		// Для постов очереди модерации нет, поэтому помеченный текст отклоняется
+
+		_, err = r.Mutation().CreatePost(author, "Links", "see https://example.com", nil, nil, nil)
+		assert.ErrorIs(t, err, filter.ErrRejected)
+		linked := "see https://example.com"
+		_, err = r.Mutation().UpdatePost(author, post.ID, nil, &linked, nil, nil)
+		assert.ErrorIs(t, err, filter.ErrRejected)
+		stored, err := r.Query().Post(ctx, post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Content", stored.Content)
+	})
+
+	t.Run("DuplicateComments", func(t *testing.T) {
+		store := &failingStorage{Storage: newTestStorage()}
+		r := NewResolver(store)
+		r.SetContentFilter(filter.Pipeline{filter.NewDuplicates(time.Hour)})
+		jane := asUser(ctx, "Jane")
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Post", "Content", nil, nil, nil)
+		require.NoError(t, err)
+
+		// Несохранённый комментарий не мешает повторить попытку
+		store.fail.Store(true)
+		_, err = r.Mutation().AddComment(jane, post.ID, nil, "Hello")
+		require.Error(t, err)
+		store.fail.Store(false)
+		_, err = r.Mutation().AddComment(jane, post.ID, nil, "Hello")
+		require.NoError(t, err)
+		_, err = r.Mutation().AddComment(jane, post.ID, nil, " hello ")
+		assert.ErrorIs(t, err, filter.ErrRejected)
+
+		// Правка не сравнивается с комментариями автора и не запоминается
+		other, err := r.Mutation().AddComment(jane, post.ID, nil, "Other")
+		require.NoError(t, err)
+		_, err = r.Mutation().EditComment(jane, other.ID, "Hello")
+		require.NoError(t, err)
+		_, err = r.Mutation().EditComment(jane, other.ID, "Edited")
+		require.NoError(t, err)
+		_, err = r.Mutation().AddComment(jane, post.ID, nil, "Edited")
+		assert.NoError(t, err)
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		r := setupResolver()
+		r.SetRateLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(time.Hour), map[string]ratelimit.Limit{
+			"createPost": {Burst: 1, Period: time.Hour},
+			"addComment": {Burst: 2, Period: time.Hour},
+		}))
+		c := newTestClient(r)
+		author := as("Author", model.RoleAuthor)
+		var ignored map[string]any
+
+		var created struct {
+			CreatePost struct{ ID string }
+		}
+		createPost := `mutation { createPost(title: "T", content: "C") { id } }`
+		c.MustPost(createPost, &created, author)
+		err := c.Post(createPost, &ignored, author)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rate limit exceeded for createPost")
+		// Лимит у каждого пользователя свой
+		c.MustPost(createPost, &ignored, as("Author 1", model.RoleAuthor))
+		// Лимит проверяется раньше роли, поэтому перебор без прав тоже упирается в него
+		err = c.Post(createPost, &ignored, as("Jane", model.RoleReader))
+		assert.Contains(t, err.Error(), "author role required")
+		err = c.Post(createPost, &ignored, as("Jane", model.RoleReader))
+		assert.Contains(t, err.Error(), "rate limit exceeded for createPost")
+
+		addComment := `mutation($id: ID!) { addComment(postID: $id, text: "T") { id } }`
+		postID := client.Var("id", created.CreatePost.ID)
+		jane := as("Jane", model.RoleReader)
+		c.MustPost(addComment, &ignored, postID, jane)
+		c.MustPost(addComment, &ignored, postID, jane)
+		err = c.Post(addComment, &ignored, postID, jane)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rate limit exceeded for addComment")
+
+		// Остальные мутации не ограничиваются
+		updatePost := `mutation($id: ID!) { updatePost(id: $id, title: "New") { id } }`
+		c.MustPost(updatePost, &ignored, postID, author)
+		c.MustPost(updatePost, &ignored, postID, author)
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		user, err := r.Mutation().CreateUser(ctx, "  Carol ")
+		require.NoError(t, err)
+		assert.Equal(t, "Carol", user.DisplayName)
+		_, err = r.Mutation().CreateUser(ctx, " ")
+		assert.ErrorIs(t, err, ErrValidation)
+		_, err = r.Mutation().CreateUser(ctx, strings.Repeat("я", maxDisplayNameLength+1))
+		assert.ErrorIs(t, err, ErrValidation)
+
+		first, err := r.Mutation().CreatePost(asUser(ctx, user.ID), "First", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		_, err = r.Mutation().CreatePost(asUser(ctx, user.ID), "Second", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		kept, err := r.Mutation().AddComment(asUser(ctx, user.ID), first.ID, nil, "Kept")
+		require.NoError(t, err)
+		removed, err := r.Mutation().AddComment(asUser(ctx, user.ID), first.ID, &kept.ID, "Removed")
+		require.NoError(t, err)
+		_, err = r.Mutation().DeleteComment(asUser(ctx, user.ID), removed.ID)
+		require.NoError(t, err)
+
+		var resp struct {
+			User struct {
+				DisplayName string
+				Posts       struct {
+					Edges []struct {
+						Node struct {
+							Title  string
+							Author struct{ DisplayName string }
+						}
+					}
+					PageInfo struct{ HasNextPage bool }
+				}
+				Comments struct {
+					Edges []struct {
+						Node struct{ Text string }
+					}
+				}
+			}
+		}
+		c.MustPost(`query($id: ID!) { user(id: $id) {
+			displayName
+			posts(first: 1) { edges { node { title author { displayName } } } pageInfo { hasNextPage } }
+			comments { edges { node { text } } }
+		} }`, &resp, client.Var("id", user.ID))
+		assert.Equal(t, "Carol", resp.User.DisplayName)
+		require.Len(t, resp.User.Posts.Edges, 1)
+		assert.Equal(t, "Second", resp.User.Posts.Edges[0].Node.Title)
+		assert.Equal(t, "Carol", resp.User.Posts.Edges[0].Node.Author.DisplayName)
+		assert.True(t, resp.User.Posts.PageInfo.HasNextPage)
+		require.Len(t, resp.User.Comments.Edges, 1)
+		assert.Equal(t, "Kept", resp.User.Comments.Edges[0].Node.Text)
+
+		_, err = r.Query().User(ctx, "missing")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("Connections", func(t *testing.T) {
+		r := setupResolver()
+		c := newTestClient(r)
+
+		for i := 0; i < 3; i++ {
+			_, err := r.Mutation().CreatePost(asUser(ctx, "Author"), fmt.Sprintf("Post %d", i), "Content", nil, nil, nil)
+			require.NoError(t, err)
+		}
+		post, err := r.Mutation().CreatePost(asUser(ctx, "Author"), "Commented", "Content", nil, nil, nil)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			_, err := r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, fmt.Sprintf("Comment %d", i))
+			require.NoError(t, err)
+		}
+
+		type pageInfo struct {
+			HasNextPage bool
+			EndCursor   *string
+		}
+		var postsResp struct {
+			PostsConnection struct {
+				Edges []struct {
+					Cursor string
+					Node   struct{ Title string }
+				}
+				PageInfo pageInfo
+			}
+		}
+		c.MustPost(`{ postsConnection(first: 3) { edges { cursor node { title } } pageInfo { hasNextPage endCursor } } }`, &postsResp)
+		require.Len(t, postsResp.PostsConnection.Edges, 3)
+		assert.Equal(t, "Commented", postsResp.PostsConnection.Edges[0].Node.Title)
+		assert.True(t, postsResp.PostsConnection.PageInfo.HasNextPage)
+		require.NotNil(t, postsResp.PostsConnection.PageInfo.EndCursor)
+
+		c.MustPost(`query($after: String) { postsConnection(first: 3, after: $after) { edges { cursor node { title } } pageInfo { hasNextPage endCursor } } }`,
+			&postsResp, client.Var("after", *postsResp.PostsConnection.PageInfo.EndCursor))
+		require.Len(t, postsResp.PostsConnection.Edges, 1)
+		assert.Equal(t, "Post 0", postsResp.PostsConnection.Edges[0].Node.Title)
+		assert.False(t, postsResp.PostsConnection.PageInfo.HasNextPage)
+
+		commentsQuery := `query($id: ID!, $after: String) {
+			post(id: $id) {
+				commentsConnection(first: 2, after: $after) {
+					edges { node { text } }
+					pageInfo { hasNextPage endCursor }
+				}
+			}
+		}`
+		var commentsResp struct {
+			Post struct {
+				CommentsConnection struct {
+					Edges []struct {
+						Node struct{ Text string }
+					}
+					PageInfo pageInfo
+				}
+			}
+		}
+		c.MustPost(commentsQuery, &commentsResp, client.Var("id", post.ID), client.Var("after", nil))
+		conn := commentsResp.Post.CommentsConnection
+		require.Len(t, conn.Edges, 2)
+		assert.Equal(t, "Comment 0", conn.Edges[0].Node.Text)
+		assert.True(t, conn.PageInfo.HasNextPage)
+
+		// Новый комментарий не сдвигает следующую страницу
+		_, err = r.Mutation().AddComment(asUser(ctx, "User"), post.ID, nil, "Late comment")
+		require.NoError(t, err)
+		c.MustPost(commentsQuery, &commentsResp, client.Var("id", post.ID), client.Var("after", *conn.PageInfo.EndCursor))
+		conn = commentsResp.Post.CommentsConnection
+		require.Len(t, conn.Edges, 2)
+		assert.Equal(t, "Comment 2", conn.Edges[0].Node.Text)
+		assert.Equal(t, "Comment 3", conn.Edges[1].Node.Text)
+
+		err = c.Post(`{ postsConnection(after: "???") { edges { cursor } } }`, &postsResp)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid cursor")
+		// Время курсора проверяется до хранилища, одинаково для обоих бэкендов
+		forged := base64.RawURLEncoding.EncodeToString([]byte("not-a-time|" + post.ID))
+		err = c.Post(commentsQuery, &commentsResp, client.Var("id", post.ID), client.Var("after", forged))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid cursor")
+		_, err = decodeCursor(&forged)
+		assert.ErrorIs(t, err, ErrValidation)
+	})
 }
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Cursor указывает на позицию в выдаче, упорядоченной по (created_at, id).
+// Страница начинается строго после записи с этим ключом.
+type Cursor struct {
+	CreatedAt string
+	ID        string
+	// Value - ведущий ключ сортировки перед (created_at, id), например счёт
+	// поста для порядка TOP. nil, если выдача упорядочена только по времени.
+	Value *int64
+}
+
+// compareKeys сравнивает ключи сортировки (value, created_at, id). Время сравнивается
+// как момент, а не как строка, чтобы разные смещения часового пояса не ломали порядок.
+func compareKeys(a, b Cursor) int {
+	if a.Value != nil && b.Value != nil {
+		if c := cmp.Compare(*a.Value, *b.Value); c != 0 {
+			return c
+		}
+	}
+	ta, errA := time.Parse(time.RFC3339Nano, a.CreatedAt)
+	tb, errB := time.Parse(time.RFC3339Nano, b.CreatedAt)
+	if errA == nil && errB == nil {
+		if c := ta.Compare(tb); c != 0 {
+			return c
+		}
+	} else if c := strings.Compare(a.CreatedAt, b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// keysetPage сортирует элементы по ключу key и возвращает до first
+// элементов после курсора, а также признак наличия следующей страницы.
+func keysetPage[T any](items []T, key func(T) Cursor, desc bool, first int, after *Cursor) ([]T, bool) {
+	sorted := make([]T, len(items))
+	copy(sorted, items)
+	compare := func(a, b Cursor) int {
+		if desc {
+			return compareKeys(b, a)
+		}
+		return compareKeys(a, b)
+	}
+	slices.SortStableFunc(sorted, func(a, b T) int { return compare(key(a), key(b)) })
+
+	start := 0
+	if after != nil {
+		for start < len(sorted) && compare(key(sorted[start]), *after) <= 0 {
+			start++
+		}
+	}
+	page := sorted[start:]
+	if len(page) > first {
+		return page[:first], true
+	}
+	return page, false
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"post-comment-app/graph/model"
+)
+
+// Ошибки хранилища. Оба бэкенда оборачивают их так, что текст остаётся
+// человекочитаемым ("post not found"), а вызывающий код проверяет вид ошибки
+// через errors.Is.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrConflict         = errors.New("conflict")
+	ErrInvalidID        = errors.New("invalid id")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrCommentsDisabled = errors.New("comments are not allowed for this post")
+)
+
+var (
+	errPostNotFound    = fmt.Errorf("post %w", ErrNotFound)
+	errCommentNotFound = fmt.Errorf("comment %w", ErrNotFound)
+	errUserNotFound    = fmt.Errorf("user %w", ErrNotFound)
+)
+
+// Столбцы ID в PostgreSQL - VARCHAR(36).
+const maxIDLength = 36
+
+// checkID отсекает ID, которые не могут существовать ни в одном хранилище,
+// чтобы оба бэкенда отвечали на них одинаково.
+func checkID(ids ...string) error {
+	for _, id := range ids {
+		if id == "" || len(id) > maxIDLength {
+			return fmt.Errorf("%w %q", ErrInvalidID, id)
+		}
+	}
+	return nil
+}
+
+func checkCommentIDs(comment *model.Comment) error {
+	ids := []string{comment.PostID, comment.AuthorID}
+	if comment.ID != "" {
+		ids = append(ids, comment.ID)
+	}
+	if comment.ParentID != nil {
+		ids = append(ids, *comment.ParentID)
+	}
+	return checkID(ids...)
+}
+
+// authorNotFound - ошибка для поста или комментария от несуществующего пользователя.
+func authorNotFound(authorID string) error {
+	return fmt.Errorf("user with ID %s %w", authorID, ErrNotFound)
+}
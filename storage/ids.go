@@ -0,0 +1,10 @@
+package storage
+
+import "github.com/google/uuid"
+
+// NewID выдаёт идентификатор для постов и комментариев. Все ID генерируются
+// здесь, а не в базе, поэтому оба хранилища возвращают одинаковый формат:
+// UUIDv7, упорядоченный по времени создания. Для клиентов ID непрозрачны.
+func NewID() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
@@ -1,41 +1,151 @@
 package storage
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"post-comment-app/graph/model"
+	"slices"
+	"strings"
 	"sync"
-
-	"github.com/google/uuid"
 )
 
 type InMemoryStorage struct {
-	posts    []*model.Post
-	comments []*model.Comment
-	mu       sync.RWMutex
+	users     map[string]*model.User
+	posts     []*model.Post
+	comments  []*model.Comment
+	revisions map[string][]*model.CommentRevision
+	reports   map[string][]*model.CommentReport
+	// Материализованный путь комментария: ID предков и его собственный через "/",
+	// как столбец comments.path в PostgreSQL.
+	paths map[string]string
+	// ID заблокированных веток: IsThreadLocked проверяет по ним предков из пути,
+	// не перебирая комментарии поста.
+	locked map[string]struct{}
+	// Голоса и реакции, как таблицы *_votes и *_reactions в PostgreSQL
+	votes     map[target]voteTally
+	ballots   map[ballot]int
+	reactions map[target]map[string]map[string]struct{} // emoji -> пользователи
+	tags      map[string][]string                       // пост -> теги по алфавиту
+	search    *searchIndex
+	mu        sync.RWMutex
+}
+
+type target struct {
+	kind TargetKind
+	id   string
+}
+
+type ballot struct {
+	target
+	voter string
 }
 
 func NewInMemoryStorage() *InMemoryStorage {
 	return &InMemoryStorage{
-		posts:    []*model.Post{},
-		comments: []*model.Comment{},
+		users:     make(map[string]*model.User),
+		posts:     []*model.Post{},
+		comments:  []*model.Comment{},
+		revisions: make(map[string][]*model.CommentRevision),
+		reports:   make(map[string][]*model.CommentReport),
+		paths:     make(map[string]string),
+		locked:    make(map[string]struct{}),
+		votes:     make(map[target]voteTally),
+		ballots:   make(map[ballot]int),
+		reactions: make(map[target]map[string]map[string]struct{}),
+		tags:      make(map[string][]string),
+		search:    newSearchIndex(),
+	}
+}
+
+func (s *InMemoryStorage) CreateUser(ctx context.Context, user *model.User) error {
+	if err := checkID(user.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[user.ID]; ok {
+		return fmt.Errorf("user with ID %s already exists: %w", user.ID, ErrConflict)
 	}
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *InMemoryStorage) GetUser(ctx context.Context, id string) (*model.User, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return user, nil
+}
+
+func (s *InMemoryStorage) GetUsersByIDs(ctx context.Context, ids []string) (map[string]*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make(map[string]*model.User, len(ids))
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			users[id] = u
+		}
+	}
+	return users, nil
 }
 
 func (s *InMemoryStorage) CreatePost(ctx context.Context, post *model.Post) error {
+	if err := checkID(post.ID, post.AuthorID); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.posts = append(s.posts, post)
+	if _, ok := s.users[post.AuthorID]; !ok {
+		return authorNotFound(post.AuthorID)
+	}
+	for _, p := range s.posts {
+		if p.ID == post.ID {
+			return fmt.Errorf("post with ID %s already exists: %w", post.ID, ErrConflict)
+		}
+	}
+	post.ModerationMode = postModerationMode(post)
+	// Теги хранятся отдельно, как post_tags в PostgreSQL, и GetPost их не возвращает
+	stored := *post
+	stored.Tags = nil
+	s.posts = append(s.posts, &stored)
+	s.setTags(post.ID, post.Tags)
+	s.search.add(target{TargetPost, post.ID}, postSearchFields(post)...)
 	return nil
 }
 
-func (s *InMemoryStorage) GetPosts(ctx context.Context) ([]*model.Post, error) {
+func (s *InMemoryStorage) GetPosts(ctx context.Context, filter *model.PostFilter, order model.PostOrder, first int, after *Cursor) ([]*model.Post, bool, error) {
+	o, err := postOrderFor(order, after)
+	if err != nil {
+		return nil, false, err
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.posts, nil
+	var posts []*model.Post
+	for _, p := range s.posts {
+		if matchesPostFilter(p, s.tags[p.ID], filter) {
+			posts = append(posts, p)
+		}
+	}
+	page, hasNext := keysetPage(posts, o.key, o.desc, first, after)
+	return page, hasNext, nil
 }
 
 func (s *InMemoryStorage) GetPost(ctx context.Context, id string) (*model.Post, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	for _, p := range s.posts {
@@ -43,10 +153,144 @@ func (s *InMemoryStorage) GetPost(ctx context.Context, id string) (*model.Post,
 			return p, nil
 		}
 	}
-	return nil, fmt.Errorf("post not found")
+	return nil, errPostNotFound
+}
+
+func (s *InMemoryStorage) UpdatePost(ctx context.Context, post *model.Post) error {
+	if err := checkID(post.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.posts {
+		if p.ID == post.ID {
+			// Счётчики ведёт хранилище, в переданном посте они могут быть устаревшими
+			updated := *post
+			updated.CommentCount = p.CommentCount
+			updated.TopLevelCommentCount = p.TopLevelCommentCount
+			updated.Score = p.Score
+			updated.ModerationMode = postModerationMode(post)
+			s.posts[i] = &updated
+			s.search.add(target{TargetPost, updated.ID}, postSearchFields(&updated)...)
+			return nil
+		}
+	}
+	return errPostNotFound
+}
+
+func (s *InMemoryStorage) DeletePost(ctx context.Context, id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := -1
+	for i, p := range s.posts {
+		if p.ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return errPostNotFound
+	}
+	s.posts = append(s.posts[:idx:idx], s.posts[idx+1:]...)
+	delete(s.tags, id)
+
+	// Комментарии удаляются вместе с постом, как ON DELETE CASCADE в PostgreSQL
+	removed := map[target]struct{}{{TargetPost, id}: {}}
+	kept := s.comments[:0:0]
+	for _, c := range s.comments {
+		if c.PostID != id {
+			kept = append(kept, c)
+		} else {
+			delete(s.revisions, c.ID)
+			delete(s.reports, c.ID)
+			delete(s.paths, c.ID)
+			delete(s.locked, c.ID)
+			removed[target{TargetComment, c.ID}] = struct{}{}
+		}
+	}
+	s.comments = kept
+	for t := range removed {
+		delete(s.votes, t)
+		delete(s.reactions, t)
+		s.search.remove(t)
+	}
+	for b := range s.ballots {
+		if _, ok := removed[b.target]; ok {
+			delete(s.ballots, b)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) SetPostTags(ctx context.Context, postID string, tags []string) error {
+	if err := checkID(postID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(TargetPost, postID) {
+		return errPostNotFound
+	}
+	s.setTags(postID, tags)
+	return nil
+}
+
+// setTags заменяет теги поста, храня их по алфавиту. Вызывается под s.mu.
+func (s *InMemoryStorage) setTags(postID string, tags []string) {
+	if len(tags) == 0 {
+		delete(s.tags, postID)
+		return
+	}
+	sorted := slices.Clone(tags)
+	slices.Sort(sorted)
+	s.tags[postID] = sorted
+}
+
+func (s *InMemoryStorage) GetTagsByPostIDs(ctx context.Context, postIDs []string) (map[string][]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	byPost := make(map[string][]string, len(postIDs))
+	for _, id := range postIDs {
+		if tags, ok := s.tags[id]; ok {
+			byPost[id] = tags
+		}
+	}
+	return byPost, nil
+}
+
+func (s *InMemoryStorage) GetTags(ctx context.Context, limit int) ([]*model.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[string]int32)
+	for _, tags := range s.tags {
+		for _, name := range tags {
+			counts[name]++
+		}
+	}
+	result := make([]*model.Tag, 0, len(counts))
+	for name, n := range counts {
+		result = append(result, &model.Tag{Name: name, PostCount: n})
+	}
+	slices.SortFunc(result, func(a, b *model.Tag) int {
+		if c := cmp.Compare(b.PostCount, a.PostCount); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result[:min(limit, len(result))], nil
 }
 
 func (s *InMemoryStorage) CreateComment(ctx context.Context, comment *model.Comment) (*model.Comment, error) {
+	if err := checkCommentIDs(comment); err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -59,33 +303,92 @@ func (s *InMemoryStorage) CreateComment(ctx context.Context, comment *model.Comm
 		}
 	}
 	if !postExists {
-		return nil, fmt.Errorf("post with ID %s not found", comment.PostID)
+		return nil, fmt.Errorf("post with ID %s %w", comment.PostID, ErrNotFound)
+	}
+	if _, ok := s.users[comment.AuthorID]; !ok {
+		return nil, authorNotFound(comment.AuthorID)
 	}
 
 	// Проверка parent_id, если указан
+	var parent *model.Comment
 	if comment.ParentID != nil {
-		var parentExists bool
 		for _, c := range s.comments {
 			if c.ID == *comment.ParentID {
-				parentExists = true
+				parent = c
 				break
 			}
 		}
-		if !parentExists {
-			return nil, fmt.Errorf("parent comment with ID %s not found", *comment.ParentID)
+		if parent == nil {
+			return nil, fmt.Errorf("parent comment with ID %s %w", *comment.ParentID, ErrNotFound)
+		}
+		// Путь не должен пересекать границу поста
+		if parent.PostID != comment.PostID {
+			return nil, fmt.Errorf("parent comment with ID %s %w in post %s", *comment.ParentID, ErrNotFound, comment.PostID)
 		}
 	}
 
 	// Установка ID, если не задан
 	if comment.ID == "" {
-		comment.ID = uuid.NewString()
+		comment.ID = NewID()
+	}
+	for _, c := range s.comments {
+		if c.ID == comment.ID {
+			return nil, fmt.Errorf("comment with ID %s already exists: %w", comment.ID, ErrConflict)
+		}
 	}
 
+	comment.Depth = 0
+	path := comment.ID
+	if parent != nil {
+		comment.Depth = parent.Depth + 1
+		path = s.paths[parent.ID] + pathSeparator + comment.ID
+	}
+	s.paths[comment.ID] = path
+	comment.ReplyCount = 0
+	comment.Score = 0
+	comment.Status = commentStatusOnCreate(comment)
+	comment.Published = publishedOnCreate(comment.Status)
 	s.comments = append(s.comments, comment)
+	s.search.add(target{TargetComment, comment.ID}, commentSearchFields(comment)...)
+	if !IsHidden(comment) {
+		s.adjustCounters(comment.PostID, comment.ParentID, 1)
+	}
 	return comment, nil
 }
 
+// adjustCounters сдвигает счётчики поста и родителя на delta, заменяя
+// сохранённые объекты копиями. Счётчики учитывают только неудалённые
+// комментарии, видимые читателям. Вызывается под s.mu.
+func (s *InMemoryStorage) adjustCounters(postID string, parentID *string, delta int32) {
+	for i, p := range s.posts {
+		if p.ID == postID {
+			updated := *p
+			updated.CommentCount += delta
+			if parentID == nil {
+				updated.TopLevelCommentCount += delta
+			}
+			s.posts[i] = &updated
+			break
+		}
+	}
+	if parentID == nil {
+		return
+	}
+	for i, c := range s.comments {
+		if c.ID == *parentID {
+			updated := *c
+			updated.ReplyCount += delta
+			s.comments[i] = &updated
+			break
+		}
+	}
+}
+
 func (s *InMemoryStorage) GetComment(ctx context.Context, id string) (*model.Comment, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	for _, c := range s.comments {
@@ -93,45 +396,633 @@ func (s *InMemoryStorage) GetComment(ctx context.Context, id string) (*model.Com
 			return c, nil
 		}
 	}
-	return nil, fmt.Errorf("comment not found")
+	return nil, errCommentNotFound
+}
+
+func (s *InMemoryStorage) UpdateComment(ctx context.Context, comment *model.Comment, editorID string) error {
+	if err := checkID(comment.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.comments {
+		if c.ID == comment.ID && c.DeletedAt == nil {
+			if _, ok := s.users[editorID]; !ok {
+				return errUserNotFound
+			}
+			editedAt := ""
+			if comment.EditedAt != nil {
+				editedAt = *comment.EditedAt
+			}
+			s.revisions[c.ID] = append(s.revisions[c.ID], &model.CommentRevision{
+				Text:     c.Text,
+				EditorID: editorID,
+				EditedAt: editedAt,
+			})
+			// Меняются только текст, время правки и статус при повторной проверке,
+			// как в PostgreSQL: остальные поля переданного комментария могли устареть
+			updated := *c
+			updated.Text = comment.Text
+			updated.EditedAt = comment.EditedAt
+			updated.Status = commentStatusOnEdit(c.Status, comment.Status)
+			s.comments[i] = &updated
+			if delta := counterDelta(c.Status, updated.Status); delta != 0 {
+				s.adjustCounters(c.PostID, c.ParentID, int32(delta))
+			}
+			s.search.add(target{TargetComment, updated.ID}, commentSearchFields(&updated)...)
+			return nil
+		}
+	}
+	return errCommentNotFound
+}
+
+func (s *InMemoryStorage) GetCommentRevisions(ctx context.Context, commentID string) ([]*model.CommentRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revisions := make([]*model.CommentRevision, len(s.revisions[commentID]))
+	copy(revisions, s.revisions[commentID])
+	return revisions, nil
+}
+
+func (s *InMemoryStorage) CountCommentRevisions(ctx context.Context, commentIDs []string) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := make(map[string]int, len(commentIDs))
+	for _, id := range commentIDs {
+		if n := len(s.revisions[id]); n > 0 {
+			counts[id] = n
+		}
+	}
+	return counts, nil
+}
+
+func (s *InMemoryStorage) DeleteComment(ctx context.Context, id string, deletedAt string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.comments {
+		if c.ID == id && c.DeletedAt == nil {
+			// Сохранённый объект не меняем на месте: его могут читать без блокировки
+			tombstone := *c
+			tombstone.DeletedAt = &deletedAt
+			s.comments[i] = &tombstone
+			s.search.remove(target{TargetComment, id})
+			if !IsHidden(c) {
+				s.adjustCounters(c.PostID, c.ParentID, -1)
+			}
+			return nil
+		}
+	}
+	return errCommentNotFound
+}
+
+func (s *InMemoryStorage) SetThreadLocked(ctx context.Context, commentID string, locked bool) error {
+	if err := checkID(commentID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.comments {
+		if c.ID == commentID {
+			updated := *c
+			updated.Locked = locked
+			s.comments[i] = &updated
+			if locked {
+				s.locked[commentID] = struct{}{}
+			} else {
+				delete(s.locked, commentID)
+			}
+			return nil
+		}
+	}
+	return errCommentNotFound
+}
+
+func (s *InMemoryStorage) IsThreadLocked(ctx context.Context, commentID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Путь содержит ID всех предков и самого комментария
+	for _, id := range strings.Split(s.paths[commentID], pathSeparator) {
+		if _, ok := s.locked[id]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *InMemoryStorage) GetCommentAncestors(ctx context.Context, commentID string, visibility Visibility) ([]*model.Comment, error) {
+	byComment, err := s.GetCommentAncestorsByIDs(ctx, []string{commentID}, visibility)
+	if err != nil {
+		return nil, err
+	}
+	if ancestors := byComment[commentID]; ancestors != nil {
+		return ancestors, nil
+	}
+	return []*model.Comment{}, nil
+}
+
+func (s *InMemoryStorage) GetCommentAncestorsByIDs(ctx context.Context, commentIDs []string, visibility Visibility) (map[string][]*model.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Предки всех комментариев находятся за один проход
+	paths := make(map[string][]string, len(commentIDs))
+	wanted := make(map[string]*model.Comment)
+	for _, id := range commentIDs {
+		path, ok := s.paths[id]
+		if !ok {
+			continue
+		}
+		ids := strings.Split(path, pathSeparator)
+		paths[id] = ids[:len(ids)-1]
+		for _, a := range paths[id] {
+			wanted[a] = nil
+		}
+	}
+	for _, c := range s.comments {
+		if _, ok := wanted[c.ID]; ok {
+			wanted[c.ID] = c
+		}
+	}
+
+	byComment := make(map[string][]*model.Comment, len(paths))
+	for id, ids := range paths {
+		var ancestors []*model.Comment
+		for _, a := range ids {
+			if c := wanted[a]; c != nil && visibility.Visible(c) {
+				ancestors = append(ancestors, c)
+			}
+		}
+		if len(ancestors) > 0 {
+			byComment[id] = ancestors
+		}
+	}
+	return byComment, nil
+}
+
+func (s *InMemoryStorage) CountDescendants(ctx context.Context, commentID string, visibility Visibility) (int, error) {
+	counts, err := s.CountDescendantsByIDs(ctx, []string{commentID}, visibility)
+	return counts[commentID], err
 }
 
-func (s *InMemoryStorage) GetCommentsByPostID(ctx context.Context, postID string, limit, offset int) ([]*model.Comment, error) {
+func (s *InMemoryStorage) CountDescendantsByIDs(ctx context.Context, commentIDs []string, visibility Visibility) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	requested := make(map[string]struct{}, len(commentIDs))
+	for _, id := range commentIDs {
+		requested[id] = struct{}{}
+	}
+	counts := make(map[string]int, len(commentIDs))
+	for _, c := range s.comments {
+		if !visibility.Visible(c) {
+			continue
+		}
+		// Потомок учитывается у каждого запрошенного предка из своего пути
+		ids := strings.Split(s.paths[c.ID], pathSeparator)
+		for _, a := range ids[:len(ids)-1] {
+			if _, ok := requested[a]; ok {
+				counts[a]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (s *InMemoryStorage) Vote(ctx context.Context, kind TargetKind, targetID, voterID string, value int) error {
+	if err := checkID(targetID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(kind, targetID) {
+		return targetNotFound(kind)
+	}
+	// Как внешний ключ voter_id: снять голос можно и без пользователя, отдать - нет
+	if _, ok := s.users[voterID]; !ok && value != 0 {
+		return errUserNotFound
+	}
+	t := target{kind, targetID}
+	b := ballot{t, voterID}
+	tally := s.votes[t].replace(s.ballots[b], value)
+	s.setScore(t, int32(tally.up-tally.down))
+	s.votes[t] = tally
+	if value == 0 {
+		delete(s.ballots, b)
+	} else {
+		s.ballots[b] = value
+	}
+	return nil
+}
+
+// setScore заменяет сохранённый пост или комментарий копией с новым счётом.
+// Возвращает false, если объекта нет. Вызывается под s.mu.
+func (s *InMemoryStorage) setScore(t target, score int32) bool {
+	if t.kind == TargetPost {
+		for i, p := range s.posts {
+			if p.ID == t.id {
+				updated := *p
+				updated.Score = score
+				s.posts[i] = &updated
+				return true
+			}
+		}
+		return false
+	}
+	for i, c := range s.comments {
+		if c.ID == t.id {
+			updated := *c
+			updated.Score = score
+			s.comments[i] = &updated
+			return true
+		}
+	}
+	return false
+}
+
+func (s *InMemoryStorage) ToggleReaction(ctx context.Context, kind TargetKind, targetID, userID, emoji string) (bool, error) {
+	if err := checkID(targetID); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists(kind, targetID) {
+		return false, targetNotFound(kind)
+	}
+	if _, ok := s.users[userID]; !ok {
+		return false, errUserNotFound
+	}
+	t := target{kind, targetID}
+	byEmoji := s.reactions[t]
+	if byEmoji == nil {
+		byEmoji = make(map[string]map[string]struct{})
+		s.reactions[t] = byEmoji
+	}
+	users := byEmoji[emoji]
+	if _, ok := users[userID]; ok {
+		delete(users, userID)
+		if len(users) == 0 {
+			delete(byEmoji, emoji)
+		}
+		return false, nil
+	}
+	if users == nil {
+		users = make(map[string]struct{})
+		byEmoji[emoji] = users
+	}
+	users[userID] = struct{}{}
+	return true, nil
+}
+
+func (s *InMemoryStorage) GetReactions(ctx context.Context, kind TargetKind, targetID, viewer string) ([]*model.Reaction, error) {
+	byTarget, err := s.GetReactionsByTargetIDs(ctx, kind, []string{targetID}, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if reactions := byTarget[targetID]; reactions != nil {
+		return reactions, nil
+	}
+	return []*model.Reaction{}, nil
+}
+
+func (s *InMemoryStorage) GetReactionsByTargetIDs(ctx context.Context, kind TargetKind, targetIDs []string, viewer string) (map[string][]*model.Reaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	byTarget := make(map[string][]*model.Reaction, len(targetIDs))
+	for _, id := range targetIDs {
+		var reactions []*model.Reaction
+		for emoji, users := range s.reactions[target{kind, id}] {
+			_, reacted := users[viewer]
+			reactions = append(reactions, &model.Reaction{Emoji: emoji, Count: int32(len(users)), ViewerReacted: reacted})
+		}
+		if len(reactions) > 0 {
+			sortReactions(reactions)
+			byTarget[id] = reactions
+		}
+	}
+	return byTarget, nil
+}
+
+func (s *InMemoryStorage) exists(kind TargetKind, id string) bool {
+	if kind == TargetPost {
+		return slices.ContainsFunc(s.posts, func(p *model.Post) bool { return p.ID == id })
+	}
+	return slices.ContainsFunc(s.comments, func(c *model.Comment) bool { return c.ID == id })
+}
+
+func (s *InMemoryStorage) Search(ctx context.Context, query string, types []model.SearchType, first, offset int) ([]*SearchHit, bool, error) {
+	terms := tokenize(query)
+	slices.Sort(terms)
+	terms = slices.Compact(terms)
+	wantPosts, wantComments := searchTypes(types)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	found := s.search.match(terms)
+	hits := make([]*SearchHit, 0, len(found))
+	for _, p := range s.posts {
+		if rank, ok := found[target{TargetPost, p.ID}]; ok && wantPosts {
+			hits = append(hits, &SearchHit{Post: p, Rank: rank})
+		}
+	}
+	for _, c := range s.comments {
+		if rank, ok := found[target{TargetComment, c.ID}]; ok && wantComments && !IsHidden(c) {
+			hits = append(hits, &SearchHit{Comment: c, Rank: rank})
+		}
+	}
+
+	// Порядок как в PostgreSQL: по релевантности, затем от новых к старым
+	key := func(h *SearchHit) Cursor {
+		if h.Post != nil {
+			return postKey(h.Post)
+		}
+		return commentKey(h.Comment)
+	}
+	slices.SortFunc(hits, func(a, b *SearchHit) int {
+		if c := cmp.Compare(b.Rank, a.Rank); c != 0 {
+			return c
+		}
+		return compareKeys(key(b), key(a))
+	})
+
+	hits = hits[min(offset, len(hits)):]
+	hasNext := len(hits) > first
+	hits = hits[:min(first, len(hits))]
+	for _, h := range hits {
+		if h.Post != nil {
+			h.Snippet = snippet(h.Post.Title+" "+h.Post.Content, terms)
+		} else {
+			h.Snippet = snippet(h.Comment.Text, terms)
+		}
+	}
+	return hits, hasNext, nil
+}
+
+func postSearchFields(p *model.Post) []weightedText {
+	return []weightedText{{p.Title, weightTitle}, {p.Content, weightContent}}
+}
+
+func commentSearchFields(c *model.Comment) []weightedText {
+	return []weightedText{{c.Text, weightComment}}
+}
+
+func (s *InMemoryStorage) ReportComment(ctx context.Context, commentID string, report *model.CommentReport) (*model.Comment, error) {
+	if err := checkID(commentID, report.ReporterID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.comments, func(c *model.Comment) bool { return c.ID == commentID && c.DeletedAt == nil && !IsHidden(c) })
+	if i < 0 {
+		return nil, errCommentNotFound
+	}
+	if _, ok := s.users[report.ReporterID]; !ok {
+		return nil, errUserNotFound
+	}
+	for _, r := range s.reports[commentID] {
+		if r.ReporterID == report.ReporterID {
+			return nil, fmt.Errorf("comment already reported by user %s: %w", report.ReporterID, ErrConflict)
+		}
+	}
+	stored := *report
+	s.reports[commentID] = append(s.reports[commentID], &stored)
+
+	c := s.comments[i]
+	if c.Status == model.CommentStatusPublished {
+		updated := *c
+		updated.Status = model.CommentStatusReported
+		s.comments[i] = &updated
+	}
+	return s.comments[i], nil
+}
+
+func (s *InMemoryStorage) GetCommentReports(ctx context.Context, commentID string) ([]*model.CommentReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.reports[commentID]), nil
+}
+
+func (s *InMemoryStorage) SetCommentStatus(ctx context.Context, commentID string, status model.CommentStatus) (*model.Comment, error) {
+	if err := checkID(commentID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.comments {
+		if c.ID == commentID && c.DeletedAt == nil {
+			if err := checkTransition(c.Status, status); err != nil {
+				return nil, err
+			}
+			updated := *c
+			updated.Status = status
+			updated.Published = c.Published || !hiddenStatus(status)
+			s.comments[i] = &updated
+			if delta := counterDelta(c.Status, status); delta != 0 {
+				s.adjustCounters(c.PostID, c.ParentID, int32(delta))
+			}
+			return &updated, nil
+		}
+	}
+	return nil, errCommentNotFound
+}
+
+func (s *InMemoryStorage) GetModerationQueue(ctx context.Context, status model.CommentStatus, first int, after *Cursor) ([]*model.Comment, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var queue []*model.Comment
+	for _, c := range s.comments {
+		if c.Status == status && c.DeletedAt == nil {
+			queue = append(queue, c)
+		}
+	}
+	page, hasNext := keysetPage(queue, commentKey, false, first, after)
+	return page, hasNext, nil
+}
+
+func (s *InMemoryStorage) GetCommentsByPostID(ctx context.Context, postID string, order model.CommentOrder, limit, offset int, visibility Visibility) ([]*model.Comment, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	var comments []*model.Comment
 	for _, c := range s.comments {
-		if c.PostID == postID && c.ParentID == nil {
+		if c.PostID == postID && c.ParentID == nil && visibility.Visible(c) {
 			comments = append(comments, c)
 		}
 	}
-	start := offset
-	end := offset + limit
-	if start > len(comments) {
-		return []*model.Comment{}, nil
+	return s.sortedPage(comments, order, limit, offset)
+}
+
+func (s *InMemoryStorage) GetRepliesByCommentID(ctx context.Context, commentID string, order model.CommentOrder, limit, offset int, visibility Visibility) ([]*model.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var replies []*model.Comment
+	for _, c := range s.comments {
+		if c.ParentID != nil && *c.ParentID == commentID && visibility.Visible(c) {
+			replies = append(replies, c)
+		}
 	}
-	if end > len(comments) {
-		end = len(comments)
+	return s.sortedPage(replies, order, limit, offset)
+}
+
+func (s *InMemoryStorage) GetCommentsPageByAuthorID(ctx context.Context, authorID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var comments []*model.Comment
+	for _, c := range s.comments {
+		if c.AuthorID == authorID && c.DeletedAt == nil && visibility.Visible(c) {
+			comments = append(comments, c)
+		}
 	}
-	return comments[start:end], nil
+	page, hasNext := keysetPage(comments, commentKey, true, first, after)
+	return page, hasNext, nil
 }
 
-func (s *InMemoryStorage) GetRepliesByCommentID(ctx context.Context, commentID string, limit, offset int) ([]*model.Comment, error) {
+func (s *InMemoryStorage) GetCommentsPageByPostID(ctx context.Context, postID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var comments []*model.Comment
+	for _, c := range s.comments {
+		if c.PostID == postID && c.ParentID == nil && visibility.Visible(c) {
+			comments = append(comments, c)
+		}
+	}
+	page, hasNext := keysetPage(comments, commentKey, false, first, after)
+	return page, hasNext, nil
+}
+
+func (s *InMemoryStorage) GetRepliesPageByCommentID(ctx context.Context, commentID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	var replies []*model.Comment
 	for _, c := range s.comments {
-		if c.ParentID != nil && *c.ParentID == commentID {
+		if c.ParentID != nil && *c.ParentID == commentID && visibility.Visible(c) {
 			replies = append(replies, c)
 		}
 	}
+	page, hasNext := keysetPage(replies, commentKey, false, first, after)
+	return page, hasNext, nil
+}
+
+func (s *InMemoryStorage) GetCommentTree(ctx context.Context, postID string, maxDepth, limitPerLevel int, visibility Visibility) ([]*model.CommentTreeNode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	children := childrenIndex(s.commentsOfPost(postID, visibility))
+	top := children[""]
+	top = top[:min(limitPerLevel, len(top))]
+	return assembleTree(walkTree(children, top, maxDepth, limitPerLevel)), nil
+}
+
+func (s *InMemoryStorage) GetCommentSubtree(ctx context.Context, commentID string, maxDepth, limitPerLevel int, visibility Visibility) (*model.CommentTreeNode, error) {
+	if err := checkID(commentID); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var root *model.Comment
+	for _, c := range s.comments {
+		if c.ID == commentID {
+			root = c
+			break
+		}
+	}
+	if root == nil || !visibility.Visible(root) {
+		return nil, errCommentNotFound
+	}
+	children := childrenIndex(s.commentsOfPost(root.PostID, visibility))
+	return assembleTree(walkTree(children, []*model.Comment{root}, maxDepth, limitPerLevel))[0], nil
+}
+
+// commentsOfPost возвращает комментарии поста, видимые с visibility.
+func (s *InMemoryStorage) commentsOfPost(postID string, visibility Visibility) []*model.Comment {
+	var comments []*model.Comment
+	for _, c := range s.comments {
+		if c.PostID == postID && visibility.Visible(c) {
+			comments = append(comments, c)
+		}
+	}
+	return comments
+}
+
+func (s *InMemoryStorage) GetCommentsByPostIDs(ctx context.Context, postIDs []string, order model.CommentOrder, limit, offset int, visibility Visibility) (map[string][]*model.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	wanted := toSet(postIDs)
+	grouped := make(map[string][]*model.Comment, len(postIDs))
+	for _, c := range s.comments {
+		if _, ok := wanted[c.PostID]; ok && c.ParentID == nil && visibility.Visible(c) {
+			grouped[c.PostID] = append(grouped[c.PostID], c)
+		}
+	}
+	for id, comments := range grouped {
+		page, err := s.sortedPage(comments, order, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		grouped[id] = page
+	}
+	return grouped, nil
+}
+
+func (s *InMemoryStorage) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, order model.CommentOrder, limit, offset int, visibility Visibility) (map[string][]*model.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	wanted := toSet(commentIDs)
+	grouped := make(map[string][]*model.Comment, len(commentIDs))
+	for _, c := range s.comments {
+		if c.ParentID == nil || !visibility.Visible(c) {
+			continue
+		}
+		if _, ok := wanted[*c.ParentID]; ok {
+			grouped[*c.ParentID] = append(grouped[*c.ParentID], c)
+		}
+	}
+	for id, replies := range grouped {
+		page, err := s.sortedPage(replies, order, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		grouped[id] = page
+	}
+	return grouped, nil
+}
+
+// sortedPage упорядочивает отфильтрованный список и вырезает из него страницу.
+// Вызывается под s.mu.
+func (s *InMemoryStorage) sortedPage(comments []*model.Comment, order model.CommentOrder, limit, offset int) ([]*model.Comment, error) {
+	sorted, err := sortComments(comments, order, func(id string) voteTally { return s.votes[target{TargetComment, id}] })
+	if err != nil {
+		return nil, err
+	}
+	return paginate(sorted, limit, offset), nil
+}
+
+// paginate вырезает страницу из уже отфильтрованного списка
+func paginate(comments []*model.Comment, limit, offset int) []*model.Comment {
 	start := offset
 	end := offset + limit
-	if start > len(replies) {
-		return []*model.Comment{}, nil
+	if start > len(comments) {
+		return []*model.Comment{}
 	}
-	if end > len(replies) {
-		end = len(replies)
+	if end > len(comments) {
+		end = len(comments)
+	}
+	return comments[start:end]
+}
+
+func postKey(p *model.Post) Cursor       { return Cursor{CreatedAt: p.CreatedAt, ID: p.ID} }
+func commentKey(c *model.Comment) Cursor { return Cursor{CreatedAt: c.CreatedAt, ID: c.ID} }
+
+func toSet(ids []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
 	}
-	return replies[start:end], nil
+	return set
 }
@@ -9,11 +9,12 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInMemoryStorage(t *testing.T) {
 	ctx := context.Background()
-	store := NewInMemoryStorage()
+	store := newTestInMemoryStorage(t)
 
 	t.Run("NewInMemoryStorage", func(t *testing.T) {
 		s := NewInMemoryStorage()
@@ -24,18 +25,18 @@ func TestInMemoryStorage(t *testing.T) {
 
 	t.Run("CreatePost", func(t *testing.T) {
 		post := &model.Post{
-			ID:            uuid.NewString(),
-			Title:         "Test Post",
-			Content:       "Content",
-			Author:        "Author",
-			AllowComments: true,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             uuid.NewString(),
+			Title:          "Test Post",
+			Content:        "Content",
+			AuthorID:       "Author",
+			ModerationMode: model.ModerationModeOpen,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		}
 		err := store.CreatePost(ctx, post)
 		assert.NoError(t, err)
 
 		// Проверяем, что пост добавлен
-		posts, err := store.GetPosts(ctx)
+		posts, _, err := store.GetPosts(ctx, nil, "", 10, nil)
 		assert.NoError(t, err)
 		assert.Len(t, posts, 1)
 		assert.Equal(t, post.ID, posts[0].ID)
@@ -43,12 +44,12 @@ func TestInMemoryStorage(t *testing.T) {
 
 	t.Run("GetPost", func(t *testing.T) {
 		post := &model.Post{
-			ID:            uuid.NewString(),
-			Title:         "Another Post",
-			Content:       "More Content",
-			Author:        "Another Author",
-			AllowComments: false,
-			CreatedAt:     time.Now().Format(time.RFC3339),
+			ID:             uuid.NewString(),
+			Title:          "Another Post",
+			Content:        "More Content",
+			AuthorID:       "Another Author",
+			ModerationMode: model.ModerationModeClosed,
+			CreatedAt:      time.Now().Format(time.RFC3339),
 		}
 		_ = store.CreatePost(ctx, post)
 
@@ -65,24 +66,24 @@ func TestInMemoryStorage(t *testing.T) {
 
 	t.Run("GetPosts", func(t *testing.T) {
 		// Уже есть два поста из предыдущих тестов
-		posts, err := store.GetPosts(ctx)
+		posts, _, err := store.GetPosts(ctx, nil, "", 10, nil)
 		assert.NoError(t, err)
 		assert.Len(t, posts, 2)
 
 		// Пустое хранилище
-		emptyStore := NewInMemoryStorage()
-		posts, err = emptyStore.GetPosts(ctx)
+		emptyStore := newTestInMemoryStorage(t)
+		posts, _, err = emptyStore.GetPosts(ctx, nil, "", 10, nil)
 		assert.NoError(t, err)
 		assert.Empty(t, posts)
 	})
 
 	t.Run("CreateComment", func(t *testing.T) {
 		postID := uuid.NewString()
-		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Comment", Content: "Content", Author: "Author", AllowComments: true})
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Comment", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
 
 		comment := &model.Comment{
 			PostID:    postID,
-			Author:    "User",
+			AuthorID:  "User",
 			Text:      "Test comment",
 			CreatedAt: time.Now().Format(time.RFC3339),
 		}
@@ -91,6 +92,9 @@ func TestInMemoryStorage(t *testing.T) {
 		created, err := store.CreateComment(ctx, comment)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, created.ID)
+		id, err := uuid.Parse(created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, uuid.Version(7), id.Version())
 
 		// Проверка, что комментарий добавлен
 		retrieved, err := store.GetComment(ctx, created.ID)
@@ -98,29 +102,37 @@ func TestInMemoryStorage(t *testing.T) {
 		assert.Equal(t, comment.Text, retrieved.Text)
 
 		// Несуществующий пост
-		invalidComment := &model.Comment{PostID: "non-existent-post", Author: "User", Text: "Invalid"}
+		invalidComment := &model.Comment{PostID: "non-existent-post", AuthorID: "User", Text: "Invalid"}
 		_, err = store.CreateComment(ctx, invalidComment)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "post with ID non-existent-post not found")
 
 		// Комментарий с parent_id
-		parentComment := &model.Comment{PostID: postID, Author: "User", Text: "Parent comment"}
+		parentComment := &model.Comment{PostID: postID, AuthorID: "User", Text: "Parent comment"}
 		parentCreated, _ := store.CreateComment(ctx, parentComment)
-		reply := &model.Comment{PostID: postID, ParentID: &parentCreated.ID, Author: "User", Text: "Reply"}
+		reply := &model.Comment{PostID: postID, ParentID: &parentCreated.ID, AuthorID: "User", Text: "Reply"}
 		_, err = store.CreateComment(ctx, reply)
 		assert.NoError(t, err)
 
 		// Несуществующий parent_id
-		invalidReply := &model.Comment{PostID: postID, ParentID: stringPtr("non-existent-parent"), Author: "User", Text: "Invalid reply"}
+		invalidReply := &model.Comment{PostID: postID, ParentID: stringPtr("non-existent-parent"), AuthorID: "User", Text: "Invalid reply"}
 		_, err = store.CreateComment(ctx, invalidReply)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "parent comment with ID non-existent-parent not found")
+
+		// Родитель из другого поста
+		otherPostID := uuid.NewString()
+		require.NoError(t, store.CreatePost(ctx, &model.Post{ID: otherPostID, Title: "Other", Content: "Content", AuthorID: "User", CreatedAt: time.Now().Format(time.RFC3339)}))
+		crossReply := &model.Comment{PostID: otherPostID, ParentID: &parentCreated.ID, AuthorID: "User", Text: "Cross reply"}
+		_, err = store.CreateComment(ctx, crossReply)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Contains(t, err.Error(), "in post "+otherPostID)
 	})
 
 	t.Run("GetComment", func(t *testing.T) {
 		postID := uuid.NewString()
-		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Comment", Content: "Content", Author: "Author", AllowComments: true})
-		comment := &model.Comment{PostID: postID, Author: "User", Text: "Another comment"}
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Comment", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		comment := &model.Comment{PostID: postID, AuthorID: "User", Text: "Another comment"}
 		created, _ := store.CreateComment(ctx, comment)
 
 		// Успешное получение
@@ -136,69 +148,838 @@ func TestInMemoryStorage(t *testing.T) {
 
 	t.Run("GetCommentsByPostID", func(t *testing.T) {
 		postID := uuid.NewString()
-		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Comments", Content: "Content", Author: "Author", AllowComments: true})
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Comments", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
 
 		// Добавляем три комментария
 		for i := 0; i < 3; i++ {
-			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, Author: "User", Text: fmt.Sprintf("Comment %d", i)})
+			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: fmt.Sprintf("Comment %d", i)})
 		}
 		// Добавляем комментарий к другому посту
 		otherPostID := uuid.NewString()
-		_ = store.CreatePost(ctx, &model.Post{ID: otherPostID, Title: "Other Post", Content: "Content", Author: "Author", AllowComments: true})
-		_, _ = store.CreateComment(ctx, &model.Comment{PostID: otherPostID, Author: "User", Text: "Other comment"})
+		_ = store.CreatePost(ctx, &model.Post{ID: otherPostID, Title: "Other Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		_, _ = store.CreateComment(ctx, &model.Comment{PostID: otherPostID, AuthorID: "User", Text: "Other comment"})
 
 		// Пагинация: первые два комментария
-		comments, err := store.GetCommentsByPostID(ctx, postID, 2, 0)
+		comments, err := store.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 2, 0, Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, comments, 2)
 
 		// Пагинация: третий комментарий
-		comments, err = store.GetCommentsByPostID(ctx, postID, 2, 2)
+		comments, err = store.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 2, 2, Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, comments, 1)
 
 		// Пагинация: за пределами
-		comments, err = store.GetCommentsByPostID(ctx, postID, 2, 10)
+		comments, err = store.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 2, 10, Visibility{})
 		assert.NoError(t, err)
 		assert.Empty(t, comments)
 
 		// Несуществующий пост
-		comments, err = store.GetCommentsByPostID(ctx, "non-existent-post", 2, 0)
+		comments, err = store.GetCommentsByPostID(ctx, "non-existent-post", model.CommentOrderOldest, 2, 0, Visibility{})
 		assert.NoError(t, err)
 		assert.Empty(t, comments)
 	})
 
 	t.Run("GetRepliesByCommentID", func(t *testing.T) {
 		postID := uuid.NewString()
-		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Replies", Content: "Content", Author: "Author", AllowComments: true})
-		parentComment := &model.Comment{PostID: postID, Author: "User", Text: "Parent comment"}
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post for Replies", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		parentComment := &model.Comment{PostID: postID, AuthorID: "User", Text: "Parent comment"}
 		parentCreated, _ := store.CreateComment(ctx, parentComment)
 
 		// Добавляем три ответа
 		for i := 0; i < 3; i++ {
-			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &parentCreated.ID, Author: "User", Text: fmt.Sprintf("Reply %d", i)})
+			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &parentCreated.ID, AuthorID: "User", Text: fmt.Sprintf("Reply %d", i)})
 		}
 
 		// Пагинация: первые два ответа
-		replies, err := store.GetRepliesByCommentID(ctx, parentCreated.ID, 2, 0)
+		replies, err := store.GetRepliesByCommentID(ctx, parentCreated.ID, model.CommentOrderOldest, 2, 0, Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, replies, 2)
 
 		// Пагинация: третий ответ
-		replies, err = store.GetRepliesByCommentID(ctx, parentCreated.ID, 2, 2)
+		replies, err = store.GetRepliesByCommentID(ctx, parentCreated.ID, model.CommentOrderOldest, 2, 2, Visibility{})
 		assert.NoError(t, err)
 		assert.Len(t, replies, 1)
 
 		// Пагинация: за пределами
-		replies, err = store.GetRepliesByCommentID(ctx, parentCreated.ID, 2, 10)
+		replies, err = store.GetRepliesByCommentID(ctx, parentCreated.ID, model.CommentOrderOldest, 2, 10, Visibility{})
 		assert.NoError(t, err)
 		assert.Empty(t, replies)
 
 		// Несуществующий комментарий
-		replies, err = store.GetRepliesByCommentID(ctx, "non-existent-comment", 2, 0)
+		replies, err = store.GetRepliesByCommentID(ctx, "non-existent-comment", model.CommentOrderOldest, 2, 0, Visibility{})
+		assert.NoError(t, err)
+		assert.Empty(t, replies)
+	})
+
+	t.Run("BatchLoads", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postA, postB := uuid.NewString(), uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postA, Title: "A", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		_ = store.CreatePost(ctx, &model.Post{ID: postB, Title: "B", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+
+		var parents []*model.Comment
+		for i := 0; i < 3; i++ {
+			a, _ := store.CreateComment(ctx, &model.Comment{PostID: postA, AuthorID: "User", Text: fmt.Sprintf("A%d", i)})
+			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postB, AuthorID: "User", Text: fmt.Sprintf("B%d", i)})
+			parents = append(parents, a)
+		}
+		for i := 0; i < 2; i++ {
+			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postA, ParentID: &parents[0].ID, AuthorID: "User", Text: fmt.Sprintf("R%d", i)})
+		}
+
+		byPost, err := store.GetCommentsByPostIDs(ctx, []string{postA, postB, "non-existent-post"}, model.CommentOrderOldest, 2, 1, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, byPost[postA], 2)
+		assert.Equal(t, "A1", byPost[postA][0].Text)
+		assert.Len(t, byPost[postB], 2)
+		assert.Empty(t, byPost["non-existent-post"])
+
+		byParent, err := store.GetRepliesByCommentIDs(ctx, []string{parents[0].ID, parents[1].ID}, model.CommentOrderOldest, 10, 0, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, byParent[parents[0].ID], 2)
+		assert.Empty(t, byParent[parents[1].ID])
+	})
+
+	t.Run("KeysetPages", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		// Два поста с одинаковым временем: порядок задаёт id
+		for i, id := range []string{"p1", "p2", "p3"} {
+			createdAt := base.Add(time.Duration(i/2) * time.Minute).Format(time.RFC3339Nano)
+			_ = store.CreatePost(ctx, &model.Post{ID: id, Title: id, Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen, CreatedAt: createdAt})
+		}
+
+		posts, hasNext, err := store.GetPosts(ctx, nil, model.PostOrderNewest, 2, nil)
+		assert.NoError(t, err)
+		assert.True(t, hasNext)
+		assert.Equal(t, "p3", posts[0].ID)
+		assert.Equal(t, "p2", posts[1].ID)
+
+		posts, hasNext, err = store.GetPosts(ctx, nil, model.PostOrderNewest, 2, &Cursor{CreatedAt: posts[1].CreatedAt, ID: posts[1].ID})
+		assert.NoError(t, err)
+		assert.False(t, hasNext)
+		assert.Len(t, posts, 1)
+		assert.Equal(t, "p1", posts[0].ID)
+
+		// Комментарии от старых к новым; новые не сдвигают уже выданные страницы
+		for i := 0; i < 4; i++ {
+			_, _ = store.CreateComment(ctx, &model.Comment{PostID: "p1", AuthorID: "User", Text: fmt.Sprintf("C%d", i),
+				CreatedAt: base.Add(time.Duration(i) * time.Second).Format(time.RFC3339Nano)})
+		}
+		page, hasNext, err := store.GetCommentsPageByPostID(ctx, "p1", 2, nil, Visibility{})
+		assert.NoError(t, err)
+		assert.True(t, hasNext)
+		assert.Equal(t, "C0", page[0].Text)
+		last := page[1]
+
+		_, _ = store.CreateComment(ctx, &model.Comment{PostID: "p1", AuthorID: "User", Text: "C4",
+			CreatedAt: base.Add(time.Hour).Format(time.RFC3339Nano)})
+
+		page, hasNext, err = store.GetCommentsPageByPostID(ctx, "p1", 2, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, Visibility{})
 		assert.NoError(t, err)
+		assert.True(t, hasNext)
+		assert.Equal(t, "C2", page[0].Text)
+		assert.Equal(t, "C3", page[1].Text)
+
+		replies, hasNext, err := store.GetRepliesPageByCommentID(ctx, last.ID, 10, nil, Visibility{})
+		assert.NoError(t, err)
+		assert.False(t, hasNext)
 		assert.Empty(t, replies)
 	})
+
+	t.Run("DeletePostCascades", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		root, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: "Root"})
+		_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Child"})
+
+		assert.NoError(t, store.DeletePost(ctx, postID))
+		_, err := store.GetComment(ctx, root.ID)
+		assert.Error(t, err)
+		assert.Empty(t, store.comments)
+		assert.Error(t, store.DeletePost(ctx, postID))
+	})
+
+	t.Run("SoftDeleteComment", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		root, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: "Root"})
+		child, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Child"})
+
+		assert.NoError(t, store.DeleteComment(ctx, root.ID, time.Now().Format(time.RFC3339Nano)))
+
+		// Надгробие остаётся на месте вместе с исходными данными
+		tombstone, err := store.GetComment(ctx, root.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, tombstone.DeletedAt)
+		assert.Equal(t, "Root", tombstone.Text)
+
+		comments, err := store.GetCommentsByPostID(ctx, postID, model.CommentOrderOldest, 10, 0, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, comments, 1)
+		replies, err := store.GetRepliesByCommentID(ctx, root.ID, model.CommentOrderOldest, 10, 0, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, replies, 1)
+		assert.Equal(t, child.ID, replies[0].ID)
+
+		err = store.DeleteComment(ctx, root.ID, time.Now().Format(time.RFC3339Nano))
+		assert.Error(t, err)
+		assert.Equal(t, "comment not found", err.Error())
+	})
+
+	t.Run("CommentRevisions", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		created, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: "v1"})
+
+		editedAt := time.Now().Format(time.RFC3339Nano)
+		edited := *created
+		edited.Text = "v2"
+		edited.EditedAt = &editedAt
+		// Блокировка после чтения копии не откатывается правкой
+		assert.NoError(t, store.SetThreadLocked(ctx, created.ID, true))
+		assert.NoError(t, store.UpdateComment(ctx, &edited, "alice"))
+		stored, err := store.GetComment(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", stored.Text)
+		assert.Equal(t, &editedAt, stored.EditedAt)
+		assert.True(t, stored.Locked)
+
+		revisions, err := store.GetCommentRevisions(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 1)
+		assert.Equal(t, "v1", revisions[0].Text)
+		assert.Equal(t, "alice", revisions[0].EditorID)
+		assert.Equal(t, editedAt, revisions[0].EditedAt)
+
+		revisions, err = store.GetCommentRevisions(ctx, "non-existent-comment")
+		assert.NoError(t, err)
+		assert.Empty(t, revisions)
+
+		counts, err := store.CountCommentRevisions(ctx, []string{created.ID, "non-existent-comment"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{created.ID: 1}, counts)
+
+		// PENDING в правке снимает комментарий с показа до повторной проверки
+		edited.Text = "v3"
+		edited.Status = model.CommentStatusPending
+		assert.NoError(t, store.UpdateComment(ctx, &edited, "alice"))
+		stored, err = store.GetComment(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, stored.Status)
+		post, err := store.GetPost(ctx, postID)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), post.CommentCount)
+		// Скрытый модератором комментарий правка в очередь не возвращает
+		_, err = store.SetCommentStatus(ctx, created.ID, model.CommentStatusRejected)
+		assert.NoError(t, err)
+		assert.NoError(t, store.UpdateComment(ctx, &edited, "alice"))
+		stored, err = store.GetComment(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, model.CommentStatusRejected, stored.Status)
+
+		// Удалённый комментарий править нельзя
+		assert.NoError(t, store.DeleteComment(ctx, created.ID, editedAt))
+		assert.Error(t, store.UpdateComment(ctx, &edited, "alice"))
+	})
+
+	t.Run("CommentTree", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		var roots []*model.Comment
+		for i := 0; i < 3; i++ {
+			root, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: fmt.Sprintf("Root %d", i)})
+			roots = append(roots, root)
+		}
+		for i := 0; i < 3; i++ {
+			_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &roots[0].ID, AuthorID: "User", Text: fmt.Sprintf("Reply %d", i)})
+		}
+		replies, _ := store.GetRepliesByCommentID(ctx, roots[0].ID, model.CommentOrderOldest, 1, 0, Visibility{})
+		deep, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &replies[0].ID, AuthorID: "User", Text: "Deep"})
+
+		tree, err := store.GetCommentTree(ctx, postID, 1, 2, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, tree, 2)
+		assert.Equal(t, "Root 0", tree[0].Comment.Text)
+		assert.Equal(t, int32(3), tree[0].ReplyCount)
+		assert.Len(t, tree[0].Children, 2)
+		assert.Equal(t, "Reply 0", tree[0].Children[0].Comment.Text)
+		assert.Equal(t, int32(1), tree[0].Children[0].Depth)
+		// Ответ на третьем уровне не попадает в дерево, но учитывается в replyCount
+		assert.Equal(t, int32(1), tree[0].Children[0].ReplyCount)
+		assert.Empty(t, tree[0].Children[0].Children)
+
+		subtree, err := store.GetCommentSubtree(ctx, replies[0].ID, 3, 10, Visibility{})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), subtree.Depth)
+		assert.Len(t, subtree.Children, 1)
+		assert.Equal(t, deep.ID, subtree.Children[0].Comment.ID)
+
+		_, err = store.GetCommentSubtree(ctx, "non-existent-id", 3, 10, Visibility{})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("CommentPaths", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		root, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: "Root"})
+		child, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Child"})
+		grandchild, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &child.ID, AuthorID: "User", Text: "Grandchild"})
+		_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Sibling"})
+
+		assert.Equal(t, int32(0), root.Depth)
+		assert.Equal(t, int32(2), grandchild.Depth)
+
+		ancestors, err := store.GetCommentAncestors(ctx, grandchild.ID, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, ancestors, 2)
+		assert.Equal(t, root.ID, ancestors[0].ID)
+		assert.Equal(t, child.ID, ancestors[1].ID)
+
+		n, err := store.CountDescendants(ctx, root.ID, Visibility{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+		n, err = store.CountDescendants(ctx, grandchild.ID, Visibility{})
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+		byComment, err := store.GetCommentAncestorsByIDs(ctx, []string{root.ID, child.ID, grandchild.ID}, Visibility{})
+		assert.NoError(t, err)
+		assert.Len(t, byComment, 2)
+		if assert.Len(t, byComment[child.ID], 1) {
+			assert.Equal(t, root.ID, byComment[child.ID][0].ID)
+		}
+		assert.Len(t, byComment[grandchild.ID], 2)
+		counts, err := store.CountDescendantsByIDs(ctx, []string{root.ID, child.ID, grandchild.ID}, Visibility{})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{root.ID: 3, child.ID: 1}, counts)
+
+		_, err = store.SetCommentStatus(ctx, child.ID, model.CommentStatusHidden)
+		assert.NoError(t, err)
+		ancestors, err = store.GetCommentAncestors(ctx, grandchild.ID, Visibility{AuthorID: "User"})
+		assert.NoError(t, err)
+		assert.Len(t, ancestors, 1)
+		assert.Equal(t, root.ID, ancestors[0].ID)
+		ancestors, err = store.GetCommentAncestors(ctx, grandchild.ID, Visibility{All: true})
+		assert.NoError(t, err)
+		assert.Len(t, ancestors, 2)
+		// Скрытый потомок считается только для тех, кто его видит
+		n, err = store.CountDescendants(ctx, root.ID, Visibility{AuthorID: "User"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		n, err = store.CountDescendants(ctx, root.ID, Visibility{All: true})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		ancestors, err = store.GetCommentAncestors(ctx, "non-existent-id", Visibility{})
+		assert.NoError(t, err)
+		assert.Empty(t, ancestors)
+	})
+
+	t.Run("Counters", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		root, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: "Root"})
+		reply, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Reply"})
+		_, _ = store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Reply 2"})
+
+		post, _ := store.GetPost(ctx, postID)
+		assert.Equal(t, int32(3), post.CommentCount)
+		assert.Equal(t, int32(1), post.TopLevelCommentCount)
+		parent, _ := store.GetComment(ctx, root.ID)
+		assert.Equal(t, int32(2), parent.ReplyCount)
+
+		// Правка поста не затирает счётчики, посчитанные хранилищем
+		assert.NoError(t, store.UpdatePost(ctx, &model.Post{ID: postID, Title: "New", Content: "Content", AuthorID: "Author"}))
+		assert.NoError(t, store.DeleteComment(ctx, reply.ID, time.Now().Format(time.RFC3339Nano)))
+		post, _ = store.GetPost(ctx, postID)
+		assert.Equal(t, int32(2), post.CommentCount)
+		assert.Equal(t, int32(1), post.TopLevelCommentCount)
+		parent, _ = store.GetComment(ctx, root.ID)
+		assert.Equal(t, int32(1), parent.ReplyCount)
+
+		// Комментарии, скрытые от читателей, не считаются
+		pending, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, ParentID: &root.ID, AuthorID: "User", Text: "Pending", Status: model.CommentStatusPending})
+		post, _ = store.GetPost(ctx, postID)
+		assert.Equal(t, int32(2), post.CommentCount)
+		_, err := store.SetCommentStatus(ctx, pending.ID, model.CommentStatusApproved)
+		assert.NoError(t, err)
+		post, _ = store.GetPost(ctx, postID)
+		assert.Equal(t, int32(3), post.CommentCount)
+		parent, _ = store.GetComment(ctx, root.ID)
+		assert.Equal(t, int32(2), parent.ReplyCount)
+
+		_, err = store.SetCommentStatus(ctx, root.ID, model.CommentStatusHidden)
+		assert.NoError(t, err)
+		post, _ = store.GetPost(ctx, postID)
+		assert.Equal(t, int32(2), post.CommentCount)
+		assert.Equal(t, int32(0), post.TopLevelCommentCount)
+		_, err = store.SetCommentStatus(ctx, root.ID, model.CommentStatusRejected)
+		assert.NoError(t, err)
+		// Удаление скрытого комментария счётчики не трогает
+		assert.NoError(t, store.DeleteComment(ctx, root.ID, time.Now().Format(time.RFC3339Nano)))
+		post, _ = store.GetPost(ctx, postID)
+		assert.Equal(t, int32(2), post.CommentCount)
+		assert.Equal(t, int32(0), post.TopLevelCommentCount)
+	})
+
+	t.Run("VotesAndReactions", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		postID := uuid.NewString()
+		_ = store.CreatePost(ctx, &model.Post{ID: postID, Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen})
+		comment, _ := store.CreateComment(ctx, &model.Comment{PostID: postID, AuthorID: "User", Text: "Comment"})
+
+		// Повторный голос того же пользователя заменяет прежний
+		assert.NoError(t, store.Vote(ctx, TargetComment, comment.ID, "alice", 1))
+		assert.NoError(t, store.Vote(ctx, TargetComment, comment.ID, "alice", 1))
+		assert.NoError(t, store.Vote(ctx, TargetComment, comment.ID, "bob", 1))
+		assert.NoError(t, store.Vote(ctx, TargetComment, comment.ID, "bob", -1))
+		got, _ := store.GetComment(ctx, comment.ID)
+		assert.Equal(t, int32(0), got.Score)
+		assert.NoError(t, store.Vote(ctx, TargetComment, comment.ID, "bob", 0))
+		got, _ = store.GetComment(ctx, comment.ID)
+		assert.Equal(t, int32(1), got.Score)
+
+		assert.NoError(t, store.Vote(ctx, TargetPost, postID, "alice", -1))
+		post, _ := store.GetPost(ctx, postID)
+		assert.Equal(t, int32(-1), post.Score)
+		assert.ErrorIs(t, store.Vote(ctx, TargetComment, "non-existent-id", "alice", 1), ErrNotFound)
+		assert.ErrorIs(t, store.Vote(ctx, TargetComment, comment.ID, "missing", 1), ErrNotFound)
+
+		reacted, err := store.ToggleReaction(ctx, TargetPost, postID, "alice", "👍")
+		assert.NoError(t, err)
+		assert.True(t, reacted)
+		_, _ = store.ToggleReaction(ctx, TargetPost, postID, "bob", "👍")
+		_, _ = store.ToggleReaction(ctx, TargetPost, postID, "bob", "🎉")
+		reactions, err := store.GetReactions(ctx, TargetPost, postID, "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.Reaction{
+			{Emoji: "👍", Count: 2, ViewerReacted: true},
+			{Emoji: "🎉", Count: 1},
+		}, reactions)
+		byTarget, err := store.GetReactionsByTargetIDs(ctx, TargetPost, []string{postID, "non-existent-id"}, "bob")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]*model.Reaction{postID: {
+			{Emoji: "👍", Count: 2, ViewerReacted: true},
+			{Emoji: "🎉", Count: 1, ViewerReacted: true},
+		}}, byTarget)
+
+		reacted, err = store.ToggleReaction(ctx, TargetPost, postID, "alice", "👍")
+		assert.NoError(t, err)
+		assert.False(t, reacted)
+		_, err = store.ToggleReaction(ctx, TargetComment, "non-existent-id", "alice", "👍")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Голоса и реакции удаляются вместе с постом
+		assert.NoError(t, store.DeletePost(ctx, postID))
+		assert.Empty(t, store.votes)
+		assert.Empty(t, store.ballots)
+		assert.Empty(t, store.reactions)
+	})
+
+	t.Run("PostFeed", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		modes := []model.ModerationMode{model.ModerationModeOpen, model.ModerationModeClosed, model.ModerationModePremoderated, model.ModerationModeClosed}
+		for i, author := range []string{"alice", "bob", "alice", "bob"} {
+			_ = store.CreatePost(ctx, &model.Post{ID: fmt.Sprintf("p%d", i), Title: "Post", Content: "Content", AuthorID: author,
+				ModerationMode: modes[i], CreatedAt: base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339Nano)})
+		}
+		_, _ = store.CreateComment(ctx, &model.Comment{PostID: "p1", AuthorID: "User", Text: "Comment"})
+		_ = store.Vote(ctx, TargetPost, "p2", "User", 1)
+		ids := func(posts []*model.Post) []string {
+			var ids []string
+			for _, p := range posts {
+				ids = append(ids, p.ID)
+			}
+			return ids
+		}
+
+		author := "alice"
+		posts, _, err := store.GetPosts(ctx, &model.PostFilter{AuthorID: &author}, model.PostOrderOldest, 10, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"p0", "p2"}, ids(posts))
+
+		closed := false
+		after, before := base.Format(time.RFC3339Nano), base.Add(3*time.Minute).Format(time.RFC3339Nano)
+		posts, _, _ = store.GetPosts(ctx, &model.PostFilter{CreatedAfter: &after, CreatedBefore: &before, AllowComments: &closed}, "", 10, nil)
+		assert.Equal(t, []string{"p1"}, ids(posts))
+		premoderated := model.ModerationModePremoderated
+		posts, _, _ = store.GetPosts(ctx, &model.PostFilter{ModerationMode: &premoderated}, "", 10, nil)
+		assert.Equal(t, []string{"p2"}, ids(posts))
+
+		// При равном ключе - от новых к старым
+		posts, hasNext, _ := store.GetPosts(ctx, nil, model.PostOrderTop, 2, nil)
+		assert.True(t, hasNext)
+		assert.Equal(t, []string{"p2", "p3"}, ids(posts))
+		cursor := PostCursor(model.PostOrderTop, posts[1])
+		posts, hasNext, _ = store.GetPosts(ctx, nil, model.PostOrderTop, 2, &cursor)
+		assert.False(t, hasNext)
+		assert.Equal(t, []string{"p1", "p0"}, ids(posts))
+
+		posts, _, _ = store.GetPosts(ctx, nil, model.PostOrderMostCommented, 1, nil)
+		assert.Equal(t, []string{"p1"}, ids(posts))
+
+		_, _, err = store.GetPosts(ctx, nil, model.PostOrderNewest, 2, &cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		for _, id := range []string{"p1", "p2"} {
+			_ = store.CreatePost(ctx, &model.Post{ID: id, Title: "Post", Content: "Content", AuthorID: "Author", CreatedAt: time.Now().Format(time.RFC3339Nano)})
+		}
+		assert.NoError(t, store.SetPostTags(ctx, "p1", []string{"go", "databases"}))
+		assert.NoError(t, store.SetPostTags(ctx, "p2", []string{"go"}))
+		assert.ErrorIs(t, store.SetPostTags(ctx, "non-existent-id", []string{"go"}), ErrNotFound)
+
+		byPost, err := store.GetTagsByPostIDs(ctx, []string{"p1", "p2", "p3"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{"p1": {"databases", "go"}, "p2": {"go"}}, byPost)
+
+		tags, err := store.GetTags(ctx, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.Tag{{Name: "go", PostCount: 2}, {Name: "databases", PostCount: 1}}, tags)
+
+		tag := "databases"
+		posts, _, _ := store.GetPosts(ctx, &model.PostFilter{Tag: &tag}, "", 10, nil)
+		assert.Len(t, posts, 1)
+		assert.Equal(t, "p1", posts[0].ID)
+
+		// Пустой список снимает теги, удаление поста - тоже
+		assert.NoError(t, store.SetPostTags(ctx, "p1", nil))
+		assert.NoError(t, store.DeletePost(ctx, "p2"))
+		tags, _ = store.GetTags(ctx, 10)
+		assert.Empty(t, tags)
+
+		// Теги нового поста сохраняются вместе с ним; отвергнутый пост их не оставляет
+		tagged := &model.Post{ID: "p3", Title: "Post", Content: "Content", AuthorID: "Author", Tags: []string{"sql", "go"}, CreatedAt: time.Now().Format(time.RFC3339Nano)}
+		assert.NoError(t, store.CreatePost(ctx, tagged))
+		assert.ErrorIs(t, store.CreatePost(ctx, &model.Post{ID: "p3", AuthorID: "Author", Tags: []string{"dup"}}), ErrConflict)
+		assert.ErrorIs(t, store.CreatePost(ctx, &model.Post{ID: "p4", AuthorID: "missing", Tags: []string{"orphan"}}), ErrNotFound)
+		byPost, _ = store.GetTagsByPostIDs(ctx, []string{"p3", "p4"})
+		assert.Equal(t, map[string][]string{"p3": {"go", "sql"}}, byPost)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		titled := &model.Post{ID: uuid.NewString(), Title: "Go generics", Content: "Type parameters", AuthorID: "Author", CreatedAt: "2024-01-01T00:00:00Z"}
+		mentioned := &model.Post{ID: uuid.NewString(), Title: "Weekly notes", Content: "Some words about Go and its generics", AuthorID: "Author", CreatedAt: "2024-01-02T00:00:00Z"}
+		_ = store.CreatePost(ctx, titled)
+		_ = store.CreatePost(ctx, mentioned)
+		comment, _ := store.CreateComment(ctx, &model.Comment{PostID: titled.ID, AuthorID: "User", Text: "Generics in Go, finally!", CreatedAt: "2024-01-03T00:00:00Z"})
+
+		// Совпадение в заголовке весит больше, чем в тексте поста и в комментарии
+		hits, hasNext, err := store.Search(ctx, "GO generics", nil, 10, 0)
+		assert.NoError(t, err)
+		assert.False(t, hasNext)
+		require.Len(t, hits, 3)
+		assert.Equal(t, titled.ID, hits[0].Post.ID)
+		assert.Equal(t, mentioned.ID, hits[1].Post.ID)
+		assert.Equal(t, comment.ID, hits[2].Comment.ID)
+		assert.Greater(t, hits[0].Rank, hits[1].Rank)
+		assert.Equal(t, "<b>Generics</b> in <b>Go</b>, finally", hits[2].Snippet)
+
+		hits, hasNext, _ = store.Search(ctx, "generics", []model.SearchType{model.SearchTypePost}, 1, 0)
+		assert.True(t, hasNext)
+		require.Len(t, hits, 1)
+		assert.Equal(t, titled.ID, hits[0].Post.ID)
+		hits, _, _ = store.Search(ctx, "generics", []model.SearchType{model.SearchTypePost}, 1, 1)
+		require.Len(t, hits, 1)
+		assert.Equal(t, mentioned.ID, hits[0].Post.ID)
+
+		// Все слова запроса должны встретиться
+		hits, _, _ = store.Search(ctx, "generics rust", nil, 10, 0)
+		assert.Empty(t, hits)
+
+		// Правка переиндексирует, удалённый комментарий не ищется
+		edited := *comment
+		edited.Text = "Rust traits"
+		assert.NoError(t, store.UpdateComment(ctx, &edited, "User"))
+		hits, _, _ = store.Search(ctx, "rust", nil, 10, 0)
+		require.Len(t, hits, 1)
+		assert.Equal(t, "<b>Rust</b> traits", hits[0].Snippet)
+		assert.NoError(t, store.DeleteComment(ctx, comment.ID, "2024-01-04T00:00:00Z"))
+		hits, _, _ = store.Search(ctx, "rust", nil, 10, 0)
+		assert.Empty(t, hits)
+
+		// Разметка из текста экранируется, в фрагменте остаётся только <b>
+		markup, _ := store.CreateComment(ctx, &model.Comment{PostID: titled.ID, AuthorID: "User", Text: `Say "<i>hi</i>" & hello`, CreatedAt: "2024-01-05T00:00:00Z"})
+		hits, _, _ = store.Search(ctx, "hello", nil, 10, 0)
+		require.Len(t, hits, 1)
+		assert.Equal(t, "Say &#34;&lt;i&gt;hi&lt;/i&gt;&#34; &amp; <b>hello</b>", hits[0].Snippet)
+		assert.NoError(t, store.DeleteComment(ctx, markup.ID, "2024-01-05T00:00:00Z"))
+
+		assert.NoError(t, store.DeletePost(ctx, titled.ID))
+		assert.NoError(t, store.DeletePost(ctx, mentioned.ID))
+		assert.Empty(t, store.search.postings)
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		user := &model.User{ID: uuid.NewString(), DisplayName: "Carol", CreatedAt: "2024-01-01T00:00:00Z"}
+		require.NoError(t, store.CreateUser(ctx, user))
+		assert.ErrorIs(t, store.CreateUser(ctx, user), ErrConflict)
+
+		got, err := store.GetUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Carol", got.DisplayName)
+		_, err = store.GetUser(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		users, err := store.GetUsersByIDs(ctx, []string{user.ID, "missing"})
+		require.NoError(t, err)
+		assert.Len(t, users, 1)
+
+		err = store.CreatePost(ctx, &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: "missing"})
+		assert.ErrorIs(t, err, ErrNotFound)
+		post := &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: user.ID, ModerationMode: model.ModerationModeOpen}
+		require.NoError(t, store.CreatePost(ctx, post))
+		_, err = store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "missing", Text: "Comment"})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			c, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: user.ID, Text: fmt.Sprintf("c%d", i),
+				CreatedAt: fmt.Sprintf("2024-01-0%dT00:00:00Z", i+1)})
+			require.NoError(t, err)
+			ids = append(ids, c.ID)
+		}
+		_, err = store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "User", Text: "Other"})
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteComment(ctx, ids[1], "2024-01-05T00:00:00Z"))
+
+		// Удалённые комментарии не попадают в список, порядок - от новых к старым
+		page, hasNext, err := store.GetCommentsPageByAuthorID(ctx, user.ID, 1, nil, Visibility{})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, ids[2], page[0].ID)
+		assert.True(t, hasNext)
+		page, hasNext, err = store.GetCommentsPageByAuthorID(ctx, user.ID, 1, &Cursor{CreatedAt: page[0].CreatedAt, ID: page[0].ID}, Visibility{})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, ids[0], page[0].ID)
+		assert.False(t, hasNext)
+	})
+
+	t.Run("Moderation", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		post := &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen}
+		require.NoError(t, store.CreatePost(ctx, post))
+		var ids []string
+		for i := 0; i < 3; i++ {
+			c, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "User", Text: fmt.Sprintf("c%d", i),
+				CreatedAt: fmt.Sprintf("2024-01-0%dT00:00:00Z", i+1)})
+			require.NoError(t, err)
+			assert.Equal(t, model.CommentStatusPublished, c.Status)
+			ids = append(ids, c.ID)
+		}
+		reply, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, ParentID: &ids[0], AuthorID: "User", Text: "Reply",
+			CreatedAt: "2024-01-04T00:00:00Z"})
+		require.NoError(t, err)
+
+		report := func(commentID, reporter string) (*model.Comment, error) {
+			return store.ReportComment(ctx, commentID, &model.CommentReport{ReporterID: reporter, Reason: "spam", CreatedAt: "2024-02-01T00:00:00Z"})
+		}
+		reported, err := report(ids[0], "alice")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusReported, reported.Status)
+		_, err = report(ids[0], "bob")
+		require.NoError(t, err)
+		_, err = report(ids[0], "alice")
+		assert.ErrorIs(t, err, ErrConflict)
+		_, err = report(ids[0], "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = report("non-existent-id", "alice")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = report(reply.ID, "alice")
+		require.NoError(t, err)
+
+		reports, err := store.GetCommentReports(ctx, ids[0])
+		require.NoError(t, err)
+		require.Len(t, reports, 2)
+		assert.Equal(t, "alice", reports[0].ReporterID)
+
+		queue, hasNext, err := store.GetModerationQueue(ctx, model.CommentStatusReported, 1, nil)
+		require.NoError(t, err)
+		require.Len(t, queue, 1)
+		assert.Equal(t, ids[0], queue[0].ID)
+		assert.True(t, hasNext)
+
+		// Переходы: скрытый можно вернуть, отклонённый - нет
+		hidden, err := store.SetCommentStatus(ctx, ids[0], model.CommentStatusHidden)
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusHidden, hidden.Status)
+		// На скрытый комментарий жалоба не принимается, как на несуществующий
+		_, err = report(ids[0], "User")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.SetCommentStatus(ctx, ids[1], model.CommentStatusApproved)
+		assert.ErrorIs(t, err, ErrConflict)
+		_, err = store.SetCommentStatus(ctx, ids[2], model.CommentStatusHidden)
+		require.NoError(t, err)
+		_, err = store.SetCommentStatus(ctx, ids[2], model.CommentStatusRejected)
+		require.NoError(t, err)
+		_, err = store.SetCommentStatus(ctx, ids[2], model.CommentStatusApproved)
+		assert.ErrorIs(t, err, ErrConflict)
+		_, err = store.SetCommentStatus(ctx, "non-existent-id", model.CommentStatusHidden)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Читателям скрытые комментарии не видны ни в одной выдаче, модераторам - в списках
+		comments, err := store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{})
+		require.NoError(t, err)
+		require.Len(t, comments, 1)
+		assert.Equal(t, ids[1], comments[0].ID)
+		comments, err = store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{All: true})
+		require.NoError(t, err)
+		assert.Len(t, comments, 3)
+		byPost, err := store.GetCommentsByPostIDs(ctx, []string{post.ID}, model.CommentOrderOldest, 10, 0, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, byPost[post.ID], 1)
+		page, _, err := store.GetCommentsPageByPostID(ctx, post.ID, 10, nil, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, page, 1)
+		tree, err := store.GetCommentTree(ctx, post.ID, 3, 10, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, tree, 1)
+		byAuthor, _, err := store.GetCommentsPageByAuthorID(ctx, "User", 10, nil, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, byAuthor, 2)
+		page, _, err = store.GetCommentsPageByPostID(ctx, post.ID, 10, nil, Visibility{All: true})
+		require.NoError(t, err)
+		assert.Len(t, page, 3)
+		tree, err = store.GetCommentTree(ctx, post.ID, 3, 10, Visibility{All: true})
+		require.NoError(t, err)
+		assert.Len(t, tree, 3)
+		_, err = store.GetCommentSubtree(ctx, ids[0], 3, 10, Visibility{})
+		assert.ErrorIs(t, err, ErrNotFound)
+		subtree, err := store.GetCommentSubtree(ctx, ids[0], 3, 10, Visibility{All: true})
+		require.NoError(t, err)
+		assert.Equal(t, ids[0], subtree.Comment.ID)
+
+		// Ответы скрытого комментария не скрываются сами по себе
+		_, err = store.SetCommentStatus(ctx, reply.ID, model.CommentStatusApproved)
+		require.NoError(t, err)
+		replies, err := store.GetRepliesByCommentID(ctx, ids[0], model.CommentOrderOldest, 10, 0, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, replies, 1)
+		reported, err = report(reply.ID, "bob")
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusApproved, reported.Status)
+
+		approved, err := store.SetCommentStatus(ctx, ids[0], model.CommentStatusApproved)
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusApproved, approved.Status)
+		comments, err = store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, comments, 2)
+		queue, _, err = store.GetModerationQueue(ctx, model.CommentStatusReported, 10, nil)
+		require.NoError(t, err)
+		assert.Empty(t, queue)
+	})
+
+	t.Run("Premoderation", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		post := &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: "Author"}
+		require.NoError(t, store.CreatePost(ctx, post))
+		assert.Equal(t, model.ModerationModeOpen, post.ModerationMode)
+
+		pending, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "alice", Text: "Pending", Status: model.CommentStatusPending})
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPending, pending.Status)
+		assert.False(t, pending.Published)
+		// Остальные статусы при создании не принимаются
+		published, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "bob", Text: "Published", Status: model.CommentStatusApproved})
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusPublished, published.Status)
+		assert.True(t, published.Published)
+
+		for _, tc := range []struct {
+			name       string
+			visibility Visibility
+			want       int
+		}{
+			{"Reader", Visibility{AuthorID: "bob"}, 1},
+			{"Author", Visibility{AuthorID: "alice"}, 2},
+			{"Moderator", Visibility{All: true}, 2},
+		} {
+			comments, err := store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, tc.visibility)
+			require.NoError(t, err)
+			assert.Len(t, comments, tc.want, tc.name)
+			page, _, err := store.GetCommentsPageByPostID(ctx, post.ID, 10, nil, tc.visibility)
+			require.NoError(t, err)
+			assert.Len(t, page, tc.want, tc.name)
+			tree, err := store.GetCommentTree(ctx, post.ID, 3, 10, tc.visibility)
+			require.NoError(t, err)
+			assert.Len(t, tree, tc.want, tc.name)
+		}
+		byAuthor, _, err := store.GetCommentsPageByAuthorID(ctx, "alice", 10, nil, Visibility{AuthorID: "alice"})
+		require.NoError(t, err)
+		assert.Len(t, byAuthor, 1)
+		byAuthor, _, err = store.GetCommentsPageByAuthorID(ctx, "alice", 10, nil, Visibility{AuthorID: "bob"})
+		require.NoError(t, err)
+		assert.Empty(t, byAuthor)
+
+		queue, _, err := store.GetModerationQueue(ctx, model.CommentStatusPending, 10, nil)
+		require.NoError(t, err)
+		require.Len(t, queue, 1)
+		assert.Equal(t, pending.ID, queue[0].ID)
+		_, err = store.SetCommentStatus(ctx, pending.ID, model.CommentStatusHidden)
+		assert.ErrorIs(t, err, ErrConflict)
+		approved, err := store.SetCommentStatus(ctx, pending.ID, model.CommentStatusApproved)
+		require.NoError(t, err)
+		assert.Equal(t, model.CommentStatusApproved, approved.Status)
+		assert.True(t, approved.Published)
+		comments, err := store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{})
+		require.NoError(t, err)
+		assert.Len(t, comments, 2)
+	})
+
+	t.Run("TypedErrors", func(t *testing.T) {
+		store := newTestInMemoryStorage(t)
+		post := &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen}
+		assert.NoError(t, store.CreatePost(ctx, post))
+
+		err := store.CreatePost(ctx, post)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		_, err = store.GetPost(ctx, "non-existent-id")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.GetComment(ctx, "non-existent-id")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.CreateComment(ctx, &model.Comment{PostID: post.ID, ParentID: stringPtr("non-existent-parent"), AuthorID: "User", Text: "Reply"})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = store.GetPost(ctx, "")
+		assert.ErrorIs(t, err, ErrInvalidID)
+		_, err = store.GetComment(ctx, string(make([]byte, 37)))
+		assert.ErrorIs(t, err, ErrInvalidID)
+	})
+}
+
+// testAuthors - пользователи, от имени которых тесты пишут посты и комментарии;
+// ID совпадает с именем.
+var testAuthors = []string{"Author", "Another Author", "User", "alice", "bob"}
+
+// seedUsers заводит в хранилище пользователей testAuthors.
+func seedUsers(t *testing.T, store Storage) {
+	t.Helper()
+	for _, name := range testAuthors {
+		user := &model.User{ID: name, DisplayName: name, CreatedAt: time.Now().Format(time.RFC3339)}
+		require.NoError(t, store.CreateUser(context.Background(), user))
+	}
+}
+
+func newTestInMemoryStorage(t *testing.T) *InMemoryStorage {
+	t.Helper()
+	store := NewInMemoryStorage()
+	seedUsers(t, store)
+	return store
 }
 
 // Вспомогательная функция для создания указателя на строку
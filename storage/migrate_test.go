@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "versions must be consecutive")
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+	}
+	assert.NotEmpty(t, migrations[0].Down)
+}
+
+func TestMigrator(t *testing.T) {
+	store := newTestPostgres(t)
+	ctx := context.Background()
+	migrator, err := store.Migrator()
+	require.NoError(t, err)
+
+	// newTestPostgres уже применил всё, повторный запуск ничего не делает
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Len(t, statuses, len(migrator.migrations))
+	for _, st := range statuses {
+		assert.NotNil(t, st.AppliedAt, "migration %04d_%s", st.Version, st.Name)
+	}
+}
@@ -1,4 +1,6 @@
-CREATE TABLE posts (
+-- Исходная схема. IF NOT EXISTS позволяет принять под управление миграций
+-- базы, созданные раньше из schema.sql через docker-entrypoint-initdb.d.
+CREATE TABLE IF NOT EXISTS posts (
     id VARCHAR(36) PRIMARY KEY,
     title VARCHAR(255) NOT NULL,
     content TEXT NOT NULL,
@@ -7,7 +9,7 @@ CREATE TABLE posts (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE comments (
+CREATE TABLE IF NOT EXISTS comments (
     id BIGSERIAL PRIMARY KEY,
     post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
     parent_id BIGINT REFERENCES comments(id) ON DELETE CASCADE,
@@ -16,5 +18,5 @@ CREATE TABLE comments (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE INDEX idx_comments_post_id ON comments(post_id);
-CREATE INDEX idx_comments_parent_id ON comments(parent_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
@@ -0,0 +1,16 @@
+-- Текстовые ID комментариев (UUIDv7 выдаёт приложение). Старые числовые ID
+-- сохраняются как строки: для клиентов ID непрозрачны. Обратной миграции нет,
+-- UUID нельзя вернуть в BIGINT.
+ALTER TABLE comment_revisions DROP CONSTRAINT IF EXISTS comment_revisions_comment_id_fkey;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_parent_id_fkey;
+
+ALTER TABLE comments ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE comments ALTER COLUMN id TYPE VARCHAR(36) USING id::text;
+ALTER TABLE comments ALTER COLUMN parent_id TYPE VARCHAR(36) USING parent_id::text;
+ALTER TABLE comment_revisions ALTER COLUMN comment_id TYPE VARCHAR(36) USING comment_id::text;
+DROP SEQUENCE IF EXISTS comments_id_seq;
+
+ALTER TABLE comments ADD CONSTRAINT comments_parent_id_fkey
+    FOREIGN KEY (parent_id) REFERENCES comments(id);
+ALTER TABLE comment_revisions ADD CONSTRAINT comment_revisions_comment_id_fkey
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE;
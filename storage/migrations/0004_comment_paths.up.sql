@@ -0,0 +1,16 @@
+-- Материализованный путь: ID всех предков и самого комментария через '/'.
+-- Сортировка "C" нужна, чтобы поддерево читалось диапазоном по индексу.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS path TEXT COLLATE "C";
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth INT NOT NULL DEFAULT 0;
+
+WITH RECURSIVE tree AS (
+    SELECT id, id::text AS path, 0 AS depth FROM comments WHERE parent_id IS NULL
+    UNION ALL
+    SELECT c.id, t.path || '/' || c.id, t.depth + 1
+    FROM comments c JOIN tree t ON c.parent_id = t.id
+)
+UPDATE comments c SET path = tree.path, depth = tree.depth
+FROM tree WHERE c.id = tree.id;
+
+ALTER TABLE comments ALTER COLUMN path SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_path ON comments(path);
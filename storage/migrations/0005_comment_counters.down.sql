@@ -0,0 +1,3 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS reply_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS top_level_comment_count;
+ALTER TABLE posts DROP COLUMN IF EXISTS comment_count;
@@ -0,0 +1,12 @@
+-- Денормализованные счётчики неудалённых комментариев. Их поддерживают
+-- CreateComment и DeleteComment; пересчитать заново - "server repair-counters".
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS comment_count INT NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS top_level_comment_count INT NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS reply_count INT NOT NULL DEFAULT 0;
+
+UPDATE posts p SET
+    comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL),
+    top_level_comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.parent_id IS NULL AND c.deleted_at IS NULL);
+
+UPDATE comments c SET
+    reply_count = (SELECT count(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL);
@@ -0,0 +1,3 @@
+-- Суммы голосов за комментарий для порядков TOP и CONTROVERSIAL.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS upvotes INT NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS downvotes INT NOT NULL DEFAULT 0;
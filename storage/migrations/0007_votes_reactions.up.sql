@@ -0,0 +1,36 @@
+-- Один голос пользователя за объект обеспечивает первичный ключ. Суммы
+-- голосов денормализованы в upvotes/downvotes и обновляются в той же транзакции.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS upvotes INT NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS downvotes INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS post_votes (
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    voter VARCHAR(100) NOT NULL,
+    value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, voter)
+);
+
+CREATE TABLE IF NOT EXISTS comment_votes (
+    comment_id VARCHAR(36) NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    voter VARCHAR(100) NOT NULL,
+    value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, voter)
+);
+
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_name VARCHAR(100) NOT NULL,
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, user_name, emoji)
+);
+
+CREATE TABLE IF NOT EXISTS comment_reactions (
+    comment_id VARCHAR(36) NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_name VARCHAR(100) NOT NULL,
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_name, emoji)
+);
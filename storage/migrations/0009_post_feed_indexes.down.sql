@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_comment_count;
+DROP INDEX IF EXISTS idx_posts_score;
+DROP INDEX IF EXISTS idx_posts_author_created_at;
+DROP INDEX IF EXISTS idx_posts_created_at;
@@ -0,0 +1,7 @@
+-- Индексы ленты постов: по одному на каждый порядок, с (created_at, id) в хвосте,
+-- чтобы курсорная пагинация шла по индексу. OLDEST читает idx_posts_created_at
+-- в обратном направлении. allow_comments почти не отсекает строк и без индекса.
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_author_created_at ON posts (author, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_score ON posts ((upvotes - downvotes) DESC, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_comment_count ON posts (comment_count DESC, created_at DESC, id DESC);
@@ -0,0 +1,15 @@
+-- Теги постов. Имена нормализует приложение (нижний регистр, без пробелов по краям),
+-- поэтому уникальность по name совпадает с уникальностью тега.
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id VARCHAR(36) NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, tag_id)
+);
+
+-- Для фильтра ленты по тегу и подсчёта постов с тегом
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags(tag_id);
@@ -0,0 +1,17 @@
+ALTER TABLE posts ADD COLUMN author VARCHAR(100);
+ALTER TABLE comments ADD COLUMN author VARCHAR(100);
+
+UPDATE posts p SET author = u.display_name FROM users u WHERE u.id = p.author_id;
+UPDATE comments c SET author = u.display_name FROM users u WHERE u.id = c.author_id;
+
+ALTER TABLE posts ALTER COLUMN author SET NOT NULL;
+ALTER TABLE comments ALTER COLUMN author SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_comments_author_id_created_at;
+DROP INDEX IF EXISTS idx_posts_author_id_created_at;
+ALTER TABLE posts DROP COLUMN author_id;
+ALTER TABLE comments DROP COLUMN author_id;
+
+CREATE INDEX IF NOT EXISTS idx_posts_author_created_at ON posts (author, created_at DESC, id DESC);
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,31 @@
+-- Пользователи. Прежние строковые авторы постов и комментариев становятся
+-- пользователями с тем же display_name: по одному на каждое различное имя.
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(36) PRIMARY KEY,
+    display_name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users (id, display_name)
+SELECT gen_random_uuid()::text, author FROM (
+    SELECT author FROM posts
+    UNION
+    SELECT author FROM comments
+) AS authors;
+
+ALTER TABLE posts ADD COLUMN author_id VARCHAR(36) REFERENCES users(id);
+ALTER TABLE comments ADD COLUMN author_id VARCHAR(36) REFERENCES users(id);
+
+UPDATE posts p SET author_id = u.id FROM users u WHERE u.display_name = p.author;
+UPDATE comments c SET author_id = u.id FROM users u WHERE u.display_name = c.author;
+
+ALTER TABLE posts ALTER COLUMN author_id SET NOT NULL;
+ALTER TABLE comments ALTER COLUMN author_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_posts_author_created_at;
+ALTER TABLE posts DROP COLUMN author;
+ALTER TABLE comments DROP COLUMN author;
+
+-- Для фильтра ленты по автору и списка комментариев пользователя
+CREATE INDEX IF NOT EXISTS idx_posts_author_id_created_at ON posts (author_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_comments_author_id_created_at ON comments (author_id, created_at DESC, id DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_status_created_at;
+DROP TABLE IF EXISTS comment_reports;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
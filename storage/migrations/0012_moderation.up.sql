@@ -0,0 +1,16 @@
+-- Состояние модерации комментария; допустимые переходы проверяет приложение.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'PUBLISHED';
+
+-- Жалобы: от каждого пользователя не больше одной на комментарий.
+CREATE TABLE IF NOT EXISTS comment_reports (
+    id BIGSERIAL PRIMARY KEY,
+    comment_id VARCHAR(36) NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    reporter_id VARCHAR(36) NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (comment_id, reporter_id)
+);
+
+-- Очередь модерации: почти все комментарии опубликованы, их в индекс не берём
+CREATE INDEX IF NOT EXISTS idx_comments_status_created_at ON comments (status, created_at, id)
+    WHERE status <> 'PUBLISHED';
@@ -0,0 +1,4 @@
+-- Премодерация при откате становится открытыми комментариями.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS allow_comments BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE posts SET allow_comments = moderation_mode <> 'CLOSED';
+ALTER TABLE posts DROP COLUMN IF EXISTS moderation_mode;
@@ -0,0 +1,5 @@
+-- Режим приёма комментариев заменяет флаг allow_comments: закрытые посты
+-- становятся CLOSED, остальные OPEN.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS moderation_mode VARCHAR(16) NOT NULL DEFAULT 'OPEN';
+UPDATE posts SET moderation_mode = 'CLOSED' WHERE NOT allow_comments;
+ALTER TABLE posts DROP COLUMN IF EXISTS allow_comments;
@@ -0,0 +1,9 @@
+-- Корзины токенов для ограничения частоты мутаций, общие для всех экземпляров
+-- сервера. updated_at пуст у только что созданной корзины.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
@@ -0,0 +1,7 @@
+-- Прежние счётчики учитывали все неудалённые комментарии.
+UPDATE posts p SET
+    comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL),
+    top_level_comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.parent_id IS NULL AND c.deleted_at IS NULL);
+
+UPDATE comments c SET
+    reply_count = (SELECT count(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL);
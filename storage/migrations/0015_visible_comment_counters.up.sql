@@ -0,0 +1,11 @@
+-- Счётчики комментариев учитывают только видимые читателям комментарии:
+-- ожидающие проверки, скрытые и отклонённые больше не считаются.
+UPDATE posts p SET
+    comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL
+        AND c.status NOT IN ('PENDING', 'HIDDEN', 'REJECTED')),
+    top_level_comment_count = (SELECT count(*) FROM comments c WHERE c.post_id = p.id AND c.parent_id IS NULL AND c.deleted_at IS NULL
+        AND c.status NOT IN ('PENDING', 'HIDDEN', 'REJECTED'));
+
+UPDATE comments c SET
+    reply_count = (SELECT count(*) FROM comments r WHERE r.parent_id = c.id AND r.deleted_at IS NULL
+        AND r.status NOT IN ('PENDING', 'HIDDEN', 'REJECTED'));
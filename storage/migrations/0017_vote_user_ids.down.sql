@@ -0,0 +1,15 @@
+ALTER TABLE comment_reactions DROP CONSTRAINT comment_reactions_user_id_fkey;
+ALTER TABLE comment_reactions ALTER COLUMN user_id TYPE VARCHAR(100);
+ALTER TABLE comment_reactions RENAME COLUMN user_id TO user_name;
+
+ALTER TABLE post_reactions DROP CONSTRAINT post_reactions_user_id_fkey;
+ALTER TABLE post_reactions ALTER COLUMN user_id TYPE VARCHAR(100);
+ALTER TABLE post_reactions RENAME COLUMN user_id TO user_name;
+
+ALTER TABLE comment_votes DROP CONSTRAINT comment_votes_voter_id_fkey;
+ALTER TABLE comment_votes ALTER COLUMN voter_id TYPE VARCHAR(100);
+ALTER TABLE comment_votes RENAME COLUMN voter_id TO voter;
+
+ALTER TABLE post_votes DROP CONSTRAINT post_votes_voter_id_fkey;
+ALTER TABLE post_votes ALTER COLUMN voter_id TYPE VARCHAR(100);
+ALTER TABLE post_votes RENAME COLUMN voter_id TO voter;
@@ -0,0 +1,78 @@
+-- Голоса и реакции принадлежат пользователям. Строки, записанные до токенов,
+-- хранят имя, более поздние - ID пользователя. Имя сопоставляется с
+-- пользователем, как автор в 0011: с самым ранним пользователем с таким
+-- display_name, а незнакомое имя заводит нового пользователя.
+CREATE TEMPORARY TABLE voter_names ON COMMIT DROP AS
+SELECT voter AS name FROM post_votes
+UNION SELECT voter FROM comment_votes
+UNION SELECT user_name FROM post_reactions
+UNION SELECT user_name FROM comment_reactions;
+
+INSERT INTO users (id, display_name)
+SELECT gen_random_uuid()::text, n.name FROM voter_names n
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = n.name OR u.display_name = n.name);
+
+CREATE TEMPORARY TABLE voter_ids ON COMMIT DROP AS
+SELECT n.name, COALESCE(by_id.id, by_name.id) AS user_id
+FROM voter_names n
+LEFT JOIN users by_id ON by_id.id = n.name
+LEFT JOIN LATERAL (
+    SELECT id FROM users WHERE display_name = n.name ORDER BY created_at, id LIMIT 1
+) by_name ON TRUE;
+
+-- Первичные ключи снимаются на время переноса: голосовавший и по имени, и по
+-- ID получает две строки, из которых остаётся более поздняя
+ALTER TABLE post_votes DROP CONSTRAINT post_votes_pkey;
+ALTER TABLE post_votes RENAME COLUMN voter TO voter_id;
+UPDATE post_votes v SET voter_id = m.user_id FROM voter_ids m WHERE m.name = v.voter_id;
+DELETE FROM post_votes v USING post_votes newer
+WHERE newer.post_id = v.post_id AND newer.voter_id = v.voter_id
+    AND (newer.created_at > v.created_at OR newer.created_at = v.created_at AND newer.ctid > v.ctid);
+ALTER TABLE post_votes ALTER COLUMN voter_id TYPE VARCHAR(36);
+ALTER TABLE post_votes ADD PRIMARY KEY (post_id, voter_id);
+ALTER TABLE post_votes ADD CONSTRAINT post_votes_voter_id_fkey FOREIGN KEY (voter_id) REFERENCES users(id);
+
+ALTER TABLE comment_votes DROP CONSTRAINT comment_votes_pkey;
+ALTER TABLE comment_votes RENAME COLUMN voter TO voter_id;
+UPDATE comment_votes v SET voter_id = m.user_id FROM voter_ids m WHERE m.name = v.voter_id;
+DELETE FROM comment_votes v USING comment_votes newer
+WHERE newer.comment_id = v.comment_id AND newer.voter_id = v.voter_id
+    AND (newer.created_at > v.created_at OR newer.created_at = v.created_at AND newer.ctid > v.ctid);
+ALTER TABLE comment_votes ALTER COLUMN voter_id TYPE VARCHAR(36);
+ALTER TABLE comment_votes ADD PRIMARY KEY (comment_id, voter_id);
+ALTER TABLE comment_votes ADD CONSTRAINT comment_votes_voter_id_fkey FOREIGN KEY (voter_id) REFERENCES users(id);
+
+ALTER TABLE post_reactions DROP CONSTRAINT post_reactions_pkey;
+ALTER TABLE post_reactions RENAME COLUMN user_name TO user_id;
+UPDATE post_reactions r SET user_id = m.user_id FROM voter_ids m WHERE m.name = r.user_id;
+DELETE FROM post_reactions r USING post_reactions dup
+WHERE dup.post_id = r.post_id AND dup.user_id = r.user_id AND dup.emoji = r.emoji AND dup.ctid > r.ctid;
+ALTER TABLE post_reactions ALTER COLUMN user_id TYPE VARCHAR(36);
+ALTER TABLE post_reactions ADD PRIMARY KEY (post_id, user_id, emoji);
+ALTER TABLE post_reactions ADD CONSTRAINT post_reactions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE comment_reactions DROP CONSTRAINT comment_reactions_pkey;
+ALTER TABLE comment_reactions RENAME COLUMN user_name TO user_id;
+UPDATE comment_reactions r SET user_id = m.user_id FROM voter_ids m WHERE m.name = r.user_id;
+DELETE FROM comment_reactions r USING comment_reactions dup
+WHERE dup.comment_id = r.comment_id AND dup.user_id = r.user_id AND dup.emoji = r.emoji AND dup.ctid > r.ctid;
+ALTER TABLE comment_reactions ALTER COLUMN user_id TYPE VARCHAR(36);
+ALTER TABLE comment_reactions ADD PRIMARY KEY (comment_id, user_id, emoji);
+ALTER TABLE comment_reactions ADD CONSTRAINT comment_reactions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+-- Удалённые повторы входили в суммы голосов
+UPDATE posts p SET upvotes = s.up, downvotes = s.down
+FROM (
+    SELECT p.id, count(v.value) FILTER (WHERE v.value = 1) AS up, count(v.value) FILTER (WHERE v.value = -1) AS down
+    FROM posts p LEFT JOIN post_votes v ON v.post_id = p.id
+    GROUP BY p.id
+) s
+WHERE p.id = s.id AND (p.upvotes <> s.up OR p.downvotes <> s.down);
+
+UPDATE comments c SET upvotes = s.up, downvotes = s.down
+FROM (
+    SELECT c.id, count(v.value) FILTER (WHERE v.value = 1) AS up, count(v.value) FILTER (WHERE v.value = -1) AS down
+    FROM comments c LEFT JOIN comment_votes v ON v.comment_id = c.id
+    GROUP BY c.id
+) s
+WHERE c.id = s.id AND (c.upvotes <> s.up OR c.downvotes <> s.down);
@@ -0,0 +1,3 @@
+ALTER TABLE comment_revisions DROP CONSTRAINT comment_revisions_editor_id_fkey;
+ALTER TABLE comment_revisions ALTER COLUMN editor_id TYPE VARCHAR(100);
+ALTER TABLE comment_revisions RENAME COLUMN editor_id TO editor;
@@ -0,0 +1,13 @@
+-- Автор правки - пользователь, как голосующий в 0017: имя, записанное до
+-- токенов, сопоставляется с самым ранним пользователем с таким display_name,
+-- а незнакомое имя заводит нового пользователя.
+INSERT INTO users (id, display_name)
+SELECT gen_random_uuid()::text, e.editor FROM (SELECT DISTINCT editor FROM comment_revisions) e
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = e.editor OR u.display_name = e.editor);
+
+ALTER TABLE comment_revisions RENAME COLUMN editor TO editor_id;
+UPDATE comment_revisions r
+SET editor_id = (SELECT u.id FROM users u WHERE u.display_name = r.editor_id ORDER BY u.created_at, u.id LIMIT 1)
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = r.editor_id);
+ALTER TABLE comment_revisions ALTER COLUMN editor_id TYPE VARCHAR(36);
+ALTER TABLE comment_revisions ADD CONSTRAINT comment_revisions_editor_id_fkey FOREIGN KEY (editor_id) REFERENCES users(id);
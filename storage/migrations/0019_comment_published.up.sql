@@ -0,0 +1,6 @@
+-- Был ли комментарий виден читателям: одобрение уже опубликованного
+-- комментария после правки не рассылается подписчикам повторно. Ожидающие
+-- проверки комментарии считаются неопубликованными - отличить новый от
+-- правленного по старым данным нельзя.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS published BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE comments SET published = status <> 'PENDING';
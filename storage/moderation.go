@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"post-comment-app/graph/model"
+	"slices"
+	"strings"
+)
+
+// moderationTransitions - из каких статусов модератор может перевести
+// комментарий в данный. Отклонение окончательно: из REJECTED переходов нет.
+// Ожидающий проверки комментарий можно только одобрить или отклонить.
+var moderationTransitions = map[model.CommentStatus][]model.CommentStatus{
+	model.CommentStatusApproved: {model.CommentStatusPending, model.CommentStatusReported, model.CommentStatusHidden},
+	model.CommentStatusHidden:   {model.CommentStatusPublished, model.CommentStatusReported, model.CommentStatusApproved},
+	model.CommentStatusRejected: {model.CommentStatusPublished, model.CommentStatusPending, model.CommentStatusReported, model.CommentStatusApproved, model.CommentStatusHidden},
+}
+
+// hiddenStatuses - комментарии в этих статусах не показываются читателям.
+var hiddenStatuses = []model.CommentStatus{model.CommentStatusPending, model.CommentStatusHidden, model.CommentStatusRejected}
+
+// hiddenStatusList - hiddenStatuses для подстановки в SQL: 'PENDING', 'HIDDEN', 'REJECTED'.
+var hiddenStatusList = func() string {
+	quoted := make([]string, len(hiddenStatuses))
+	for i, st := range hiddenStatuses {
+		quoted[i] = "'" + string(st) + "'"
+	}
+	return strings.Join(quoted, ", ")
+}()
+
+// IsHidden сообщает, что комментарий скрыт от читателей: решением модератора
+// или до проверки на посту с премодерацией.
+func IsHidden(c *model.Comment) bool {
+	return hiddenStatus(c.Status)
+}
+
+func hiddenStatus(st model.CommentStatus) bool {
+	return slices.Contains(hiddenStatuses, st)
+}
+
+// Visibility описывает, какие скрытые комментарии видит пользователь запроса.
+type Visibility struct {
+	// All - видны все комментарии, как модератору.
+	All bool
+	// AuthorID - автор видит свои комментарии, ожидающие проверки.
+	AuthorID string
+}
+
+// Visible сообщает, виден ли комментарий с такой видимостью.
+func (v Visibility) Visible(c *model.Comment) bool {
+	if v.All || !IsHidden(c) {
+		return true
+	}
+	return c.Status == model.CommentStatusPending && v.AuthorID != "" && c.AuthorID == v.AuthorID
+}
+
+// counterDelta - на сколько меняются счётчики комментариев при переходе из
+// статуса from в to: считаются только комментарии, видимые читателям.
+func counterDelta(from, to model.CommentStatus) int {
+	wasHidden, isHidden := hiddenStatus(from), hiddenStatus(to)
+	switch {
+	case wasHidden && !isHidden:
+		return 1
+	case !wasHidden && isHidden:
+		return -1
+	}
+	return 0
+}
+
+// commentStatusOnCreate возвращает статус нового комментария: PENDING
+// сохраняется, всё остальное заменяется на PUBLISHED.
+func commentStatusOnCreate(c *model.Comment) model.CommentStatus {
+	if c.Status == model.CommentStatusPending {
+		return c.Status
+	}
+	return model.CommentStatusPublished
+}
+
+// publishedOnCreate сообщает, виден ли читателям новый комментарий со статусом st.
+func publishedOnCreate(st model.CommentStatus) bool {
+	return !hiddenStatus(st)
+}
+
+// commentStatusOnEdit возвращает статус комментария после правки: PENDING в
+// правке отправляет видимый читателям комментарий на повторную проверку,
+// остальные статусы правка не меняет.
+func commentStatusOnEdit(current, requested model.CommentStatus) model.CommentStatus {
+	if requested == model.CommentStatusPending && !hiddenStatus(current) {
+		return requested
+	}
+	return current
+}
+
+// postModerationMode возвращает режим поста; пустой режим означает OPEN.
+func postModerationMode(p *model.Post) model.ModerationMode {
+	if p.ModerationMode == "" {
+		return model.ModerationModeOpen
+	}
+	return p.ModerationMode
+}
+
+// checkTransition проверяет, что модератор может сменить статус from на to.
+func checkTransition(from, to model.CommentStatus) error {
+	allowed, ok := moderationTransitions[to]
+	if !ok {
+		return fmt.Errorf("%s is not a moderation decision", to)
+	}
+	if !slices.Contains(allowed, from) {
+		return fmt.Errorf("cannot change comment status from %s to %s: %w", from, to, ErrConflict)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"post-comment-app/graph/model"
+	"slices"
+)
+
+// commentOrderSQL задаёт ORDER BY для каждого порядка. sortComments обязан
+// давать ту же последовательность, иначе бэкенды разойдутся.
+var commentOrderSQL = map[model.CommentOrder]string{
+	model.CommentOrderNewest:        `created_at DESC, id DESC`,
+	model.CommentOrderOldest:        `created_at, id`,
+	model.CommentOrderTop:           `upvotes - downvotes DESC, created_at, id`,
+	model.CommentOrderMostReplies:   `reply_count DESC, created_at, id`,
+	model.CommentOrderControversial: `LEAST(upvotes, downvotes) DESC, upvotes + downvotes DESC, created_at, id`,
+}
+
+// orderBy возвращает ORDER BY для порядка; пустой порядок означает OLDEST.
+func orderBy(order model.CommentOrder) (string, error) {
+	if order == "" {
+		order = model.CommentOrderOldest
+	}
+	clause, ok := commentOrderSQL[order]
+	if !ok {
+		return "", fmt.Errorf("unknown comment order %q", order)
+	}
+	return clause, nil
+}
+
+// sortComments упорядочивает копию списка так же, как commentOrderSQL.
+func sortComments(comments []*model.Comment, order model.CommentOrder, tally func(id string) voteTally) ([]*model.Comment, error) {
+	if _, err := orderBy(order); err != nil {
+		return nil, err
+	}
+	// Ключ ранжирования: больший идёт раньше, при равенстве - (created_at, id) по возрастанию
+	rank := func(c *model.Comment) [2]int {
+		t := tally(c.ID)
+		switch order {
+		case model.CommentOrderTop:
+			return [2]int{t.up - t.down}
+		case model.CommentOrderMostReplies:
+			return [2]int{int(c.ReplyCount)}
+		case model.CommentOrderControversial:
+			return [2]int{min(t.up, t.down), t.up + t.down}
+		}
+		return [2]int{}
+	}
+
+	sorted := slices.Clone(comments)
+	slices.SortStableFunc(sorted, func(a, b *model.Comment) int {
+		if order == model.CommentOrderNewest {
+			return compareKeys(commentKey(b), commentKey(a))
+		}
+		ra, rb := rank(a), rank(b)
+		for i := range ra {
+			if c := cmp.Compare(rb[i], ra[i]); c != 0 {
+				return c
+			}
+		}
+		return compareKeys(commentKey(a), commentKey(b))
+	})
+	return sorted, nil
+}
+
+// postOrder - ведущий ключ ленты постов перед (created_at, id) и направление.
+// column и value задают один и тот же ключ для PostgreSQL и in-memory хранилища.
+type postOrder struct {
+	column string
+	value  func(p *model.Post) int64
+	desc   bool
+}
+
+var postOrders = map[model.PostOrder]postOrder{
+	model.PostOrderNewest: {desc: true},
+	model.PostOrderOldest: {},
+	model.PostOrderTop: {
+		column: `upvotes - downvotes`,
+		value:  func(p *model.Post) int64 { return int64(p.Score) },
+		desc:   true,
+	},
+	model.PostOrderMostCommented: {
+		column: `comment_count`,
+		value:  func(p *model.Post) int64 { return int64(p.CommentCount) },
+		desc:   true,
+	},
+}
+
+// postOrderFor возвращает порядок ленты; пустой порядок означает NEWEST.
+// Курсор должен быть выдан для того же порядка: с Value, только если у
+// порядка есть ведущий ключ.
+func postOrderFor(order model.PostOrder, after *Cursor) (postOrder, error) {
+	if order == "" {
+		order = model.PostOrderNewest
+	}
+	o, ok := postOrders[order]
+	if !ok {
+		return postOrder{}, fmt.Errorf("unknown post order %q", order)
+	}
+	if after != nil && (after.Value != nil) != (o.value != nil) {
+		return postOrder{}, fmt.Errorf("cursor does not match post order %s: %w", order, ErrInvalidCursor)
+	}
+	return o, nil
+}
+
+// key - ключ сортировки поста в этом порядке.
+func (o postOrder) key(p *model.Post) Cursor {
+	c := postKey(p)
+	if o.value != nil {
+		v := o.value(p)
+		c.Value = &v
+	}
+	return c
+}
+
+// PostCursor возвращает курсор, указывающий на пост в ленте с порядком order.
+func PostCursor(order model.PostOrder, p *model.Post) Cursor {
+	if order == "" {
+		order = model.PostOrderNewest
+	}
+	return postOrders[order].key(p)
+}
+
+// matchesPostFilter проверяет пост с тегами tags на условия фильтра так же,
+// как WHERE в PostgresStorage.GetPosts; nil-фильтр пропускает всё.
+func matchesPostFilter(p *model.Post, tags []string, filter *model.PostFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.Tag != nil && !slices.Contains(tags, *filter.Tag) {
+		return false
+	}
+	if filter.AuthorID != nil && p.AuthorID != *filter.AuthorID {
+		return false
+	}
+	if filter.CreatedAfter != nil && compareKeys(Cursor{CreatedAt: p.CreatedAt}, Cursor{CreatedAt: *filter.CreatedAfter}) <= 0 {
+		return false
+	}
+	if filter.CreatedBefore != nil && compareKeys(Cursor{CreatedAt: p.CreatedAt}, Cursor{CreatedAt: *filter.CreatedBefore}) >= 0 {
+		return false
+	}
+	if filter.ModerationMode != nil && p.ModerationMode != *filter.ModerationMode {
+		return false
+	}
+	return filter.AllowComments == nil || (p.ModerationMode != model.ModerationModeClosed) == *filter.AllowComments
+}
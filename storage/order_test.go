@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"post-comment-app/graph/model"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommentOrders(t *testing.T) {
+	t.Run("InMemory", func(t *testing.T) {
+		testCommentOrders(t, newTestInMemoryStorage(t))
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		testCommentOrders(t, newTestPostgres(t))
+	})
+}
+
+func TestPostTimeFilter(t *testing.T) {
+	t.Run("InMemory", func(t *testing.T) {
+		testPostTimeFilter(t, newTestInMemoryStorage(t))
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		testPostTimeFilter(t, newTestPostgres(t))
+	})
+}
+
+// testPostTimeFilter проверяет, что границы фильтра и время создания поста
+// сравниваются как моменты с учётом смещения, а не как местное время.
+func testPostTimeFilter(t *testing.T, store Storage) {
+	ctx := context.Background()
+	moscow := time.FixedZone("MSK", 3*60*60)
+	// 12:00 по Москве - это 09:00 UTC
+	post := &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen,
+		CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, moscow).Format(time.RFC3339)}
+	require.NoError(t, store.CreatePost(ctx, post))
+
+	stored, err := store.GetPost(ctx, post.ID)
+	require.NoError(t, err)
+	createdAt, err := time.Parse(time.RFC3339Nano, stored.CreatedAt)
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)), stored.CreatedAt)
+
+	count := func(filter *model.PostFilter) int {
+		posts, _, err := store.GetPosts(ctx, filter, "", 10, nil)
+		require.NoError(t, err)
+		return len(posts)
+	}
+	at := func(s string) *string { return &s }
+	assert.Equal(t, 1, count(&model.PostFilter{CreatedAfter: at("2024-01-01T11:30:00+03:00")}))
+	assert.Equal(t, 0, count(&model.PostFilter{CreatedAfter: at("2024-01-01T12:30:00+03:00")}))
+	assert.Equal(t, 1, count(&model.PostFilter{CreatedBefore: at("2024-01-01T09:30:00Z")}))
+	assert.Equal(t, 0, count(&model.PostFilter{CreatedBefore: at("2024-01-01T08:30:00Z")}))
+	assert.Equal(t, 1, count(&model.PostFilter{CreatedAfter: at("2024-01-01T03:30:00-05:00"), CreatedBefore: at("2024-01-01T04:30:00-05:00")}))
+}
+
+// testCommentOrders проверяет, что хранилище выдаёт каждый порядок ровно так,
+// как описано в схеме.
+func testCommentOrders(t *testing.T, store Storage) {
+	ctx := context.Background()
+	post := &model.Post{ID: uuid.NewString(), Title: "Post", Content: "Content", AuthorID: "Author", ModerationMode: model.ModerationModeOpen, CreatedAt: time.Now().Format(time.RFC3339)}
+	require.NoError(t, store.CreatePost(ctx, post))
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(i int) string { return base.Add(time.Duration(i) * time.Second).Format(time.RFC3339) }
+	create := func(i int, parentID *string) *model.Comment {
+		c, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, ParentID: parentID, AuthorID: "User", Text: fmt.Sprintf("c%d", i), CreatedAt: at(i)})
+		require.NoError(t, err)
+		return c
+	}
+
+	var top []*model.Comment
+	for i := 0; i < 5; i++ {
+		top = append(top, create(i, nil))
+	}
+	votes := [][2]int{{5, 0}, {3, 3}, {2, 2}, {0, 1}, {0, 0}}
+	for j := 0; j < 6; j++ {
+		voter := &model.User{ID: fmt.Sprintf("voter%d", j), DisplayName: fmt.Sprintf("Voter %d", j), CreatedAt: at(0)}
+		require.NoError(t, store.CreateUser(ctx, voter))
+	}
+	for i, v := range votes {
+		for j := 0; j < v[0]+v[1]; j++ {
+			value := 1
+			if j >= v[0] {
+				value = -1
+			}
+			require.NoError(t, store.Vote(ctx, TargetComment, top[i].ID, fmt.Sprintf("voter%d", j), value))
+		}
+	}
+	create(10, &top[3].ID)
+	create(11, &top[3].ID)
+	create(12, &top[1].ID)
+
+	texts := func(comments []*model.Comment) []string {
+		res := make([]string, len(comments))
+		for i, c := range comments {
+			res[i] = c.Text
+		}
+		return res
+	}
+
+	expected := map[model.CommentOrder][]string{
+		model.CommentOrderOldest:        {"c0", "c1", "c2", "c3", "c4"},
+		model.CommentOrderNewest:        {"c4", "c3", "c2", "c1", "c0"},
+		model.CommentOrderTop:           {"c0", "c1", "c2", "c4", "c3"},
+		model.CommentOrderMostReplies:   {"c3", "c1", "c0", "c2", "c4"},
+		model.CommentOrderControversial: {"c1", "c2", "c0", "c3", "c4"},
+	}
+	for order, want := range expected {
+		t.Run(string(order), func(t *testing.T) {
+			comments, err := store.GetCommentsByPostID(ctx, post.ID, order, 10, 0, Visibility{})
+			require.NoError(t, err)
+			assert.Equal(t, want, texts(comments))
+
+			page, err := store.GetCommentsByPostID(ctx, post.ID, order, 2, 1, Visibility{})
+			require.NoError(t, err)
+			assert.Equal(t, want[1:3], texts(page))
+
+			// Пакетный вариант для загрузчиков должен совпадать с одиночным
+			byPost, err := store.GetCommentsByPostIDs(ctx, []string{post.ID}, order, 2, 1, Visibility{})
+			require.NoError(t, err)
+			assert.Equal(t, want[1:3], texts(byPost[post.ID]))
+		})
+	}
+
+	replies, err := store.GetRepliesByCommentID(ctx, top[3].ID, model.CommentOrderNewest, 10, 0, Visibility{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c11", "c10"}, texts(replies))
+	byParent, err := store.GetRepliesByCommentIDs(ctx, []string{top[3].ID}, model.CommentOrderNewest, 10, 0, Visibility{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c11", "c10"}, texts(byParent[top[3].ID]))
+
+	_, err = store.GetCommentsByPostID(ctx, post.ID, "RANDOM", 10, 0, Visibility{})
+	assert.EqualError(t, err, `unknown comment order "RANDOM"`)
+}
@@ -2,13 +2,51 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"post-comment-app/graph/model"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const (
+	postColumns    = `id, title, content, author_id, moderation_mode, created_at, updated_at, comment_count, top_level_comment_count, upvotes, downvotes`
+	commentColumns = `id, post_id, parent_id, author_id, text, created_at, edited_at, deleted_at, locked, status, depth, reply_count, upvotes, downvotes, published`
+)
+
+// visibleComment - условие на комментарии, которые видят читатели.
+var visibleComment = `status NOT IN (` + hiddenStatusList + `)`
+
+// visibleTo - условие видимости для Visibility, переданной в $4 (All) и $5 (AuthorID).
+var visibleTo = visibleToParams("$4", "$5")
+
+// pageVisibleTo - то же для keyset-запросов commentsPage, где Visibility идёт в $5 и $6.
+var pageVisibleTo = visibleToParams("$5", "$6")
+
+// visibleToParams - условие видимости для Visibility в параметрах all и authorID.
+func visibleToParams(all, authorID string) string {
+	return `(` + all + ` OR ` + visibleComment + ` OR (status = '` + string(model.CommentStatusPending) + `' AND author_id = ` + authorID + `))`
+}
+
+// Маркеры выделения для ts_headline. Управляющие символы не входят в слова
+// и не меняются при экранировании, поэтому после html.EscapeString их можно
+// заменить на <b> и </b>.
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+// headlineOptions - опции ts_headline с маркерами вместо <b> и </b>.
+const headlineOptions = `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `"`
+
+// headlineHTML превращает маркеры экранированного фрагмента в <b> и </b>.
+var headlineHTML = strings.NewReplacer(headlineStart, "<b>", headlineStop, "</b>")
+
 type PostgresStorage struct {
 	pool *pgxpool.Pool
 }
@@ -21,127 +59,1277 @@ func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
 	return &PostgresStorage{pool: pool}, nil
 }
 
+func (s *PostgresStorage) CreateUser(ctx context.Context, user *model.User) error {
+	if err := checkID(user.ID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO users (id, display_name, created_at) VALUES ($1, $2, $3)`
+	_, err := s.pool.Exec(ctx, query, user.ID, user.DisplayName, user.CreatedAt)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user with ID %s already exists: %w", user.ID, ErrConflict)
+	}
+	return err
+}
+
+func (s *PostgresStorage) GetUser(ctx context.Context, id string) (*model.User, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(s.pool.QueryRow(ctx, `SELECT id, display_name, created_at FROM users WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	return user, err
+}
+
+func (s *PostgresStorage) GetUsersByIDs(ctx context.Context, ids []string) (map[string]*model.User, error) {
+	rows, err := s.pool.Query(ctx, `SELECT id, display_name, created_at FROM users WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[string]*model.User, len(ids))
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users[user.ID] = user
+	}
+	return users, rows.Err()
+}
+
 func (s *PostgresStorage) CreatePost(ctx context.Context, post *model.Post) error {
-	query := `INSERT INTO posts (id, title, content, author, allow_comments, created_at)
+	if err := checkID(post.ID, post.AuthorID); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	post.ModerationMode = postModerationMode(post)
+	query := `INSERT INTO posts (id, title, content, author_id, moderation_mode, created_at)
 VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := s.pool.Exec(ctx, query, post.ID, post.Title, post.Content, post.Author, post.AllowComments, post.CreatedAt)
-	return err
+	_, err = tx.Exec(ctx, query, post.ID, post.Title, post.Content, post.AuthorID, post.ModerationMode, post.CreatedAt)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("post with ID %s already exists: %w", post.ID, ErrConflict)
+	}
+	if isForeignKeyViolation(err, "posts_author_id_fkey") {
+		return authorNotFound(post.AuthorID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := insertPostTags(ctx, tx, post.ID, post.Tags); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (s *PostgresStorage) GetPost(ctx context.Context, id string) (*model.Post, error) {
-	query := `SELECT id, title, content, author, allow_comments, created_at FROM posts WHERE id = $1`
-	post := &model.Post{}
-	err := s.pool.QueryRow(ctx, query, id).Scan(&post.ID, &post.Title, &post.Content, &post.Author, &post.AllowComments, &post.CreatedAt)
-	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("post not found")
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + postColumns + ` FROM posts WHERE id = $1`
+	post, err := scanPost(s.pool.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errPostNotFound
 	}
 	return post, err
 }
 
-func (s *PostgresStorage) GetPosts(ctx context.Context) ([]*model.Post, error) {
-	query := `SELECT id, title, content, author, allow_comments, created_at FROM posts ORDER BY created_at DESC`
-	rows, err := s.pool.Query(ctx, query)
+func (s *PostgresStorage) GetPosts(ctx context.Context, filter *model.PostFilter, order model.PostOrder, first int, after *Cursor) ([]*model.Post, bool, error) {
+	o, err := postOrderFor(order, after)
+	if err != nil {
+		return nil, false, err
+	}
+	if filter == nil {
+		filter = &model.PostFilter{}
+	}
+
+	op, dir := ">", ""
+	if o.desc {
+		op, dir = "<", " DESC"
+	}
+	afterAt, afterID := cursorArgs(after)
+	args := []any{filter.AuthorID, filter.CreatedAfter, filter.CreatedBefore, filter.AllowComments, filter.Tag, first + 1, afterAt, afterID, filter.ModerationMode}
+	key, bound := `(created_at, id)`, `($7::timestamptz, $8::varchar)`
+	orderClause := `created_at` + dir + `, id` + dir
+	if o.column != "" {
+		var afterValue *int64
+		if after != nil {
+			afterValue = after.Value
+		}
+		args = append(args, afterValue)
+		key, bound = `(`+o.column+`, created_at, id)`, `($10::bigint, $7::timestamptz, $8::varchar)`
+		orderClause = o.column + dir + `, ` + orderClause
+	}
+	query := `SELECT ` + postColumns + ` FROM posts
+WHERE ($1::varchar IS NULL OR author_id = $1)
+	AND ($2::timestamptz IS NULL OR created_at > $2::timestamptz)
+	AND ($3::timestamptz IS NULL OR created_at < $3::timestamptz)
+	AND ($4::boolean IS NULL OR (moderation_mode <> '` + string(model.ModerationModeClosed) + `') = $4)
+	AND ($9::varchar IS NULL OR moderation_mode = $9)
+	AND ($5::varchar IS NULL OR EXISTS (
+		SELECT 1 FROM post_tags pt JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.post_id = posts.id AND t.name = $5))
+	AND ($7::timestamptz IS NULL OR ` + key + ` ` + op + ` ` + bound + `)
+ORDER BY ` + orderClause + ` LIMIT $6`
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(posts) > first {
+		return posts[:first], true, nil
+	}
+	return posts, false, nil
+}
+
+func (s *PostgresStorage) UpdatePost(ctx context.Context, post *model.Post) error {
+	if err := checkID(post.ID); err != nil {
+		return err
+	}
+
+	post.ModerationMode = postModerationMode(post)
+	query := `UPDATE posts SET title = $2, content = $3, moderation_mode = $4, updated_at = $5 WHERE id = $1`
+	tag, err := s.pool.Exec(ctx, query, post.ID, post.Title, post.Content, post.ModerationMode, post.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errPostNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) DeletePost(ctx context.Context, id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	// Комментарии удаляет ON DELETE CASCADE
+	tag, err := s.pool.Exec(ctx, `DELETE FROM posts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errPostNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) SetPostTags(ctx context.Context, postID string, tags []string) error {
+	if err := checkID(postID); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем пост: параллельные замены тегов не смешаются
+	var one int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM posts WHERE id = $1 FOR UPDATE`, postID).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM post_tags WHERE post_id = $1`, postID); err != nil {
+		return err
+	}
+	if err := insertPostTags(ctx, tx, postID, tags); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// insertPostTags добавляет посту теги, заводя недостающие, в транзакции вызывающего.
+func insertPostTags(ctx context.Context, tx pgx.Tx, postID string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::varchar[]) ON CONFLICT (name) DO NOTHING`, tags)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO post_tags (post_id, tag_id) SELECT $1, id FROM tags WHERE name = ANY($2)`, postID, tags)
+	return err
+}
+
+func (s *PostgresStorage) GetTagsByPostIDs(ctx context.Context, postIDs []string) (map[string][]string, error) {
+	// Порядок имён побайтовый, как у in-memory хранилища
+	query := `SELECT pt.post_id, t.name FROM post_tags pt
+JOIN tags t ON t.id = pt.tag_id
+WHERE pt.post_id = ANY($1)
+ORDER BY pt.post_id, t.name COLLATE "C"`
+	rows, err := s.pool.Query(ctx, query, postIDs)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []*model.Post
+	byPost := make(map[string][]string, len(postIDs))
 	for rows.Next() {
-		post := &model.Post{}
-		if err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Author, &post.AllowComments, &post.CreatedAt); err != nil {
+		var postID, name string
+		if err := rows.Scan(&postID, &name); err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		byPost[postID] = append(byPost[postID], name)
 	}
-	return posts, nil
+	return byPost, rows.Err()
 }
 
-func (s *PostgresStorage) CreateComment(ctx context.Context, comment *model.Comment) (*model.Comment, error) {
-	query := `INSERT INTO comments (post_id, parent_id, author, text, created_at)
-VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	var id int64
-	var parentID *int64
-	if comment.ParentID != nil {
-		var pid int64
-		if _, err := fmt.Sscanf(*comment.ParentID, "%d", &pid); err != nil {
-			return nil, fmt.Errorf("invalid parent_id format")
+func (s *PostgresStorage) GetTags(ctx context.Context, limit int) ([]*model.Tag, error) {
+	query := `SELECT t.name, count(*) FROM tags t
+JOIN post_tags pt ON pt.tag_id = t.id
+GROUP BY t.name
+ORDER BY count(*) DESC, t.name COLLATE "C"
+LIMIT $1`
+	rows, err := s.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*model.Tag{}
+	for rows.Next() {
+		tag := &model.Tag{}
+		if err := rows.Scan(&tag.Name, &tag.PostCount); err != nil {
+			return nil, err
 		}
-		parentID = &pid
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *PostgresStorage) CreateComment(ctx context.Context, comment *model.Comment) (*model.Comment, error) {
+	if err := checkCommentIDs(comment); err != nil {
+		return nil, err
 	}
-	err := s.pool.QueryRow(ctx, query, comment.PostID, parentID, comment.Author, comment.Text, comment.CreatedAt).Scan(&id)
+
+	// Путь и глубина считаются от родителя в том же запросе. Родитель ищется
+	// только среди комментариев того же поста: если его нет, строка не
+	// вставляется, и путь не может пересечь границу поста.
+	query := `INSERT INTO comments (id, post_id, parent_id, author_id, text, created_at, status, published, path, depth)
+SELECT $1::varchar, $2::varchar, $3::varchar, $4, $5, $6::timestamptz, $7, $8,
+	COALESCE(p.path || '/', '') || $1::varchar, COALESCE(p.depth + 1, 0)
+FROM (SELECT 1) one LEFT JOIN comments p ON p.id = $3::varchar AND p.post_id = $2::varchar
+WHERE $3::varchar IS NULL OR p.id IS NOT NULL
+RETURNING depth`
+	if comment.ID == "" {
+		comment.ID = NewID()
+	}
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	comment.ID = fmt.Sprintf("%d", id)
+	defer tx.Rollback(ctx)
+
+	comment.Status = commentStatusOnCreate(comment)
+	comment.Published = publishedOnCreate(comment.Status)
+	err = tx.QueryRow(ctx, query, comment.ID, comment.PostID, comment.ParentID, comment.AuthorID, comment.Text, comment.CreatedAt, comment.Status, comment.Published).Scan(&comment.Depth)
+	if err != nil {
+		return nil, commentInsertError(comment, err)
+	}
+	if !IsHidden(comment) {
+		if err := adjustCommentCounters(ctx, tx, comment.PostID, comment.ParentID, 1); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 	return comment, nil
 }
 
 func (s *PostgresStorage) GetComment(ctx context.Context, id string) (*model.Comment, error) {
-	query := `SELECT id, post_id, parent_id, author, text, created_at FROM comments WHERE id = $1`
-	comment := &model.Comment{}
-	var parentID *int64
-	err := s.pool.QueryRow(ctx, query, id).Scan(&comment.ID, &comment.PostID, &parentID, &comment.Author, &comment.Text, &comment.CreatedAt)
-	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("comment not found")
+	if err := checkID(id); err != nil {
+		return nil, err
 	}
-	if parentID != nil {
-		parentIDStr := fmt.Sprintf("%d", *parentID)
-		comment.ParentID = &parentIDStr
+
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE id = $1`
+	comment, err := scanComment(s.pool.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errCommentNotFound
 	}
 	return comment, err
 }
 
-func (s *PostgresStorage) GetCommentsByPostID(ctx context.Context, postID string, limit, offset int) ([]*model.Comment, error) {
-	query := `SELECT id, post_id, parent_id, author, text, created_at FROM comments
-WHERE post_id = $1 AND parent_id IS NULL
-ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	rows, err := s.pool.Query(ctx, query, postID, limit, offset)
+func (s *PostgresStorage) UpdateComment(ctx context.Context, comment *model.Comment, editorID string) error {
+	if err := checkID(comment.ID); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем строку, чтобы параллельные правки не потеряли промежуточную версию
+	var (
+		prevText string
+		current  model.CommentStatus
+		postID   string
+		parentID *string
+	)
+	err = tx.QueryRow(ctx, `SELECT text, status, post_id, parent_id FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`,
+		comment.ID).Scan(&prevText, &current, &postID, &parentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errCommentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO comment_revisions (comment_id, text, editor_id, edited_at) VALUES ($1, $2, $3, $4)`,
+		comment.ID, prevText, editorID, comment.EditedAt)
+	if isForeignKeyViolation(err, "comment_revisions_editor_id_fkey") {
+		return errUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	status := commentStatusOnEdit(current, comment.Status)
+	_, err = tx.Exec(ctx, `UPDATE comments SET text = $2, edited_at = $3, status = $4 WHERE id = $1`,
+		comment.ID, comment.Text, comment.EditedAt, status)
+	if err != nil {
+		return err
+	}
+	if delta := counterDelta(current, status); delta != 0 {
+		if err := adjustCommentCounters(ctx, tx, postID, parentID, delta); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *PostgresStorage) GetCommentRevisions(ctx context.Context, commentID string) ([]*model.CommentRevision, error) {
+	query := `SELECT text, editor_id, edited_at FROM comment_revisions WHERE comment_id = $1 ORDER BY edited_at, id`
+	rows, err := s.pool.Query(ctx, query, commentID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []*model.Comment
+	revisions := []*model.CommentRevision{}
 	for rows.Next() {
-		comment := &model.Comment{}
-		var parentID *int64
-		if err := rows.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Author, &comment.Text, &comment.CreatedAt); err != nil {
+		rev := &model.CommentRevision{}
+		var editedAt time.Time
+		if err := rows.Scan(&rev.Text, &rev.EditorID, &editedAt); err != nil {
 			return nil, err
 		}
-		if parentID != nil {
-			parentIDStr := fmt.Sprintf("%d", *parentID)
-			comment.ParentID = &parentIDStr
+		rev.EditedAt = formatTimestamp(editedAt)
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *PostgresStorage) CountCommentRevisions(ctx context.Context, commentIDs []string) (map[string]int, error) {
+	query := `SELECT comment_id, count(*) FROM comment_revisions WHERE comment_id = ANY($1) GROUP BY comment_id`
+	rows, err := s.pool.Query(ctx, query, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(commentIDs))
+	for rows.Next() {
+		var commentID string
+		var n int
+		if err := rows.Scan(&commentID, &n); err != nil {
+			return nil, err
 		}
-		comments = append(comments, comment)
+		counts[commentID] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *PostgresStorage) DeleteComment(ctx context.Context, id string, deletedAt string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE comments SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING post_id, parent_id, status`
+	var postID string
+	var parentID *string
+	var status model.CommentStatus
+	err = tx.QueryRow(ctx, query, id, deletedAt).Scan(&postID, &parentID, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errCommentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !hiddenStatus(status) {
+		if err := adjustCommentCounters(ctx, tx, postID, parentID, -1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// adjustCommentCounters сдвигает счётчики поста и родителя на delta в той же
+// транзакции, что и изменение самого комментария.
+func adjustCommentCounters(ctx context.Context, tx pgx.Tx, postID string, parentID *string, delta int) error {
+	topLevel := 0
+	if parentID == nil {
+		topLevel = delta
+	}
+	_, err := tx.Exec(ctx, `UPDATE posts SET comment_count = comment_count + $2,
+	top_level_comment_count = top_level_comment_count + $3 WHERE id = $1`, postID, delta, topLevel)
+	if err != nil || parentID == nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE comments SET reply_count = reply_count + $2 WHERE id = $1`, *parentID, delta)
+	return err
+}
+
+// RepairCounters пересчитывает счётчики комментариев с нуля и возвращает
+// число исправленных постов и комментариев. Таблицы блокируются от записи
+// на время пересчёта, чтобы параллельные изменения не разошлись с результатом.
+func (s *PostgresStorage) RepairCounters(ctx context.Context) (posts, comments int64, err error) {
+	err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `LOCK TABLE posts, comments IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `UPDATE posts p SET comment_count = s.total, top_level_comment_count = s.top_level
+FROM (
+	SELECT p.id, count(c.id) AS total, count(c.id) FILTER (WHERE c.parent_id IS NULL) AS top_level
+	FROM posts p LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL AND c.`+visibleComment+`
+	GROUP BY p.id
+) s
+WHERE p.id = s.id AND (p.comment_count <> s.total OR p.top_level_comment_count <> s.top_level)`)
+		if err != nil {
+			return err
+		}
+		posts = tag.RowsAffected()
+
+		tag, err = tx.Exec(ctx, `UPDATE comments c SET reply_count = s.replies
+FROM (
+	SELECT c.id, count(r.id) AS replies
+	FROM comments c LEFT JOIN comments r ON r.parent_id = c.id AND r.deleted_at IS NULL AND r.`+visibleComment+`
+	GROUP BY c.id
+) s
+WHERE c.id = s.id AND c.reply_count <> s.replies`)
+		if err != nil {
+			return err
+		}
+		comments = tag.RowsAffected()
+		return nil
+	})
+	return posts, comments, err
+}
+
+func (s *PostgresStorage) SetThreadLocked(ctx context.Context, commentID string, locked bool) error {
+	if err := checkID(commentID); err != nil {
+		return err
+	}
+
+	tag, err := s.pool.Exec(ctx, `UPDATE comments SET locked = $2 WHERE id = $1`, commentID, locked)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errCommentNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) IsThreadLocked(ctx context.Context, commentID string) (bool, error) {
+	query := `SELECT COALESCE(bool_or(locked), FALSE) FROM comments
+WHERE id = ANY(string_to_array((SELECT path FROM comments WHERE id = $1), '/'))`
+	var locked bool
+	err := s.pool.QueryRow(ctx, query, commentID).Scan(&locked)
+	return locked, err
+}
+
+func (s *PostgresStorage) GetCommentAncestors(ctx context.Context, commentID string, visibility Visibility) ([]*model.Comment, error) {
+	byComment, err := s.GetCommentAncestorsByIDs(ctx, []string{commentID}, visibility)
+	if err != nil {
+		return nil, err
+	}
+	if ancestors := byComment[commentID]; ancestors != nil {
+		return ancestors, nil
 	}
-	return comments, nil
+	return []*model.Comment{}, nil
 }
 
-func (s *PostgresStorage) GetRepliesByCommentID(ctx context.Context, commentID string, limit, offset int) ([]*model.Comment, error) {
-	query := `SELECT id, post_id, parent_id, author, text, created_at FROM comments
-WHERE parent_id = $1
-ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	rows, err := s.pool.Query(ctx, query, commentID, limit, offset)
+// GetCommentAncestorsByIDs берёт предков каждого комментария из его path;
+// ID комментария, для которого найден предок, идёт последним столбцом.
+func (s *PostgresStorage) GetCommentAncestorsByIDs(ctx context.Context, commentIDs []string, visibility Visibility) (map[string][]*model.Comment, error) {
+	query := `SELECT a.*, x.id FROM comments x
+CROSS JOIN LATERAL (
+	SELECT ` + commentColumns + ` FROM comments
+	WHERE id = ANY(string_to_array(x.path, '/')) AND id <> x.id
+		AND ` + visibleToParams("$2", "$3") + `
+) a
+WHERE x.id = ANY($1)
+ORDER BY x.id, a.depth`
+	rows, err := s.pool.Query(ctx, query, commentIDs, visibility.All, visibility.AuthorID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []*model.Comment
+	byComment := make(map[string][]*model.Comment, len(commentIDs))
+	for rows.Next() {
+		var id string
+		ancestor, err := scanComment(rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		byComment[id] = append(byComment[id], ancestor)
+	}
+	return byComment, rows.Err()
+}
+
+func (s *PostgresStorage) CountDescendants(ctx context.Context, commentID string, visibility Visibility) (int, error) {
+	counts, err := s.CountDescendantsByIDs(ctx, []string{commentID}, visibility)
+	return counts[commentID], err
+}
+
+// CountDescendantsByIDs ищет потомков диапазоном по path: '0' идёт сразу за '/'
+// в порядке сортировки "C", поэтому подсчёт читает только индекс idx_comments_path.
+func (s *PostgresStorage) CountDescendantsByIDs(ctx context.Context, commentIDs []string, visibility Visibility) (map[string]int, error) {
+	query := `SELECT p.id, (
+	SELECT count(*) FROM comments
+	WHERE path > p.path || '/' AND path < p.path || '0' AND ` + visibleToParams("$2", "$3") + `
+) FROM comments p
+WHERE p.id = ANY($1)`
+	rows, err := s.pool.Query(ctx, query, commentIDs, visibility.All, visibility.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(commentIDs))
 	for rows.Next() {
-		comment := &model.Comment{}
-		var parentID *int64
-		if err := rows.Scan(&comment.ID, &comment.PostID, &parentID, &comment.Author, &comment.Text, &comment.CreatedAt); err != nil {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
 			return nil, err
 		}
-		if parentID != nil {
-			parentIDStr := fmt.Sprintf("%d", *parentID)
-			comment.ParentID = &parentIDStr
+		if n > 0 {
+			counts[id] = n
+		}
+	}
+	return counts, rows.Err()
+}
+
+// engagementTables - таблица объекта, таблицы его голосов и реакций и
+// столбец в них, ссылающийся на объект.
+type engagementTables struct {
+	target, votes, reactions, key string
+}
+
+func tablesFor(kind TargetKind) engagementTables {
+	if kind == TargetComment {
+		return engagementTables{"comments", "comment_votes", "comment_reactions", "comment_id"}
+	}
+	return engagementTables{"posts", "post_votes", "post_reactions", "post_id"}
+}
+
+func (s *PostgresStorage) Vote(ctx context.Context, kind TargetKind, targetID, voterID string, value int) error {
+	if err := checkID(targetID); err != nil {
+		return err
+	}
+
+	t := tablesFor(kind)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем объект: параллельные голоса за него не разойдутся с суммами
+	var one int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM `+t.target+` WHERE id = $1 FOR UPDATE`, targetID).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return targetNotFound(kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	var prev int
+	err = tx.QueryRow(ctx, `SELECT value FROM `+t.votes+` WHERE `+t.key+` = $1 AND voter_id = $2`, targetID, voterID).Scan(&prev)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if value == 0 {
+		_, err = tx.Exec(ctx, `DELETE FROM `+t.votes+` WHERE `+t.key+` = $1 AND voter_id = $2`, targetID, voterID)
+	} else {
+		_, err = tx.Exec(ctx, `INSERT INTO `+t.votes+` (`+t.key+`, voter_id, value) VALUES ($1, $2, $3)
+ON CONFLICT (`+t.key+`, voter_id) DO UPDATE SET value = EXCLUDED.value, created_at = CURRENT_TIMESTAMP`, targetID, voterID, value)
+	}
+	if isForeignKeyViolation(err, t.votes+"_voter_id_fkey") {
+		return errUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	d := voteTally{}.replace(prev, value)
+	_, err = tx.Exec(ctx, `UPDATE `+t.target+` SET upvotes = upvotes + $2, downvotes = downvotes + $3 WHERE id = $1`, targetID, d.up, d.down)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *PostgresStorage) ToggleReaction(ctx context.Context, kind TargetKind, targetID, userID, emoji string) (bool, error) {
+	if err := checkID(targetID); err != nil {
+		return false, err
+	}
+
+	t := tablesFor(kind)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокируем объект, как в Vote: параллельные переключения одной реакции
+	// выполняются по очереди и не сообщают об установке дважды
+	var one int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM `+t.target+` WHERE id = $1 FOR UPDATE`, targetID).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, targetNotFound(kind)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM `+t.reactions+` WHERE `+t.key+` = $1 AND user_id = $2 AND emoji = $3`, targetID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	set := tag.RowsAffected() == 0
+	if set {
+		_, err = tx.Exec(ctx, `INSERT INTO `+t.reactions+` (`+t.key+`, user_id, emoji) VALUES ($1, $2, $3)`, targetID, userID, emoji)
+		if isForeignKeyViolation(err, t.reactions+"_user_id_fkey") {
+			return false, errUserNotFound
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return set, tx.Commit(ctx)
+}
+
+func (s *PostgresStorage) GetReactions(ctx context.Context, kind TargetKind, targetID, viewer string) ([]*model.Reaction, error) {
+	byTarget, err := s.GetReactionsByTargetIDs(ctx, kind, []string{targetID}, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if reactions := byTarget[targetID]; reactions != nil {
+		return reactions, nil
+	}
+	return []*model.Reaction{}, nil
+}
+
+func (s *PostgresStorage) GetReactionsByTargetIDs(ctx context.Context, kind TargetKind, targetIDs []string, viewer string) (map[string][]*model.Reaction, error) {
+	t := tablesFor(kind)
+	// Порядок emoji побайтовый, как в sortReactions у in-memory хранилища
+	query := `SELECT ` + t.key + `, emoji, count(*), bool_or(user_id = $2) FROM ` + t.reactions + `
+WHERE ` + t.key + ` = ANY($1)
+GROUP BY ` + t.key + `, emoji
+ORDER BY ` + t.key + `, count(*) DESC, emoji COLLATE "C"`
+	rows, err := s.pool.Query(ctx, query, targetIDs, viewer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byTarget := make(map[string][]*model.Reaction, len(targetIDs))
+	for rows.Next() {
+		var id string
+		r := &model.Reaction{}
+		if err := rows.Scan(&id, &r.Emoji, &r.Count, &r.ViewerReacted); err != nil {
+			return nil, err
+		}
+		byTarget[id] = append(byTarget[id], r)
+	}
+	return byTarget, rows.Err()
+}
+
+func (s *PostgresStorage) Search(ctx context.Context, query string, types []model.SearchType, first, offset int) ([]*SearchHit, bool, error) {
+	wantPosts, wantComments := searchTypes(types)
+	// ts_headline считается только для страницы, а не для всех совпадений.
+	// Фрагмент строится по исходному тексту и экранируется уже в Go: иначе
+	// части сущностей вроде &lt; сами становились бы искомыми словами
+	sql := `WITH q AS (SELECT plainto_tsquery('simple', $1) AS query),
+hits AS (
+	SELECT 'post' AS kind, p.id, ts_rank(p.search_vector, q.query)::float8 AS rank, p.created_at, p.title || ' ' || p.content AS doc
+	FROM posts p, q
+	WHERE $2 AND p.search_vector @@ q.query
+	UNION ALL
+	SELECT 'comment', c.id, ts_rank(c.search_vector, q.query)::float8, c.created_at, c.text
+	FROM comments c, q
+	WHERE $3 AND c.deleted_at IS NULL AND c.` + visibleComment + ` AND c.search_vector @@ q.query
+)
+SELECT h.kind, h.id, h.rank, ts_headline('simple', h.doc, q.query, $6)
+FROM (SELECT * FROM hits ORDER BY rank DESC, created_at DESC, id DESC LIMIT $4 OFFSET $5) h, q
+ORDER BY h.rank DESC, h.created_at DESC, h.id DESC`
+	rows, err := s.pool.Query(ctx, sql, query, wantPosts, wantComments, first+1, offset, headlineOptions)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var hits []*SearchHit
+	var postIDs, commentIDs []string
+	for rows.Next() {
+		var kind, id string
+		hit := &SearchHit{}
+		if err := rows.Scan(&kind, &id, &hit.Rank, &hit.Snippet); err != nil {
+			return nil, false, err
+		}
+		hit.Snippet = headlineHTML.Replace(html.EscapeString(hit.Snippet))
+		if kind == "post" {
+			postIDs = append(postIDs, id)
+			hit.Post = &model.Post{ID: id}
+		} else {
+			commentIDs = append(commentIDs, id)
+			hit.Comment = &model.Comment{ID: id}
+		}
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	hasNext := len(hits) > first
+	if hasNext {
+		hits = hits[:first]
+	}
+
+	posts, err := s.postsByIDs(ctx, postIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	comments, err := s.commentsByIDs(ctx, commentIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	// Объект мог быть удалён между запросами - такое совпадение пропускаем
+	found := hits[:0]
+	for _, h := range hits {
+		if h.Post != nil {
+			h.Post = posts[h.Post.ID]
+		} else {
+			h.Comment = comments[h.Comment.ID]
+		}
+		if h.Post != nil || h.Comment != nil {
+			found = append(found, h)
+		}
+	}
+	return found, hasNext, nil
+}
+
+func (s *PostgresStorage) postsByIDs(ctx context.Context, ids []string) (map[string]*model.Post, error) {
+	byID := make(map[string]*model.Post, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+	rows, err := s.pool.Query(ctx, `SELECT `+postColumns+` FROM posts WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	posts, err := scanPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+	return byID, nil
+}
+
+func (s *PostgresStorage) commentsByIDs(ctx context.Context, ids []string) (map[string]*model.Comment, error) {
+	byID := make(map[string]*model.Comment, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+	rows, err := s.pool.Query(ctx, `SELECT `+commentColumns+` FROM comments WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		byID[c.ID] = c
+	}
+	return byID, nil
+}
+
+func (s *PostgresStorage) ReportComment(ctx context.Context, commentID string, report *model.CommentReport) (*model.Comment, error) {
+	if err := checkID(commentID, report.ReporterID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокировка строки упорядочивает жалобу с параллельными решениями модератора
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT true FROM comments WHERE id = $1 AND deleted_at IS NULL AND `+visibleComment+` FOR UPDATE`, commentID).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO comment_reports (comment_id, reporter_id, reason, created_at) VALUES ($1, $2, $3, $4)`,
+		commentID, report.ReporterID, report.Reason, report.CreatedAt)
+	switch {
+	case isUniqueViolation(err):
+		return nil, fmt.Errorf("comment already reported by user %s: %w", report.ReporterID, ErrConflict)
+	case isForeignKeyViolation(err, "comment_reports_reporter_id_fkey"):
+		return nil, errUserNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	query := `UPDATE comments SET status = CASE WHEN status = $2 THEN $3 ELSE status END
+WHERE id = $1 RETURNING ` + commentColumns
+	comment, err := scanComment(tx.QueryRow(ctx, query, commentID, model.CommentStatusPublished, model.CommentStatusReported))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *PostgresStorage) GetCommentReports(ctx context.Context, commentID string) ([]*model.CommentReport, error) {
+	query := `SELECT reporter_id, reason, created_at FROM comment_reports WHERE comment_id = $1 ORDER BY created_at, id`
+	rows, err := s.pool.Query(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*model.CommentReport{}
+	for rows.Next() {
+		report := &model.CommentReport{}
+		var createdAt time.Time
+		if err := rows.Scan(&report.ReporterID, &report.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		report.CreatedAt = formatTimestamp(createdAt)
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (s *PostgresStorage) SetCommentStatus(ctx context.Context, commentID string, status model.CommentStatus) (*model.Comment, error) {
+	if err := checkID(commentID); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current model.CommentStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, commentID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransition(current, status); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE comments SET status = $2, published = published OR $2 NOT IN (` + hiddenStatusList + `)
+WHERE id = $1 RETURNING ` + commentColumns
+	comment, err := scanComment(tx.QueryRow(ctx, query, commentID, status))
+	if err != nil {
+		return nil, err
+	}
+	if delta := counterDelta(current, status); delta != 0 {
+		if err := adjustCommentCounters(ctx, tx, comment.PostID, comment.ParentID, delta); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *PostgresStorage) GetModerationQueue(ctx context.Context, status model.CommentStatus, first int, after *Cursor) ([]*model.Comment, bool, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments
+WHERE status = $1 AND deleted_at IS NULL
+	AND ($2::timestamptz IS NULL OR (created_at, id) > ($2::timestamptz, $3::varchar))
+ORDER BY created_at, id LIMIT $4`
+	return s.commentsPage(ctx, query, string(status), first, after)
+}
+
+func (s *PostgresStorage) GetCommentsByPostID(ctx context.Context, postID string, order model.CommentOrder, limit, offset int, visibility Visibility) ([]*model.Comment, error) {
+	clause, err := orderBy(order)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + commentColumns + ` FROM comments
+WHERE post_id = $1 AND parent_id IS NULL AND ` + visibleTo + `
+ORDER BY ` + clause + ` LIMIT $2 OFFSET $3`
+	rows, err := s.pool.Query(ctx, query, postID, limit, offset, visibility.All, visibility.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanComments(rows)
+}
+
+func (s *PostgresStorage) GetRepliesByCommentID(ctx context.Context, commentID string, order model.CommentOrder, limit, offset int, visibility Visibility) ([]*model.Comment, error) {
+	clause, err := orderBy(order)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + commentColumns + ` FROM comments
+WHERE parent_id = $1 AND ` + visibleTo + `
+ORDER BY ` + clause + ` LIMIT $2 OFFSET $3`
+	rows, err := s.pool.Query(ctx, query, commentID, limit, offset, visibility.All, visibility.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanComments(rows)
+}
+
+func (s *PostgresStorage) GetCommentsPageByAuthorID(ctx context.Context, authorID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments
+WHERE author_id = $1 AND deleted_at IS NULL AND ` + pageVisibleTo + `
+	AND ($2::timestamptz IS NULL OR (created_at, id) < ($2::timestamptz, $3::varchar))
+ORDER BY created_at DESC, id DESC LIMIT $4`
+	return s.commentsPage(ctx, query, authorID, first, after, visibility.All, visibility.AuthorID)
+}
+
+func (s *PostgresStorage) GetCommentsPageByPostID(ctx context.Context, postID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments
+WHERE post_id = $1 AND parent_id IS NULL AND ` + pageVisibleTo + `
+	AND ($2::timestamptz IS NULL OR (created_at, id) > ($2::timestamptz, $3::varchar))
+ORDER BY created_at, id LIMIT $4`
+	return s.commentsPage(ctx, query, postID, first, after, visibility.All, visibility.AuthorID)
+}
+
+func (s *PostgresStorage) GetRepliesPageByCommentID(ctx context.Context, commentID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error) {
+	query := `SELECT ` + commentColumns + ` FROM comments
+WHERE parent_id = $1 AND ` + pageVisibleTo + `
+	AND ($2::timestamptz IS NULL OR (created_at, id) > ($2::timestamptz, $3::varchar))
+ORDER BY created_at, id LIMIT $4`
+	return s.commentsPage(ctx, query, commentID, first, after, visibility.All, visibility.AuthorID)
+}
+
+// commentsPage выполняет keyset-запрос с параметрами (родитель, created_at, id, limit)
+// и дополнительными extra начиная с $5, запрашивая на одну строку больше,
+// чтобы узнать о следующей странице.
+func (s *PostgresStorage) commentsPage(ctx context.Context, query, parent string, first int, after *Cursor, extra ...any) ([]*model.Comment, bool, error) {
+	afterAt, afterID := cursorArgs(after)
+	args := append([]any{parent, afterAt, afterID, first + 1}, extra...)
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(comments) > first {
+		return comments[:first], true, nil
+	}
+	return comments, false, nil
+}
+
+func (s *PostgresStorage) GetCommentTree(ctx context.Context, postID string, maxDepth, limitPerLevel int, visibility Visibility) ([]*model.CommentTreeNode, error) {
+	anchor := `SELECT ` + commentColumns + ` FROM comments
+		WHERE post_id = $1 AND parent_id IS NULL AND ` + visibleTo + `
+		ORDER BY created_at, id LIMIT $3`
+	return s.commentTree(ctx, anchor, postID, maxDepth, limitPerLevel, visibility)
+}
+
+func (s *PostgresStorage) GetCommentSubtree(ctx context.Context, commentID string, maxDepth, limitPerLevel int, visibility Visibility) (*model.CommentTreeNode, error) {
+	if err := checkID(commentID); err != nil {
+		return nil, err
+	}
+
+	anchor := `SELECT ` + commentColumns + ` FROM comments WHERE id = $1 AND ` + visibleTo
+	roots, err := s.commentTree(ctx, anchor, commentID, maxDepth, limitPerLevel, visibility)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errCommentNotFound
+	}
+	return roots[0], nil
+}
+
+// commentTree загружает дерево одним рекурсивным запросом. anchor выбирает
+// узлы глубины 0; на каждом следующем уровне LATERAL берёт не больше $3
+// ответов на родителя, пока глубина не достигнет $2. Видимость - в $4 и $5.
+func (s *PostgresStorage) commentTree(ctx context.Context, anchor, rootID string, maxDepth, limitPerLevel int, visibility Visibility) ([]*model.CommentTreeNode, error) {
+	query := `WITH RECURSIVE tree AS (
+	SELECT top.*, 0 AS level FROM (
+		` + anchor + `
+	) top
+	UNION ALL
+	SELECT r.*, t.level + 1 FROM tree t
+	CROSS JOIN LATERAL (
+		SELECT ` + commentColumns + ` FROM comments
+		WHERE parent_id = t.id AND ` + visibleTo + `
+		ORDER BY created_at, id LIMIT $3
+	) r
+	WHERE t.level < $2
+)
+SELECT ` + commentColumns + `, level,
+	(SELECT count(*) FROM comments x WHERE x.parent_id = tree.id AND ` + visibleTo + `) AS reply_count
+FROM tree
+ORDER BY level, created_at, id`
+	rows, err := s.pool.Query(ctx, query, rootID, maxDepth, limitPerLevel, visibility.All, visibility.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []treeEntry
+	for rows.Next() {
+		var e treeEntry
+		comment, err := scanComment(rows, &e.depth, &e.replyCount)
+		if err != nil {
+			return nil, err
+		}
+		e.comment = comment
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return assembleTree(entries), nil
+}
+
+func (s *PostgresStorage) GetCommentsByPostIDs(ctx context.Context, postIDs []string, order model.CommentOrder, limit, offset int, visibility Visibility) (map[string][]*model.Comment, error) {
+	clause, err := orderBy(order)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + commentColumns + ` FROM (
+	SELECT ` + commentColumns + `,
+		ROW_NUMBER() OVER (PARTITION BY post_id ORDER BY ` + clause + `) AS rn
+	FROM comments
+	WHERE post_id = ANY($1) AND parent_id IS NULL AND ` + visibleTo + `
+) c
+WHERE rn > $3 AND rn <= $2 + $3
+ORDER BY post_id, rn`
+	rows, err := s.pool.Query(ctx, query, postIDs, limit, offset, visibility.All, visibility.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[string][]*model.Comment, len(postIDs))
+	for _, c := range comments {
+		grouped[c.PostID] = append(grouped[c.PostID], c)
+	}
+	return grouped, nil
+}
+
+func (s *PostgresStorage) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, order model.CommentOrder, limit, offset int, visibility Visibility) (map[string][]*model.Comment, error) {
+	clause, err := orderBy(order)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + commentColumns + ` FROM (
+	SELECT ` + commentColumns + `,
+		ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY ` + clause + `) AS rn
+	FROM comments
+	WHERE parent_id = ANY($1) AND ` + visibleTo + `
+) c
+WHERE rn > $3 AND rn <= $2 + $3
+ORDER BY parent_id, rn`
+	rows, err := s.pool.Query(ctx, query, commentIDs, limit, offset, visibility.All, visibility.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	replies, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[string][]*model.Comment, len(commentIDs))
+	for _, c := range replies {
+		grouped[*c.ParentID] = append(grouped[*c.ParentID], c)
+	}
+	return grouped, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503" && pgErr.ConstraintName == constraint
+}
+
+// commentInsertError переводит нарушения ограничений при вставке комментария
+// в те же ошибки, что возвращает InMemoryStorage.
+func commentInsertError(comment *model.Comment, err error) error {
+	if errors.Is(err, pgx.ErrNoRows) && comment.ParentID != nil {
+		return fmt.Errorf("parent comment with ID %s %w in post %s", *comment.ParentID, ErrNotFound, comment.PostID)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch {
+	case pgErr.Code == "23505":
+		return fmt.Errorf("comment with ID %s already exists: %w", comment.ID, ErrConflict)
+	case pgErr.Code == "23503" && pgErr.ConstraintName == "comments_author_id_fkey":
+		return authorNotFound(comment.AuthorID)
+	case pgErr.Code == "23503" && pgErr.ConstraintName == "comments_post_id_fkey":
+		return fmt.Errorf("post with ID %s %w", comment.PostID, ErrNotFound)
+	case pgErr.Code == "23503" && pgErr.ConstraintName == "comments_parent_id_fkey" && comment.ParentID != nil:
+		return fmt.Errorf("parent comment with ID %s %w", *comment.ParentID, ErrNotFound)
+	}
+	return err
+}
+
+// cursorArgs раскладывает курсор на параметры запроса; nil-курсор даёт NULL.
+// Строки уходят в PostgreSQL в текстовом формате и приводятся к типу столбца.
+func cursorArgs(after *Cursor) (*string, *string) {
+	if after == nil {
+		return nil, nil
+	}
+	return &after.CreatedAt, &after.ID
+}
+
+// formatTimestamp переводит TIMESTAMPTZ в строку модели в UTC. Микросекунды
+// сохраняются, чтобы курсор, собранный из строки, точно совпадал со значением
+// в таблице.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatNullTimestamp(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := formatTimestamp(*t)
+	return &s
+}
+
+func scanUser(row pgx.Row) (*model.User, error) {
+	user := &model.User{}
+	var createdAt time.Time
+	if err := row.Scan(&user.ID, &user.DisplayName, &createdAt); err != nil {
+		return nil, err
+	}
+	user.CreatedAt = formatTimestamp(createdAt)
+	return user, nil
+}
+
+func scanPost(row pgx.Row) (*model.Post, error) {
+	post := &model.Post{}
+	var createdAt time.Time
+	var updatedAt *time.Time
+	var upvotes, downvotes int32
+	if err := row.Scan(&post.ID, &post.Title, &post.Content, &post.AuthorID, &post.ModerationMode, &createdAt, &updatedAt, &post.CommentCount, &post.TopLevelCommentCount, &upvotes, &downvotes); err != nil {
+		return nil, err
+	}
+	post.Score = upvotes - downvotes
+	post.CreatedAt = formatTimestamp(createdAt)
+	post.UpdatedAt = formatNullTimestamp(updatedAt)
+	return post, nil
+}
+
+func scanPosts(rows pgx.Rows) ([]*model.Post, error) {
+	var posts []*model.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// scanComment читает столбцы commentColumns; extra - дополнительные столбцы после них.
+func scanComment(row pgx.Row, extra ...any) (*model.Comment, error) {
+	comment := &model.Comment{}
+	var createdAt time.Time
+	var editedAt, deletedAt *time.Time
+	var upvotes, downvotes int32
+	dest := []any{&comment.ID, &comment.PostID, &comment.ParentID, &comment.AuthorID, &comment.Text, &createdAt, &editedAt, &deletedAt, &comment.Locked, &comment.Status, &comment.Depth, &comment.ReplyCount, &upvotes, &downvotes, &comment.Published}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	comment.Score = upvotes - downvotes
+	comment.CreatedAt = formatTimestamp(createdAt)
+	comment.EditedAt = formatNullTimestamp(editedAt)
+	comment.DeletedAt = formatNullTimestamp(deletedAt)
+	return comment, nil
+}
+
+func scanComments(rows pgx.Rows) ([]*model.Comment, error) {
+	var comments []*model.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
 		}
 		comments = append(comments, comment)
 	}
-	return comments, nil
+	return comments, rows.Err()
+}
+
+func (s *PostgresStorage) Migrator() (*Migrator, error) {
+	return NewMigrator(s.pool)
 }
 
 func (s *PostgresStorage) Close() {
@@ -8,36 +8,45 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestPostgresStorage(t *testing.T) {
+// newTestPostgres подключается к TEST_DATABASE_URL, применяет миграции
+// и очищает таблицы. Без переменной окружения тест пропускается.
+func newTestPostgres(t *testing.T) *PostgresStorage {
+	t.Helper()
 	dsn := os.Getenv("TEST_DATABASE_URL")
 	if dsn == "" {
 		t.Skip("TEST_DATABASE_URL not set")
 	}
 
-	pool, err := pgxpool.New(context.Background(), dsn)
-	assert.NoError(t, err)
-	defer pool.Close()
+	store, err := NewPostgresStorage(dsn)
+	require.NoError(t, err)
+	t.Cleanup(store.Close)
 
-	_, err = pool.Exec(context.Background(), "TRUNCATE TABLE comments, posts RESTART IDENTITY CASCADE")
-	assert.NoError(t, err)
+	migrator, err := store.Migrator()
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
 
-	store, err := NewPostgresStorage(dsn)
-	assert.NoError(t, err)
-	defer store.Close()
+	_, err = store.pool.Exec(context.Background(), "TRUNCATE TABLE rate_limit_buckets, comment_reports, post_tags, tags, comment_reactions, post_reactions, comment_votes, post_votes, comment_revisions, comments, posts, users RESTART IDENTITY CASCADE")
+	require.NoError(t, err)
+	seedUsers(t, store)
+	return store
+}
 
+func TestPostgresStorage(t *testing.T) {
+	store := newTestPostgres(t)
 	ctx := context.Background()
 
 	post := &model.Post{
-		ID:            uuid.NewString(),
-		Title:         "Test Post",
-		Content:       "Content",
-		Author:        "Author",
-		AllowComments: true,
-		CreatedAt:     time.Now().Format(time.RFC3339),
+		ID:             uuid.NewString(),
+		Title:          "Test Post",
+		Content:        "Content",
+		AuthorID:       "Author",
+		ModerationMode: model.ModerationModeOpen,
+		CreatedAt:      time.Now().Format(time.RFC3339),
 	}
 	assert.NoError(t, store.CreatePost(ctx, post))
 
@@ -47,16 +56,290 @@ func TestPostgresStorage(t *testing.T) {
 
 	comment := &model.Comment{
 		PostID:    post.ID,
-		Author:    "User",
+		AuthorID:  "User",
 		Text:      "Test comment",
 		CreatedAt: time.Now().Format(time.RFC3339),
 	}
 	createdComment, err := store.CreateComment(ctx, comment)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, createdComment.ID)
+	id, err := uuid.Parse(createdComment.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, uuid.Version(7), id.Version())
+
+	// Произвольная строка в качестве parent_id - это "не найден", а не ошибка формата
+	replies, err := store.GetRepliesByCommentID(ctx, "non-existent-parent", model.CommentOrderOldest, 10, 0, Visibility{})
+	assert.NoError(t, err)
+	assert.Empty(t, replies)
+	_, err = store.GetComment(ctx, "non-existent-id")
+	assert.EqualError(t, err, "comment not found")
 
-	comments, err := store.GetCommentsByPostID(ctx, post.ID, 1, 0)
+	comments, err := store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 1, 0, Visibility{})
 	assert.NoError(t, err)
 	assert.Len(t, comments, 1)
 	assert.Equal(t, "Test comment", comments[0].Text)
+
+	page, hasNext, err := store.GetCommentsPageByPostID(ctx, post.ID, 1, nil, Visibility{})
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, page, 1)
+
+	posts, _, err := store.GetPosts(ctx, nil, model.PostOrderNewest, 10, &Cursor{CreatedAt: page[0].CreatedAt, ID: "~"})
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	author := "Author"
+	posts, _, err = store.GetPosts(ctx, &model.PostFilter{AuthorID: &author, CreatedBefore: &post.CreatedAt}, model.PostOrderOldest, 10, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+	user, err := store.GetUser(ctx, "User")
+	assert.NoError(t, err)
+	assert.Equal(t, "User", user.DisplayName)
+	assert.ErrorIs(t, store.CreateUser(ctx, user), ErrConflict)
+	_, err = store.GetUser(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	err = store.CreatePost(ctx, &model.Post{ID: uuid.NewString(), Title: "T", Content: "C", AuthorID: "missing", CreatedAt: post.CreatedAt})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "missing", Text: "Comment"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	byAuthor, hasNext, err := store.GetCommentsPageByAuthorID(ctx, "User", 10, nil, Visibility{})
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	assert.Len(t, byAuthor, 1)
+	assert.NoError(t, store.SetPostTags(ctx, post.ID, []string{"go", "databases"}))
+	assert.NoError(t, store.SetPostTags(ctx, post.ID, []string{"go", "sql"}))
+	assert.ErrorIs(t, store.SetPostTags(ctx, "non-existent-id", []string{"go"}), ErrNotFound)
+	byPost, err := store.GetTagsByPostIDs(ctx, []string{post.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go", "sql"}, byPost[post.ID])
+	tags, err := store.GetTags(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Tag{{Name: "go", PostCount: 1}, {Name: "sql", PostCount: 1}}, tags)
+	tag := "sql"
+	posts, _, err = store.GetPosts(ctx, &model.PostFilter{Tag: &tag}, "", 10, nil)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	tagged := &model.Post{ID: uuid.NewString(), Title: "Tagged", Content: "C", AuthorID: "Author", Tags: []string{"sql", "api"}, CreatedAt: post.CreatedAt}
+	assert.NoError(t, store.CreatePost(ctx, tagged))
+	err = store.CreatePost(ctx, &model.Post{ID: uuid.NewString(), Title: "T", Content: "C", AuthorID: "missing", Tags: []string{"orphan"}, CreatedAt: post.CreatedAt})
+	assert.ErrorIs(t, err, ErrNotFound)
+	byPost, err = store.GetTagsByPostIDs(ctx, []string{tagged.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api", "sql"}, byPost[tagged.ID])
+	tags, err = store.GetTags(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Tag{{Name: "sql", PostCount: 2}, {Name: "api", PostCount: 1}, {Name: "go", PostCount: 1}}, tags)
+	assert.NoError(t, store.DeletePost(ctx, tagged.ID))
+	topCursor := PostCursor(model.PostOrderTop, post)
+	posts, _, err = store.GetPosts(ctx, nil, model.PostOrderTop, 10, &topCursor)
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+
+	reply, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, ParentID: &createdComment.ID, AuthorID: "User", Text: "Reply"})
+	assert.NoError(t, err)
+	other := &model.Post{ID: uuid.NewString(), Title: "Other", Content: "C", AuthorID: "User", CreatedAt: post.CreatedAt}
+	assert.NoError(t, store.CreatePost(ctx, other))
+	_, err = store.CreateComment(ctx, &model.Comment{PostID: other.ID, ParentID: &createdComment.ID, AuthorID: "User", Text: "Cross reply"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.DeletePost(ctx, other.ID))
+	tree, err := store.GetCommentTree(ctx, post.ID, 3, 10, Visibility{})
+	assert.NoError(t, err)
+	assert.Len(t, tree, 1)
+	assert.Equal(t, int32(1), tree[0].ReplyCount)
+	assert.Len(t, tree[0].Children, 1)
+	assert.Equal(t, reply.ID, tree[0].Children[0].Comment.ID)
+	assert.Equal(t, int32(1), reply.Depth)
+	ancestors, err := store.GetCommentAncestors(ctx, reply.ID, Visibility{})
+	assert.NoError(t, err)
+	assert.Len(t, ancestors, 1)
+	assert.Equal(t, createdComment.ID, ancestors[0].ID)
+	descendants, err := store.CountDescendants(ctx, createdComment.ID, Visibility{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, descendants)
+	byComment, err := store.GetCommentAncestorsByIDs(ctx, []string{createdComment.ID, reply.ID}, Visibility{})
+	assert.NoError(t, err)
+	if assert.Len(t, byComment, 1) && assert.Len(t, byComment[reply.ID], 1) {
+		assert.Equal(t, createdComment.ID, byComment[reply.ID][0].ID)
+	}
+	counts, err := store.CountDescendantsByIDs(ctx, []string{createdComment.ID, reply.ID}, Visibility{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{createdComment.ID: 1}, counts)
+	subtree, err := store.GetCommentSubtree(ctx, reply.ID, 3, 10, Visibility{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), subtree.Depth)
+	_, err = store.GetCommentSubtree(ctx, "non-existent-id", 3, 10, Visibility{})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	retrieved, err = store.GetPost(ctx, post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), retrieved.CommentCount)
+	assert.Equal(t, int32(1), retrieved.TopLevelCommentCount)
+	assert.NoError(t, store.DeleteComment(ctx, reply.ID, time.Now().Format(time.RFC3339)))
+	parent, err := store.GetComment(ctx, createdComment.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, parent.ReplyCount)
+
+	// Сбитые счётчики восстанавливаются пересчётом
+	_, err = store.pool.Exec(ctx, `UPDATE posts SET comment_count = 100`)
+	assert.NoError(t, err)
+	fixedPosts, fixedComments, err := store.RepairCounters(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), fixedPosts)
+	assert.Zero(t, fixedComments)
+	retrieved, err = store.GetPost(ctx, post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), retrieved.CommentCount)
+
+	assert.NoError(t, store.Vote(ctx, TargetComment, createdComment.ID, "alice", 1))
+	assert.NoError(t, store.Vote(ctx, TargetComment, createdComment.ID, "alice", -1))
+	assert.NoError(t, store.Vote(ctx, TargetComment, createdComment.ID, "bob", -1))
+	voted, err := store.GetComment(ctx, createdComment.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(-2), voted.Score)
+	assert.ErrorIs(t, store.Vote(ctx, TargetPost, "non-existent-id", "alice", 1), ErrNotFound)
+	assert.ErrorIs(t, store.Vote(ctx, TargetComment, createdComment.ID, "missing", 1), ErrNotFound)
+
+	reacted, err := store.ToggleReaction(ctx, TargetPost, post.ID, "alice", "👍")
+	assert.NoError(t, err)
+	assert.True(t, reacted)
+	_, _ = store.ToggleReaction(ctx, TargetPost, post.ID, "bob", "🎉")
+	reactions, err := store.GetReactions(ctx, TargetPost, post.ID, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Reaction{
+		{Emoji: "🎉", Count: 1, ViewerReacted: true},
+		{Emoji: "👍", Count: 1},
+	}, reactions)
+	byTarget, err := store.GetReactionsByTargetIDs(ctx, TargetPost, []string{post.ID, "non-existent-id"}, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]*model.Reaction{post.ID: {
+		{Emoji: "🎉", Count: 1},
+		{Emoji: "👍", Count: 1, ViewerReacted: true},
+	}}, byTarget)
+	_, err = store.ToggleReaction(ctx, TargetComment, "non-existent-id", "alice", "👍")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Заголовок поста весит больше текста комментария
+	hits, hasNext, err := store.Search(ctx, "test", nil, 10, 0)
+	assert.NoError(t, err)
+	assert.False(t, hasNext)
+	if assert.Len(t, hits, 2) {
+		assert.Equal(t, post.ID, hits[0].Post.ID)
+		assert.Equal(t, "<b>Test</b> Post Content", hits[0].Snippet)
+		assert.Equal(t, createdComment.ID, hits[1].Comment.ID)
+	}
+	hits, _, err = store.Search(ctx, "test", []model.SearchType{model.SearchTypeComment}, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+	// Разметка из текста экранируется, в фрагменте остаётся только <b>
+	markupPost := &model.Post{ID: uuid.NewString(), Title: "Markup", Content: "Content", AuthorID: "Author", CreatedAt: time.Now().Format(time.RFC3339)}
+	require.NoError(t, store.CreatePost(ctx, markupPost))
+	_, err = store.CreateComment(ctx, &model.Comment{PostID: markupPost.ID, AuthorID: "User", Text: `Say "<i>hi</i>" & hello`, CreatedAt: time.Now().Format(time.RFC3339)})
+	require.NoError(t, err)
+	hits, _, err = store.Search(ctx, "hello", nil, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, hits, 1) {
+		assert.NotContains(t, hits[0].Snippet, "<i>")
+		assert.Contains(t, hits[0].Snippet, "&lt;i&gt;hi&lt;/i&gt;")
+		assert.Contains(t, hits[0].Snippet, "<b>hello</b>")
+	}
+	// Сущности вроде &lt; не становятся словами: "lt" выделяется только как слово текста
+	_, err = store.CreateComment(ctx, &model.Comment{PostID: markupPost.ID, AuthorID: "User", Text: "x < y reads as x lt y", CreatedAt: time.Now().Format(time.RFC3339)})
+	require.NoError(t, err)
+	hits, _, err = store.Search(ctx, "lt", nil, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, "x &lt; y reads as x <b>lt</b> y", hits[0].Snippet)
+		assert.Equal(t, snippet("x < y reads as x lt y", []string{"lt"}), hits[0].Snippet)
+	}
+	assert.NoError(t, store.DeletePost(ctx, markupPost.ID))
+
+	report := &model.CommentReport{ReporterID: "alice", Reason: "spam", CreatedAt: time.Now().Format(time.RFC3339)}
+	reported, err := store.ReportComment(ctx, createdComment.ID, report)
+	assert.NoError(t, err)
+	assert.Equal(t, model.CommentStatusReported, reported.Status)
+	_, err = store.ReportComment(ctx, createdComment.ID, report)
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = store.ReportComment(ctx, createdComment.ID, &model.CommentReport{ReporterID: "missing", Reason: "spam", CreatedAt: report.CreatedAt})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.ReportComment(ctx, reply.ID, report)
+	assert.ErrorIs(t, err, ErrNotFound)
+	reports, err := store.GetCommentReports(ctx, createdComment.ID)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+	queue, _, err := store.GetModerationQueue(ctx, model.CommentStatusReported, 10, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queue, 1)
+
+	hidden, err := store.SetCommentStatus(ctx, createdComment.ID, model.CommentStatusHidden)
+	assert.NoError(t, err)
+	assert.Equal(t, model.CommentStatusHidden, hidden.Status)
+	ancestors, err = store.GetCommentAncestors(ctx, reply.ID, Visibility{})
+	assert.NoError(t, err)
+	assert.Empty(t, ancestors)
+	comments, err = store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{})
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+	comments, err = store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{All: true})
+	assert.NoError(t, err)
+	assert.Len(t, comments, 1)
+	tree, err = store.GetCommentTree(ctx, post.ID, 3, 10, Visibility{})
+	assert.NoError(t, err)
+	assert.Empty(t, tree)
+	hits, _, err = store.Search(ctx, "test", []model.SearchType{model.SearchTypeComment}, 10, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, hits)
+	_, err = store.SetCommentStatus(ctx, createdComment.ID, model.CommentStatusRejected)
+	assert.NoError(t, err)
+	_, err = store.SetCommentStatus(ctx, createdComment.ID, model.CommentStatusApproved)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	post.ModerationMode = model.ModerationModePremoderated
+	assert.NoError(t, store.UpdatePost(ctx, post))
+	premoderated := model.ModerationModePremoderated
+	posts, _, err = store.GetPosts(ctx, &model.PostFilter{ModerationMode: &premoderated}, "", 10, nil)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 1)
+	pending, err := store.CreateComment(ctx, &model.Comment{PostID: post.ID, AuthorID: "alice", Text: "Pending", CreatedAt: time.Now().Format(time.RFC3339), Status: model.CommentStatusPending})
+	assert.NoError(t, err)
+	assert.Equal(t, model.CommentStatusPending, pending.Status)
+	assert.False(t, pending.Published)
+	comments, err = store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{AuthorID: "bob"})
+	assert.NoError(t, err)
+	assert.Empty(t, comments)
+	comments, err = store.GetCommentsByPostID(ctx, post.ID, model.CommentOrderOldest, 10, 0, Visibility{AuthorID: "alice"})
+	assert.NoError(t, err)
+	assert.Len(t, comments, 1)
+	approved, err := store.SetCommentStatus(ctx, pending.ID, model.CommentStatusApproved)
+	assert.NoError(t, err)
+	assert.Equal(t, model.CommentStatusApproved, approved.Status)
+	assert.True(t, approved.Published)
+
+	// Отклонённый комментарий не считается, одобренный из очереди - считается
+	retrieved, err = store.GetPost(ctx, post.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), retrieved.CommentCount)
+	assert.Equal(t, int32(1), retrieved.TopLevelCommentCount)
+	fixedPosts, fixedComments, err = store.RepairCounters(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, fixedPosts)
+	assert.Zero(t, fixedComments)
+
+	var seen []time.Time
+	take := func(tokens float64, updatedAt, now time.Time) float64 {
+		seen = append(seen, updatedAt)
+		return tokens + 1
+	}
+	assert.NoError(t, store.UpdateRateBucket(ctx, "addComment:user:alice", take))
+	assert.NoError(t, store.UpdateRateBucket(ctx, "addComment:user:alice", take))
+	var tokens float64
+	assert.NoError(t, store.pool.QueryRow(ctx, `SELECT tokens FROM rate_limit_buckets WHERE key = $1`, "addComment:user:alice").Scan(&tokens))
+	assert.Equal(t, 2.0, tokens)
+	if assert.Len(t, seen, 2) {
+		assert.True(t, seen[0].IsZero())
+		assert.False(t, seen[1].IsZero())
+	}
+	pruned, err := store.PruneRateBuckets(ctx, time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, pruned)
+	pruned, err = store.PruneRateBuckets(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
 }
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// UpdateRateBucket пересчитывает корзину токенов key под блокировкой строки,
+// поэтому лимит общий для всех экземпляров сервера. Время берётся из базы,
+// чтобы расхождение часов экземпляров не влияло на наполнение корзины, и
+// только после блокировки: now() зафиксирован в начале транзакции, и после
+// ожидания чужой блокировки оказался бы раньше updated_at.
+func (s *PostgresStorage) UpdateRateBucket(ctx context.Context, key string, fn func(tokens float64, updatedAt, now time.Time) float64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `INSERT INTO rate_limit_buckets (key, tokens) VALUES ($1, 0) ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return err
+	}
+	var (
+		tokens    float64
+		updatedAt *time.Time
+		now       time.Time
+	)
+	err = tx.QueryRow(ctx, `SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE`, key).Scan(&tokens, &updatedAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow(ctx, `SELECT clock_timestamp()`).Scan(&now); err != nil {
+		return err
+	}
+	var last time.Time
+	if updatedAt != nil {
+		last = *updatedAt
+		// Часы базы могли сдвинуться назад: updated_at не должен уменьшаться
+		if now.Before(last) {
+			now = last
+		}
+	}
+	tokens = fn(tokens, last, now)
+
+	if _, err := tx.Exec(ctx, `UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE key = $1`, key, tokens, now); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// PruneRateBuckets удаляет корзины, не менявшиеся дольше idle, и возвращает их число.
+func (s *PostgresStorage) PruneRateBuckets(ctx context.Context, idle time.Duration) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => $1)`, idle.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
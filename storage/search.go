@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"cmp"
+	"html"
+	"post-comment-app/graph/model"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// SearchHit - найденный пост или комментарий; заполнено ровно одно из полей Post и Comment.
+type SearchHit struct {
+	Post    *model.Post
+	Comment *model.Comment
+	Rank    float64
+	Snippet string
+}
+
+// Веса полей, как у ts_rank по умолчанию для меток A, B и D: заголовок поста,
+// текст поста и текст комментария.
+const (
+	weightTitle   = 1.0
+	weightContent = 0.4
+	weightComment = 0.1
+)
+
+// Размер фрагмента в словах и сколько слов оставить перед первым совпадением.
+const (
+	snippetWords   = 35
+	snippetContext = 5
+)
+
+// searchTypes разворачивает фильтр по типам; пустой фильтр означает все типы.
+func searchTypes(types []model.SearchType) (posts, comments bool) {
+	if len(types) == 0 {
+		return true, true
+	}
+	return slices.Contains(types, model.SearchTypePost), slices.Contains(types, model.SearchTypeComment)
+}
+
+// tokenize разбивает текст на слова в нижнем регистре, как конфигурация
+// 'simple' полнотекстового поиска PostgreSQL: без стемминга и стоп-слов.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type weightedText struct {
+	text   string
+	weight float64
+}
+
+// searchIndex - инвертированный индекс in-memory хранилища:
+// слово -> объект -> взвешенное число вхождений.
+type searchIndex struct {
+	postings map[string]map[target]float64
+	terms    map[target][]string
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[target]float64),
+		terms:    make(map[target][]string),
+	}
+}
+
+// add (пере)индексирует объект.
+func (ix *searchIndex) add(t target, fields ...weightedText) {
+	ix.remove(t)
+	var terms []string
+	for _, f := range fields {
+		for _, term := range tokenize(f.text) {
+			docs := ix.postings[term]
+			if docs == nil {
+				docs = make(map[target]float64)
+				ix.postings[term] = docs
+			}
+			if _, ok := docs[t]; !ok {
+				terms = append(terms, term)
+			}
+			docs[t] += f.weight
+		}
+	}
+	ix.terms[t] = terms
+}
+
+func (ix *searchIndex) remove(t target) {
+	for _, term := range ix.terms[t] {
+		delete(ix.postings[term], t)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.terms, t)
+}
+
+// match возвращает объекты, содержащие все слова, с суммой весов вхождений.
+func (ix *searchIndex) match(terms []string) map[target]float64 {
+	if len(terms) == 0 {
+		return nil
+	}
+	// Начинаем с самого редкого слова, чтобы пересечение было коротким
+	slices.SortFunc(terms, func(a, b string) int { return cmp.Compare(len(ix.postings[a]), len(ix.postings[b])) })
+	found := make(map[target]float64)
+	for t, w := range ix.postings[terms[0]] {
+		found[t] = w
+	}
+	for _, term := range terms[1:] {
+		docs := ix.postings[term]
+		for t := range found {
+			if w, ok := docs[t]; ok {
+				found[t] += w
+			} else {
+				delete(found, t)
+			}
+		}
+	}
+	return found
+}
+
+// snippet вырезает из текста до snippetWords слов, начиная незадолго до первого
+// совпадения, и выделяет совпавшие слова как ts_headline: <b>слово</b>.
+// Сам текст экранируется, так что разметкой в фрагменте остаются только <b>.
+func snippet(text string, terms []string) string {
+	type span struct {
+		start, end int
+		hit        bool
+	}
+	var spans []span
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			spans = append(spans, span{start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start: start, end: len(text)})
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+
+	first := -1
+	for i := range spans {
+		spans[i].hit = slices.Contains(terms, strings.ToLower(text[spans[i].start:spans[i].end]))
+		if spans[i].hit && first < 0 {
+			first = i
+		}
+	}
+	from := max(0, first-snippetContext)
+	to := min(len(spans), from+snippetWords)
+
+	var b strings.Builder
+	pos := spans[from].start
+	for _, sp := range spans[from:to] {
+		b.WriteString(html.EscapeString(text[pos:sp.start]))
+		if sp.hit {
+			b.WriteString("<b>" + html.EscapeString(text[sp.start:sp.end]) + "</b>")
+		} else {
+			b.WriteString(html.EscapeString(text[sp.start:sp.end]))
+		}
+		pos = sp.end
+	}
+	return b.String()
+}
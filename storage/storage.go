@@ -6,11 +6,102 @@ import (
 )
 
 type Storage interface {
+	CreateUser(ctx context.Context, user *model.User) error
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	// GetUsersByIDs - пакетный вариант GetUser для загрузчика; неизвестные ID пропускаются.
+	GetUsersByIDs(ctx context.Context, ids []string) (map[string]*model.User, error)
+	// CreatePost и CreateComment требуют, чтобы автор (AuthorID) существовал.
+	// Пустой ModerationMode поста сохраняется как OPEN. Теги поста (Tags)
+	// сохраняются вместе с ним, как в SetPostTags.
 	CreatePost(ctx context.Context, post *model.Post) error
-	GetPosts(ctx context.Context) ([]*model.Post, error)
+	// GetPosts возвращает страницу ленты: посты, подходящие под filter (nil - все),
+	// в порядке order (пустой - NEWEST), после курсора after, выданного для того же
+	// порядка. Второе значение - есть ли ещё страница.
+	GetPosts(ctx context.Context, filter *model.PostFilter, order model.PostOrder, first int, after *Cursor) ([]*model.Post, bool, error)
 	GetPost(ctx context.Context, id string) (*model.Post, error)
+	UpdatePost(ctx context.Context, post *model.Post) error
+	// DeletePost удаляет пост и все его комментарии.
+	DeletePost(ctx context.Context, id string) error
+	// SetPostTags заменяет теги поста. Теги приходят уже нормализованными и без повторов.
+	SetPostTags(ctx context.Context, postID string, tags []string) error
+	// GetTagsByPostIDs возвращает теги каждого поста по алфавиту (побайтово).
+	GetTagsByPostIDs(ctx context.Context, postIDs []string) (map[string][]string, error)
+	// GetTags возвращает до limit используемых тегов по убыванию числа постов, затем по имени.
+	GetTags(ctx context.Context, limit int) ([]*model.Tag, error)
+	// CreateComment сохраняет статус PENDING, любой другой заменяет на PUBLISHED.
 	CreateComment(ctx context.Context, comment *model.Comment) (*model.Comment, error)
 	GetComment(ctx context.Context, id string) (*model.Comment, error)
-	GetCommentsByPostID(ctx context.Context, postID string, limit, offset int) ([]*model.Comment, error)
-	GetRepliesByCommentID(ctx context.Context, commentID string, limit, offset int) ([]*model.Comment, error)
+	// UpdateComment сохраняет новые текст и время правки и в той же операции
+	// записывает прежний текст в историю правок от имени пользователя editorID.
+	// Status = PENDING отправляет видимый читателям комментарий на повторную
+	// проверку с пересчётом счётчиков; прочие статусы не меняются.
+	UpdateComment(ctx context.Context, comment *model.Comment, editorID string) error
+	GetCommentRevisions(ctx context.Context, commentID string) ([]*model.CommentRevision, error)
+	// CountCommentRevisions возвращает число правок каждого комментария;
+	// комментариев без правок в результате нет.
+	CountCommentRevisions(ctx context.Context, commentIDs []string) (map[string]int, error)
+	SetThreadLocked(ctx context.Context, commentID string, locked bool) error
+	// IsThreadLocked сообщает, заблокирован ли сам комментарий или любой из его предков.
+	IsThreadLocked(ctx context.Context, commentID string) (bool, error)
+	// GetCommentAncestors возвращает видимых с visibility предков комментария
+	// от верхнего уровня к непосредственному родителю; для неизвестного ID -
+	// пустой список.
+	GetCommentAncestors(ctx context.Context, commentID string, visibility Visibility) ([]*model.Comment, error)
+	// CountDescendants считает видимых с visibility потомков комментария на
+	// любой глубине, включая удалённые.
+	CountDescendants(ctx context.Context, commentID string, visibility Visibility) (int, error)
+	// Пакетные варианты GetCommentAncestors и CountDescendants для загрузчиков;
+	// комментариев без видимых предков или потомков в результате нет.
+	GetCommentAncestorsByIDs(ctx context.Context, commentIDs []string, visibility Visibility) (map[string][]*model.Comment, error)
+	CountDescendantsByIDs(ctx context.Context, commentIDs []string, visibility Visibility) (map[string]int, error)
+	// DeleteComment помечает комментарий удалённым (deleted_at), не трогая ответы.
+	// Повторное удаление возвращает ошибку "comment not found".
+	DeleteComment(ctx context.Context, id string, deletedAt string) error
+	// Постраничная выдача в порядке order; пустой order означает OLDEST.
+	// Скрытые комментарии попадают в неё, только если видны с visibility.
+	GetCommentsByPostID(ctx context.Context, postID string, order model.CommentOrder, limit, offset int, visibility Visibility) ([]*model.Comment, error)
+	GetRepliesByCommentID(ctx context.Context, commentID string, order model.CommentOrder, limit, offset int, visibility Visibility) ([]*model.Comment, error)
+	// Курсорная пагинация по (created_at, id): комментарии и ответы от старых к новым.
+	// Как и в дереве и комментариях автора, скрытые комментарии попадают
+	// в выдачу, только если видны с visibility. Поиск скрытых не содержит.
+	GetCommentsPageByPostID(ctx context.Context, postID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error)
+	GetRepliesPageByCommentID(ctx context.Context, commentID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error)
+	// GetCommentsPageByAuthorID - неудалённые комментарии автора от новых к старым.
+	GetCommentsPageByAuthorID(ctx context.Context, authorID string, first int, after *Cursor, visibility Visibility) ([]*model.Comment, bool, error)
+	// Vote записывает голос пользователя voterID за пост или комментарий: 1, -1
+	// или 0, чтобы снять голос. У каждого пользователя не больше одного голоса за объект.
+	// Vote и ToggleReaction требуют, чтобы пользователь существовал.
+	Vote(ctx context.Context, kind TargetKind, targetID, voterID string, value int) error
+	// ToggleReaction ставит реакцию emoji от пользователя userID или снимает уже
+	// поставленную. Возвращает, стоит ли реакция после вызова.
+	ToggleReaction(ctx context.Context, kind TargetKind, targetID, userID, emoji string) (bool, error)
+	// GetReactions возвращает реакции по убыванию числа поставивших, затем по emoji.
+	GetReactions(ctx context.Context, kind TargetKind, targetID, viewer string) ([]*model.Reaction, error)
+	// GetReactionsByTargetIDs - пакетный вариант GetReactions для загрузчика;
+	// объектов без реакций в результате нет.
+	GetReactionsByTargetIDs(ctx context.Context, kind TargetKind, targetIDs []string, viewer string) (map[string][]*model.Reaction, error)
+	// Search ищет посты и комментарии, содержащие все слова query, по убыванию
+	// релевантности, затем от новых к старым. Удалённые комментарии не ищутся.
+	Search(ctx context.Context, query string, types []model.SearchType, first, offset int) ([]*SearchHit, bool, error)
+	// Дерево комментариев одним запросом: узлы с глубиной не больше maxDepth,
+	// не больше limitPerLevel детей на родителя, дети от старых к новым.
+	// Невидимый с visibility корень поддерева - "comment not found".
+	GetCommentTree(ctx context.Context, postID string, maxDepth, limitPerLevel int, visibility Visibility) ([]*model.CommentTreeNode, error)
+	GetCommentSubtree(ctx context.Context, commentID string, maxDepth, limitPerLevel int, visibility Visibility) (*model.CommentTreeNode, error)
+	// Пакетные варианты для загрузчиков: одна выборка на уровень дерева,
+	// порядок и limit/offset применяются к каждому родителю отдельно.
+	GetCommentsByPostIDs(ctx context.Context, postIDs []string, order model.CommentOrder, limit, offset int, visibility Visibility) (map[string][]*model.Comment, error)
+	GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, order model.CommentOrder, limit, offset int, visibility Visibility) (map[string][]*model.Comment, error)
+	// ReportComment записывает жалобу на неудалённый комментарий, видимый
+	// читателям (на скрытый - "comment not found"), и переводит
+	// опубликованный комментарий в REPORTED. Повторная жалоба того же
+	// пользователя - ErrConflict. Возвращает комментарий после изменения.
+	ReportComment(ctx context.Context, commentID string, report *model.CommentReport) (*model.Comment, error)
+	// GetCommentReports возвращает жалобы на комментарий от старых к новым.
+	GetCommentReports(ctx context.Context, commentID string) ([]*model.CommentReport, error)
+	// SetCommentStatus - решение модератора: APPROVED, HIDDEN или REJECTED.
+	// Недопустимый из текущего статуса переход - ErrConflict.
+	SetCommentStatus(ctx context.Context, commentID string, status model.CommentStatus) (*model.Comment, error)
+	// GetModerationQueue - неудалённые комментарии в статусе status от старых к новым.
+	GetModerationQueue(ctx context.Context, status model.CommentStatus, first int, after *Cursor) ([]*model.Comment, bool, error)
 }
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"post-comment-app/graph/model"
+	"slices"
+)
+
+// pathSeparator разделяет ID в материализованном пути комментария. В ID
+// (UUID и прежние числовые) этот символ не встречается.
+const pathSeparator = "/"
+
+// treeEntry - плоская строка дерева комментариев до сборки.
+type treeEntry struct {
+	comment    *model.Comment
+	depth      int
+	replyCount int
+}
+
+// assembleTree собирает вложенные узлы из записей, в которых родитель идёт
+// раньше своих детей, а дети одного родителя - в порядке выдачи.
+// Возвращает узлы глубины 0.
+func assembleTree(entries []treeEntry) []*model.CommentTreeNode {
+	nodes := make(map[string]*model.CommentTreeNode, len(entries))
+	roots := []*model.CommentTreeNode{}
+	for _, e := range entries {
+		node := &model.CommentTreeNode{
+			Comment:    e.comment,
+			Depth:      int32(e.depth),
+			ReplyCount: int32(e.replyCount),
+			Children:   []*model.CommentTreeNode{},
+		}
+		nodes[e.comment.ID] = node
+		if e.depth == 0 {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := nodes[*e.comment.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	return roots
+}
+
+// walkTree обходит дерево по уровням, начиная с level (глубина 0).
+// children - ответы каждого комментария, уже упорядоченные.
+func walkTree(children map[string][]*model.Comment, level []*model.Comment, maxDepth, limitPerLevel int) []treeEntry {
+	var entries []treeEntry
+	for depth := 0; depth <= maxDepth && len(level) > 0; depth++ {
+		var next []*model.Comment
+		for _, c := range level {
+			kids := children[c.ID]
+			entries = append(entries, treeEntry{comment: c, depth: depth, replyCount: len(kids)})
+			if depth < maxDepth {
+				next = append(next, kids[:min(limitPerLevel, len(kids))]...)
+			}
+		}
+		level = next
+	}
+	return entries
+}
+
+// childrenIndex раскладывает комментарии по родителям за один проход;
+// комментарии верхнего уровня лежат под ключом "".
+func childrenIndex(comments []*model.Comment) map[string][]*model.Comment {
+	index := make(map[string][]*model.Comment)
+	for _, c := range comments {
+		parent := ""
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		index[parent] = append(index[parent], c)
+	}
+	for _, kids := range index {
+		slices.SortStableFunc(kids, func(a, b *model.Comment) int { return compareKeys(commentKey(a), commentKey(b)) })
+	}
+	return index
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"cmp"
+	"post-comment-app/graph/model"
+	"slices"
+)
+
+// TargetKind различает объекты, за которые голосуют и на которые ставят реакции.
+type TargetKind int
+
+const (
+	TargetPost TargetKind = iota
+	TargetComment
+)
+
+func targetNotFound(kind TargetKind) error {
+	if kind == TargetComment {
+		return errCommentNotFound
+	}
+	return errPostNotFound
+}
+
+// voteTally - суммы голосов за объект.
+type voteTally struct {
+	up, down int
+}
+
+// replace учитывает замену голоса prev на value; 0 означает отсутствие голоса.
+func (t voteTally) replace(prev, value int) voteTally {
+	return t.shift(prev, -1).shift(value, 1)
+}
+
+func (t voteTally) shift(value, sign int) voteTally {
+	switch value {
+	case 1:
+		t.up += sign
+	case -1:
+		t.down += sign
+	}
+	return t
+}
+
+// sortReactions задаёт общий для бэкендов порядок: по убыванию числа, затем по emoji.
+func sortReactions(reactions []*model.Reaction) {
+	slices.SortFunc(reactions, func(a, b *model.Reaction) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Emoji, b.Emoji)
+	})
+}